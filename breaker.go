@@ -0,0 +1,100 @@
+package dualconn
+
+import "time"
+
+// The states of a Breaker.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerConfig tunes the circuit breakers of the targets.
+type BreakerConfig struct {
+	// Failures is the consecutive failed dials to open the breaker, 5 by default.
+	Failures int
+	// Cooldown is the time the breaker stays open before half-open, 30s by default.
+	Cooldown time.Duration
+	// HalfOpenDials is the number of the trial dials let through when half-open, 1 by default,
+	// the breaker closes when they all succeed, and opens again on any failure.
+	HalfOpenDials int
+}
+
+// Breaker is the circuit breaker of a target, an open one skips the dials to the target.
+type Breaker struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+
+	trials, passed int
+}
+
+// WithBreaker trips a circuit breaker per target after the consecutive failed dials,
+// the dials skip the target for the cooldown, then a limited number of trial dials decide to close it or not.
+func (d *Manager) WithBreaker(c BreakerConfig) *Manager {
+	if c.Failures <= 0 {
+		c.Failures = 5
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	if c.HalfOpenDials <= 0 {
+		c.HalfOpenDials = 1
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.breaker = &c
+	for _, t := range d.Targets {
+		t.Breaker = &Breaker{State: BreakerClosed}
+	}
+	return d
+}
+
+// admit tells whether the breaker of the target lets a dial through, called under the lock.
+func (d *Manager) admit(t *Target) bool {
+	b := t.Breaker
+	if d.breaker == nil || b == nil {
+		return true
+	}
+
+	switch b.State {
+	case BreakerOpen:
+		if d.clock.Now().Sub(*b.OpenedAt) < d.breaker.Cooldown {
+			return false
+		}
+		b.State, b.trials, b.passed = BreakerHalfOpen, 0, 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.trials >= d.breaker.HalfOpenDials {
+			return false
+		}
+		b.trials++
+	}
+	return true
+}
+
+// observeBreaker feeds the result of an admitted dial to the breaker of the target, called under the lock.
+func (d *Manager) observeBreaker(t *Target, ok bool) {
+	b := t.Breaker
+	if d.breaker == nil || b == nil {
+		return
+	}
+
+	if !ok {
+		b.Failures++
+		if b.State == BreakerHalfOpen || b.Failures >= d.breaker.Failures {
+			now := d.clock.Now()
+			b.State, b.OpenedAt = BreakerOpen, &now
+		}
+		return
+	}
+
+	b.Failures = 0
+	if b.State == BreakerHalfOpen {
+		if b.passed++; b.passed >= d.breaker.HalfOpenDials {
+			b.State, b.OpenedAt = BreakerClosed, nil
+		}
+	}
+}
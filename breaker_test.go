@@ -0,0 +1,112 @@
+package dualconn
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	clock := newFakeClock()
+	m := NewManager([]string{"10.0.0.1:3306"}, time.Second).WithClock(clock).
+		WithBreaker(BreakerConfig{Failures: 3, Cooldown: time.Minute, HalfOpenDials: 2})
+	t.Cleanup(func() { _ = m.Close() })
+
+	m.Lock()
+	defer m.Unlock()
+
+	target := m.Targets[0]
+	state := func(want string) {
+		t.Helper()
+		if b := target.Breaker; b.State != want {
+			t.Fatalf("breaker %+v, want %s", b, want)
+		}
+	}
+
+	// a success resets the consecutive failures
+	m.observeBreaker(target, false)
+	m.observeBreaker(target, false)
+	m.observeBreaker(target, true)
+	m.observeBreaker(target, false)
+	state(BreakerClosed)
+	m.observeBreaker(target, false)
+	m.observeBreaker(target, false)
+	state(BreakerOpen)
+
+	clock.Advance(time.Minute)
+	for i := range 2 {
+		if !m.admit(target) {
+			t.Fatalf("trial %d not admitted when half-open", i)
+		}
+	}
+	state(BreakerHalfOpen)
+	if m.admit(target) {
+		t.Fatal("admitted beyond the trial dials")
+	}
+
+	// closes when all the trials pass
+	m.observeBreaker(target, true)
+	state(BreakerHalfOpen)
+	m.observeBreaker(target, true)
+	state(BreakerClosed)
+	if target.Breaker.OpenedAt != nil || target.Breaker.Failures != 0 {
+		t.Fatalf("closed breaker %+v, want reset", target.Breaker)
+	}
+	if !m.admit(target) {
+		t.Fatal("closed breaker not admitting")
+	}
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	clock := newFakeClock()
+	m := NewManager([]string{"10.0.0.1:3306"}, time.Second).WithClock(clock).
+		WithBreaker(BreakerConfig{Failures: 5, Cooldown: time.Minute, HalfOpenDials: 2})
+	t.Cleanup(func() { _ = m.Close() })
+
+	m.Lock()
+	defer m.Unlock()
+
+	target := m.Targets[0]
+	for range 5 {
+		m.observeBreaker(target, false)
+	}
+	clock.Advance(time.Minute)
+	m.admit(target)
+	m.observeBreaker(target, true)
+
+	// any failed trial opens it again, below the failures of the closed breaker
+	m.admit(target)
+	m.observeBreaker(target, false)
+	if b := target.Breaker; b.State != BreakerOpen {
+		t.Fatalf("breaker %+v after a failed trial, want open", b)
+	}
+}
+
+func TestBreakerSkipsOpenTarget(t *testing.T) {
+	closed, open := listenTargets(t)
+	var lock sync.Mutex
+	dials := map[string]int{}
+	m := NewManager([]string{closed, open}, time.Second).
+		WithBreaker(BreakerConfig{Failures: 1, Cooldown: time.Minute}).
+		WithDialObserver(func(target string, _ int, _ time.Duration, _ error) {
+			lock.Lock()
+			defer lock.Unlock()
+			dials[target]++
+		})
+	t.Cleanup(func() { _ = m.Close() })
+
+	for range 3 {
+		conn, err := m.DialContext(context.Background(), "tcp", closed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.Close()
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if dials[closed] != 1 || dials[open] != 3 {
+		t.Fatalf("dials %v, want the closed target dialed once until the cooldown", dials)
+	}
+}
@@ -0,0 +1,151 @@
+// Package cdc captures the row changes of MySQL tables from the binlog, and ships them to sinks.
+package cdc
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	gomysqllog "github.com/siddontang/go-log/log"
+)
+
+// Event is a row change of a table, the rows of an update are the after images,
+// with the before images in Before.
+type Event struct {
+	Time     time.Time        `json:"time"`
+	Schema   string           `json:"schema"`
+	Table    string           `json:"table"`
+	Action   string           `json:"action"`
+	Rows     []map[string]any `json:"rows"`
+	Before   []map[string]any `json:"before,omitempty"`
+	Position string           `json:"position"`
+}
+
+// Sink receives the events, which should not block for long.
+type Sink interface {
+	Send(e *Event) error
+	Close() error
+}
+
+// Config is the config of the binlog listener.
+type Config struct {
+	User     string
+	Password string
+	// ServerID is the replica server id of the listener, unique in the replication topology.
+	ServerID uint32
+	// Tables are the regexps of schema.table to capture, like mydb\.orders, all tables if empty.
+	Tables []string
+}
+
+// Listener listens to the binlog of the current primary of the Manager.
+// With GTID mode on, it follows the new primary across failovers from where it stopped,
+// otherwise the binlog positions of the old primary mean nothing on the new one, so GTID mode is required for failovers.
+type Listener struct {
+	canal *canal.Canal
+	sinks []Sink
+	gtid  bool
+}
+
+func NewListener(c Config, m *dualconn.Manager, sinks ...Sink) (*Listener, error) {
+	handler, _ := gomysqllog.NewStreamHandler(os.Stderr)
+	cfg := canal.NewDefaultConfig()
+	// the address is ignored by the dialer of the Manager, which dials its current target
+	cfg.Addr = "dualconn:3306"
+	cfg.User, cfg.Password = c.User, c.Password
+	cfg.ServerID = c.ServerID
+	cfg.IncludeTableRegex = c.Tables
+	cfg.Dump.ExecutionPath = ""
+	cfg.MaxReconnectAttempts = 10
+	cfg.Dialer = m.DialContext
+	cfg.Logger = gomysqllog.NewDefault(handler)
+
+	cc, err := canal.NewCanal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("new canal: %w", err)
+	}
+
+	l := &Listener{canal: cc, sinks: sinks}
+	cc.SetEventHandler(&eventHandler{l: l})
+	return l, nil
+}
+
+// Run streams the events from the current position of the primary, until closed.
+func (l *Listener) Run() error {
+	if set, err := l.canal.GetMasterGTIDSet(); err == nil && set != nil && set.String() != "" {
+		l.gtid = true
+		return l.canal.StartFromGTID(set)
+	}
+
+	pos, err := l.canal.GetMasterPos()
+	if err != nil {
+		return fmt.Errorf("get master position: %w", err)
+	}
+	return l.canal.RunFrom(pos)
+}
+
+// Position returns the synced binlog position, and the GTID set in GTID mode.
+func (l *Listener) Position() (mysql.Position, string) {
+	var gtid string
+	if l.gtid {
+		if set := l.canal.SyncedGTIDSet(); set != nil {
+			gtid = set.String()
+		}
+	}
+	return l.canal.SyncedPosition(), gtid
+}
+
+func (l *Listener) Close() {
+	l.canal.Close()
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil {
+			log.Printf("close cdc sink error: %v", err)
+		}
+	}
+}
+
+type eventHandler struct {
+	canal.DummyEventHandler
+	l *Listener
+}
+
+func (h *eventHandler) OnRow(e *canal.RowsEvent) error {
+	event := &Event{
+		Time:     time.Unix(int64(e.Header.Timestamp), 0),
+		Schema:   e.Table.Schema,
+		Table:    e.Table.Name,
+		Action:   e.Action,
+		Position: fmt.Sprintf("%s:%d", h.l.canal.SyncedPosition().Name, e.Header.LogPos),
+	}
+
+	for i, row := range e.Rows {
+		m := make(map[string]any, len(row))
+		for j, v := range row {
+			if j < len(e.Table.Columns) {
+				if b, ok := v.([]byte); ok {
+					v = string(b)
+				}
+				m[e.Table.Columns[j].Name] = v
+			}
+		}
+		// the rows of an update come in pairs of before and after images
+		if e.Action == canal.UpdateAction && i%2 == 0 {
+			event.Before = append(event.Before, m)
+		} else {
+			event.Rows = append(event.Rows, m)
+		}
+	}
+
+	for _, s := range h.l.sinks {
+		if err := s.Send(event); err != nil {
+			// not failing the listener for a sink
+			log.Printf("cdc sink error: %v", err)
+		}
+	}
+	return nil
+}
+
+func (h *eventHandler) String() string { return "dualconn-cdc" }
@@ -0,0 +1,155 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Webhook posts every event as JSON to the URL, retrying with backoff.
+type Webhook struct {
+	URL     string
+	Retries int
+	client  *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Retries: 3, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *Webhook) Send(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		if err = w.post(data); err == nil || attempt >= w.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) post(data []byte) error {
+	rsp, err := w.client.Post(w.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", w.URL, rsp.Status)
+	}
+	return nil
+}
+
+func (w *Webhook) Close() error { return nil }
+
+// Kafka produces the events to the topic, keyed by schema.table to keep their order per table.
+type Kafka struct {
+	w *kafka.Writer
+}
+
+func NewKafka(brokers []string, topic string) *Kafka {
+	return &Kafka{w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+func (k *Kafka) Send(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return k.w.WriteMessages(ctx, kafka.Message{Key: []byte(e.Schema + "." + e.Table), Value: data})
+}
+
+func (k *Kafka) Close() error { return k.w.Close() }
+
+// Stream is an http.Handler streaming the events as NDJSON to its connected clients.
+// Slow clients miss the events beyond their buffers, instead of blocking the listener.
+type Stream struct {
+	Buffer int
+
+	lock    sync.Mutex
+	clients map[chan *Event]struct{}
+}
+
+func NewStream() *Stream {
+	return &Stream{Buffer: 1000, clients: map[chan *Event]struct{}{}}
+}
+
+func (s *Stream) Send(e *Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for ch := range s.clients {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *Stream) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for ch := range s.clients {
+		close(ch)
+		delete(s.clients, ch)
+	}
+	return nil
+}
+
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ch := make(chan *Event, s.Buffer)
+	s.lock.Lock()
+	s.clients[ch] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.clients, ch)
+		s.lock.Unlock()
+	}()
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			_ = rc.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
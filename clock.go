@@ -0,0 +1,74 @@
+package dualconn
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Clock is the time of the Manager, the backoffs of the retries, the intervals of the health checks and the probes,
+// the cooldowns of the breakers, the queues of the connections, the failback windows, the expiries of the DNS cache,
+// the intervals of the discovery and the events go by it, see WithClock.
+type Clock interface {
+	Now() time.Time
+	// After waits for the duration, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Rand is the randomness of the jitters of the retries and the probes, like a *rand.Rand of math/rand/v2,
+// called under the lock of the Manager, see WithRand.
+type Rand interface {
+	Float64() float64
+}
+
+// WithClock replaces the system clock, like by a fake one for the deterministic tests, set it before the dials.
+func (d *Manager) WithClock(c Clock) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.clock = c
+	return d
+}
+
+// WithRand replaces the random source of the jitters, like by a seeded one for the deterministic tests.
+func (d *Manager) WithRand(r Rand) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.rand = r
+	return d
+}
+
+// after waits for the duration by the clock.
+func (d *Manager) after(interval time.Duration) <-chan time.Time {
+	d.Lock()
+	clock := d.clock
+	d.Unlock()
+
+	return clock.After(interval)
+}
+
+// now returns the time by the clock.
+func (d *Manager) now() time.Time {
+	d.Lock()
+	clock := d.clock
+	d.Unlock()
+
+	return clock.Now()
+}
+
+// jitter randomizes the duration by the fraction, like 0.1 for ±10%, called under the lock.
+func (d *Manager) jitter(v time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return v
+	}
+	return v + time.Duration((d.rand.Float64()*2-1)*fraction*float64(v))
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type systemRand struct{}
+
+func (systemRand) Float64() float64 { return rand.Float64() }
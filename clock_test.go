@@ -0,0 +1,247 @@
+package dualconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is the Clock of the deterministic tests, its timers fire as Advance moves the time past them.
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at       time.Time
+	duration time.Duration
+	c        chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), duration: d, c: ch})
+	return ch
+}
+
+// Advance moves the time by d, firing the timers due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// awaitTimer waits for a pending timer of the duration, like the backoff of a retry.
+func (c *fakeClock) awaitTimer(t *testing.T, d time.Duration) {
+	t.Helper()
+	c.awaitTimers(t, d, 1)
+}
+
+// awaitTimers waits for n pending timers of the duration, like the intervals of the probes of n targets.
+func (c *fakeClock) awaitTimers(t *testing.T, d time.Duration, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.lock.Lock()
+		pending := 0
+		for _, timer := range c.timers {
+			if timer.duration == d {
+				pending++
+			}
+		}
+		c.lock.Unlock()
+		if pending >= n {
+			return
+		}
+	}
+	t.Fatalf("no %d timers of %s", n, d)
+}
+
+// fakeRand returns its value, like 0 for the least jitter, 0.5 for none and 1 for the most.
+type fakeRand float64
+
+func (r fakeRand) Float64() float64 { return float64(r) }
+
+func TestRetryBackoffByClock(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}
+	cases := []struct {
+		retry int
+		rand  fakeRand
+		want  time.Duration
+	}{
+		{0, 0.5, 100 * time.Millisecond},
+		{0, 0, 80 * time.Millisecond},
+		{0, 1, 120 * time.Millisecond},
+		{1, 0.5, 200 * time.Millisecond},
+		{2, 1, 480 * time.Millisecond},
+		// capped by the MaxBackoff before the jitter
+		{4, 0.5, time.Second},
+		{9, 0, 800 * time.Millisecond},
+	}
+	for _, c := range cases {
+		clock := newFakeClock()
+		m := NewManager(nil, time.Second).WithClock(clock).WithRand(c.rand)
+
+		done := make(chan error, 1)
+		go func() { done <- m.wait(context.Background(), policy, c.retry) }()
+		clock.awaitTimer(t, c.want)
+		select {
+		case err := <-done:
+			t.Fatalf("retry %d by %v: waited no backoff, %v", c.retry, c.rand, err)
+		default:
+		}
+		clock.Advance(c.want)
+		if err := <-done; err != nil {
+			t.Fatalf("retry %d by %v: %v", c.retry, c.rand, err)
+		}
+		_ = m.Close()
+	}
+}
+
+func TestRetryDialBackoffByClock(t *testing.T) {
+	closed, _ := listenTargets(t)
+	clock := newFakeClock()
+	m := NewManager([]string{closed}, time.Second).WithClock(clock).WithRand(fakeRand(1)).
+		WithRetryPolicy(RetryPolicy{Retries: 2, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.5})
+	t.Cleanup(func() { _ = m.Close() })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.DialContext(context.Background(), "tcp", closed)
+		done <- err
+	}()
+	// the rounds wait 100ms and 200ms, by the most jitter of ±50%
+	for _, backoff := range []time.Duration{150 * time.Millisecond, 300 * time.Millisecond} {
+		clock.awaitTimer(t, backoff)
+		clock.Advance(backoff)
+	}
+	if err := <-done; !errors.Is(err, ErrNotAvailable) {
+		t.Fatalf("dial: %v, want ErrNotAvailable", err)
+	}
+}
+
+func TestBreakerCooldownByClock(t *testing.T) {
+	clock := newFakeClock()
+	m := NewManager([]string{"10.0.0.1:3306"}, time.Second).WithClock(clock).
+		WithBreaker(BreakerConfig{Failures: 2, Cooldown: 10 * time.Second})
+	t.Cleanup(func() { _ = m.Close() })
+
+	m.Lock()
+	defer m.Unlock()
+
+	target := m.Targets[0]
+	m.observeBreaker(target, false)
+	m.observeBreaker(target, false)
+	if b := target.Breaker; b.State != BreakerOpen || !b.OpenedAt.Equal(clock.Now()) {
+		t.Fatalf("breaker %+v, want open now", b)
+	}
+
+	clock.Advance(10*time.Second - time.Nanosecond)
+	if m.admit(target) {
+		t.Fatal("admitted within the cooldown")
+	}
+	clock.Advance(time.Nanosecond)
+	if !m.admit(target) || target.Breaker.State != BreakerHalfOpen {
+		t.Fatalf("breaker %+v after the cooldown, want half-open admitting", target.Breaker)
+	}
+
+	// the failed trial opens it again for another cooldown from now
+	clock.Advance(time.Second)
+	m.observeBreaker(target, false)
+	if b := target.Breaker; b.State != BreakerOpen || !b.OpenedAt.Equal(clock.Now()) {
+		t.Fatalf("breaker %+v after the failed trial, want open now", b)
+	}
+	clock.Advance(9 * time.Second)
+	if m.admit(target) {
+		t.Fatal("admitted within the cooldown of the failed trial")
+	}
+}
+
+func TestFailbackDelayByClock(t *testing.T) {
+	clock := newFakeClock()
+	m := NewManager([]string{"10.0.0.1:3306", "10.0.0.2:3306"}, time.Second).WithClock(clock).
+		WithFailbackPolicy(FailbackPolicy{Delay: time.Minute})
+	t.Cleanup(func() { _ = m.Close() })
+
+	first := func() string {
+		m.Lock()
+		defer m.Unlock()
+		return m.stick(m.Targets)[0].Addr
+	}
+
+	m.Lock()
+	m.Active = "10.0.0.2:3306"
+	m.Unlock()
+	if got := first(); got != "10.0.0.2:3306" {
+		t.Fatalf("first %s before the protagonist recovers, want the active one", got)
+	}
+
+	m.Lock()
+	m.recoveredAt = clock.Now()
+	m.Unlock()
+	clock.Advance(time.Minute - time.Nanosecond)
+	if got := first(); got != "10.0.0.2:3306" {
+		t.Fatalf("first %s within the delay, want the active one", got)
+	}
+	clock.Advance(time.Nanosecond)
+	if got := first(); got != "10.0.0.1:3306" {
+		t.Fatalf("first %s after the delay, want the protagonist", got)
+	}
+}
+
+func TestDNSCacheTTLByClock(t *testing.T) {
+	clock := newFakeClock()
+	var resolutions int
+	c := &cachingDialer{
+		config:  DNSCacheConfig{TTL: 30 * time.Second, NegativeTTL: 5 * time.Second, Resolver: net.DefaultResolver},
+		observe: func(string, time.Duration, error) { resolutions++ },
+		now:     clock.Now,
+		entries: map[string]*dnsEntry{},
+	}
+
+	lookup := func() {
+		t.Helper()
+		if addrs, err := c.lookup(context.Background(), "localhost"); err != nil || len(addrs) == 0 {
+			t.Fatalf("lookup localhost: %v %v", addrs, err)
+		}
+	}
+	lookup()
+	clock.Advance(30*time.Second - time.Nanosecond)
+	lookup()
+	if resolutions != 1 {
+		t.Fatalf("%d resolutions within the TTL, want 1", resolutions)
+	}
+	clock.Advance(time.Nanosecond)
+	lookup()
+	if resolutions != 2 {
+		t.Fatalf("%d resolutions after the TTL, want 2", resolutions)
+	}
+}
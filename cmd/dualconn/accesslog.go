@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// openJSONLog opens the file of the JSON lines, rotated like the audit files and written in background,
+// nil if the file is empty.
+func openJSONLog(file string, buffer int, rotate RotateOptions) (*bufferedSink, error) {
+	if file == "" {
+		return nil, nil
+	}
+	sink, err := openFileSink(file, rotate)
+	if err != nil {
+		return nil, err
+	}
+	return newBufferedSink(file, sink, buffer), nil
+}
+
+// writeJSONLine writes v as a line of the sink.
+func writeJSONLine(s *bufferedSink, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("marshal %s record error: %v", s.name, err)
+		return
+	}
+	s.Write(data)
+}
+
+// accessRecord is a line of the access log.
+type accessRecord struct {
+	Time   time.Time `json:"time"`
+	Remote string    `json:"remote"`
+	Method string    `json:"method"`
+	// Path is without the query string, which may carry the SQL.
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Bytes  int64  `json:"bytes"`
+	Cost   string `json:"cost"`
+}
+
+// accessWriter records the status and the bytes of the response, the status is 200 unless written before.
+type accessWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (a *accessWriter) WriteHeader(status int) {
+	if !a.wroteHeader {
+		a.status, a.wroteHeader = status, true
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *accessWriter) Write(p []byte) (int, error) {
+	a.wroteHeader = true
+	n, err := a.ResponseWriter.Write(p)
+	a.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the underlying writer.
+func (a *accessWriter) Unwrap() http.ResponseWriter { return a.ResponseWriter }
+
+// logAccess writes a line of every request to the access log, with the client resolved like the IP filters.
+func logAccess(s *bufferedSink, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		aw := &accessWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(aw, r)
+
+		writeJSONLine(s, accessRecord{
+			Time:   start,
+			Remote: remoteIP(r),
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Status: aw.status,
+			Bytes:  aw.bytes,
+			Cost:   time.Since(start).String(),
+		})
+	})
+}
+
+// slowQueryRecord is a line of the slow query log.
+type slowQueryRecord struct {
+	Time  time.Time `json:"time"`
+	Query string    `json:"query"`
+	// Normalized is the query with the literals anonymized, empty if it fails to parse.
+	Normalized string `json:"normalized,omitempty"`
+	Cost       string `json:"cost"`
+	Rows       int    `json:"rows"`
+	Error      string `json:"error,omitempty"`
+}
+
+// observeSlowQueryLog writes the statements slower than slow to the slow query log.
+func observeSlowQueryLog(s *bufferedSink, slow time.Duration) {
+	db.UseQueryObserver(func(_ context.Context, query string, result *db.QueryResult, cost time.Duration) {
+		if cost < slow {
+			return
+		}
+
+		normalized, _ := db.FormatSQL(query, db.FormatOptions{Anonymize: true})
+		writeJSONLine(s, slowQueryRecord{
+			Time:       time.Now().Add(-cost),
+			Query:      query,
+			Normalized: normalized,
+			Cost:       cost.String(),
+			Rows:       result.RowCount,
+			Error:      result.Error,
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "access.log")
+	sink, err := openJSONLog(file, 16, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := logAccess(sink, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/denied" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	for _, target := range []string{"/query?q=select+secret", "/denied"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("access log %q, want 2 lines", data)
+	}
+
+	want := []accessRecord{{Method: "GET", Path: "/query", Status: 200, Bytes: 2}, {Method: "GET", Path: "/denied", Status: 403, Bytes: 10}}
+	for i, line := range lines {
+		var r accessRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if r.Method != want[i].Method || r.Path != want[i].Path || r.Status != want[i].Status || r.Bytes != want[i].Bytes {
+			t.Errorf("line %d = %+v, want %+v", i, r, want[i])
+		}
+		if strings.Contains(line, "secret") {
+			t.Errorf("line %q carries the query string", line)
+		}
+	}
+}
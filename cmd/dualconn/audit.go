@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bingoohuang/dualconn/server"
+	"go.uber.org/multierr"
+)
+
+// auditSink ships a batch of the JSON encoded audit records.
+type auditSink interface {
+	Write(batch [][]byte) error
+	Close() error
+}
+
+// AuditLog writes the audit records to the sinks, a nil AuditLog writes nothing.
+type AuditLog struct {
+	sinks []*bufferedSink
+}
+
+// openAuditLog opens the audit log sinks, each is one of:
+// a file path (rotated by the options), syslog://host:514 (RFC5424 over UDP), syslog+tcp://host:601,
+// or kafka://broker1:9092,broker2:9092/topic, which may reference secrets like ${file:...}.
+func openAuditLog(sinks []string, buffer int, rotate RotateOptions, secrets *Secrets) (*AuditLog, error) {
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	a := &AuditLog{}
+	for _, s := range sinks {
+		// named by the template, not to log the secrets
+		expanded, err := secrets.Expand(s)
+		if err != nil {
+			_ = a.Close()
+			return nil, fmt.Errorf("audit sink %s: %w", s, err)
+		}
+		sink, err := openAuditSink(expanded, rotate)
+		if err != nil {
+			_ = a.Close()
+			return nil, fmt.Errorf("audit sink %s: %w", s, err)
+		}
+		a.sinks = append(a.sinks, newBufferedSink(s, sink, buffer))
+	}
+	return a, nil
+}
+
+func openAuditSink(s string, rotate RotateOptions) (auditSink, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return openFileSink(s, rotate)
+	}
+
+	switch u.Scheme {
+	case "syslog", "syslog+udp":
+		return newSyslogSink("udp", u.Host), nil
+	case "syslog+tcp":
+		return newSyslogSink("tcp", u.Host), nil
+	case "kafka":
+		return newKafkaSink(strings.Split(u.Host, ","), strings.TrimPrefix(u.Path, "/"))
+	default:
+		return nil, fmt.Errorf("unknown audit sink scheme %s", u.Scheme)
+	}
+}
+
+func (a *AuditLog) Write(r *server.AuditRecord) {
+	if a == nil {
+		return
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("marshal audit record error: %v", err)
+		return
+	}
+
+	for _, s := range a.sinks {
+		s.Write(data)
+	}
+}
+
+// Close flushes the buffered records and closes the sinks.
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	var errs error
+	for _, s := range a.sinks {
+		errs = multierr.Append(errs, s.Close())
+	}
+	return errs
+}
+
+// bufferedSink buffers the records in memory, and ships them in batches in background,
+// retrying with backoff on failures. Records are dropped when the buffer is full, or after it is closed.
+type bufferedSink struct {
+	name    string
+	sink    auditSink
+	ch      chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+
+	// lock guards the sends to ch against its close
+	lock   sync.RWMutex
+	closed bool
+}
+
+const (
+	auditBatchSize  = 100
+	auditMaxRetries = 5
+)
+
+func newBufferedSink(name string, sink auditSink, size int) *bufferedSink {
+	b := &bufferedSink{
+		name: name,
+		sink: sink,
+		ch:   make(chan []byte, max(size, 1)),
+		done: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *bufferedSink) Write(data []byte) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	if b.closed {
+		b.dropped.Add(1)
+		return
+	}
+	select {
+	case b.ch <- data:
+	default:
+		if n := b.dropped.Add(1); n == 1 || n%1000 == 0 {
+			log.Printf("audit sink %s buffer full, %d records dropped", b.name, n)
+		}
+	}
+}
+
+func (b *bufferedSink) run() {
+	defer close(b.done)
+
+	for data := range b.ch {
+		batch := [][]byte{data}
+	collect:
+		for len(batch) < auditBatchSize {
+			select {
+			case data, ok := <-b.ch:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, data)
+			default:
+				break collect
+			}
+		}
+
+		b.ship(batch)
+	}
+}
+
+func (b *bufferedSink) ship(batch [][]byte) {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := b.sink.Write(batch)
+		if err == nil {
+			return
+		}
+		if attempt == auditMaxRetries {
+			log.Printf("audit sink %s error, %d records dropped: %v", b.name, len(batch), err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (b *bufferedSink) Close() error {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.ch)
+	b.lock.Unlock()
+
+	<-b.done
+	return b.sink.Close()
+}
+
+type fileSink struct {
+	f *rotateFile
+}
+
+func openFileSink(file string, rotate RotateOptions) (*fileSink, error) {
+	f, err := openRotateFile(file, rotate)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (s *fileSink) Write(batch [][]byte) error {
+	var buf bytes.Buffer
+	for _, data := range batch {
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	_, err := s.f.Write(buf.Bytes())
+	return err
+}
+
+func (s *fileSink) Close() error { return s.f.Close() }
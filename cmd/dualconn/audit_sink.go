@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// syslogSink sends the records in RFC5424, with the octet counting framing of RFC6587 over TCP.
+type syslogSink struct {
+	network, addr string
+	hostname      string
+	conn          net.Conn
+}
+
+// the PRI of facility local0 and severity informational
+const syslogPri = 16*8 + 6
+
+func newSyslogSink(network, addr string) *syslogSink {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{network: network, addr: addr, hostname: hostname}
+}
+
+func (s *syslogSink) Write(batch [][]byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, 3*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	_ = s.conn.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	for i, data := range batch {
+		msg := fmt.Sprintf("<%d>1 %s %s dualconn %d audit - %s",
+			syslogPri, time.Now().Format(time.RFC3339Nano), s.hostname, os.Getpid(), data)
+		if s.network == "tcp" {
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+		if _, err := s.conn.Write([]byte(msg)); err != nil {
+			// reconnect on the next write
+			_ = s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("write syslog after %d records: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// kafkaSink produces the records to a Kafka topic.
+type kafkaSink struct {
+	w *kafka.Writer
+}
+
+func newKafkaSink(brokers []string, topic string) (*kafkaSink, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("kafka topic required, like kafka://broker:9092/topic")
+	}
+
+	return &kafkaSink{w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		BatchTimeout: 10 * time.Millisecond,
+		// retried by the buffered sink
+		MaxAttempts:  1,
+		RequiredAcks: kafka.RequireOne,
+	}}, nil
+}
+
+func (s *kafkaSink) Write(batch [][]byte) error {
+	msgs := make([]kafka.Message, len(batch))
+	for i, data := range batch {
+		msgs[i] = kafka.Message{Value: data}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.w.WriteMessages(ctx, msgs...)
+}
+
+func (s *kafkaSink) Close() error { return s.w.Close() }
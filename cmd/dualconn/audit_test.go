@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// memorySink keeps the records shipped.
+type memorySink struct {
+	lock    sync.Mutex
+	records [][]byte
+}
+
+func (m *memorySink) Write(batch [][]byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.records = append(m.records, batch...)
+	return nil
+}
+
+func (m *memorySink) Close() error { return nil }
+
+func TestBufferedSinkWriteAfterClose(t *testing.T) {
+	sink := &memorySink{}
+	b := newBufferedSink("memory", sink, 16)
+
+	// the writes racing the close are either shipped or dropped, never sent on the closed buffer
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				b.Write([]byte("record"))
+			}
+		}()
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	b.Write([]byte("late"))
+	if err := b.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if shipped, dropped := len(sink.records), b.dropped.Load(); shipped+int(dropped) != 401 {
+		t.Fatalf("%d records shipped and %d dropped, want all the 401 accounted", shipped, dropped)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bingoohuang/dualconn/cdc"
+)
+
+// startCDC starts the binlog listener, streaming the events to the sinks and /cdc in NDJSON.
+func startCDC(secrets *Secrets) (*cdc.Listener, error) {
+	password, err := secrets.Expand(*cdcPassword)
+	if err != nil {
+		return nil, fmt.Errorf("cdc password: %w", err)
+	}
+
+	webhooks, err := secrets.ExpandAll(*cdcWebhooks)
+	if err != nil {
+		return nil, fmt.Errorf("cdc webhook: %w", err)
+	}
+	kafka, err := secrets.Expand(*cdcKafka)
+	if err != nil {
+		return nil, fmt.Errorf("cdc kafka: %w", err)
+	}
+
+	stream := cdc.NewStream()
+	sinks := []cdc.Sink{stream}
+	for _, w := range webhooks {
+		sinks = append(sinks, cdc.NewWebhook(w))
+	}
+	if kafka != "" {
+		u, err := url.Parse(kafka)
+		if err != nil || u.Scheme != "kafka" || strings.Trim(u.Path, "/") == "" {
+			// the template, not to log the secrets
+			return nil, fmt.Errorf("invalid cdc kafka %s, expect kafka://broker:9092/topic", *cdcKafka)
+		}
+		sinks = append(sinks, cdc.NewKafka(strings.Split(u.Host, ","), strings.Trim(u.Path, "/")))
+	}
+
+	listener, err := cdc.NewListener(cdc.Config{
+		User:     *cdcUser,
+		Password: password,
+		ServerID: *cdcServerID,
+		Tables:   *cdcTables,
+	}, mgr, sinks...)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := listener.Run(); err != nil {
+			log.Printf("cdc listener stopped: %v", err)
+		}
+	}()
+
+	http.Handle("/cdc", stream)
+	return listener, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/xo/dburl"
+	"go.uber.org/multierr"
+)
+
+// CheckDBs are the databases to run the application-level checks (like the smoke test) of the targets by,
+// with the check credentials of the target, or the global ones, instead of the ones of the application DSN.
+type CheckDBs struct {
+	base    *url.URL
+	global  *url.Userinfo
+	targets map[string]*url.Userinfo
+
+	lock sync.Mutex
+	dbs  map[string]*sql.DB
+}
+
+// openCheckDBs parses the check credentials, like user:password or target=user:password,
+// which may reference secrets like ${file:...}.
+func openCheckDBs(secrets *Secrets, dsn string, credentials []string) (*CheckDBs, error) {
+	dsn, err := secrets.Expand(dsn)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse check dsn: %w", err)
+	}
+
+	c := &CheckDBs{base: base, targets: map[string]*url.Userinfo{}, dbs: map[string]*sql.DB{}}
+	for _, cred := range credentials {
+		target, userPass, ok := strings.Cut(cred, "=")
+		if !ok {
+			target, userPass = "", cred
+		}
+		if userPass, err = secrets.Expand(userPass); err != nil {
+			return nil, fmt.Errorf("check credential of %q: %w", target, err)
+		}
+		user, password, _ := strings.Cut(userPass, ":")
+		if target == "" {
+			c.global = url.UserPassword(user, password)
+		} else {
+			c.targets[target] = url.UserPassword(user, password)
+		}
+	}
+	return c, nil
+}
+
+// DB returns the database to check the target by, without idle connections to reuse,
+// the dials of which should be pinned to the target.
+func (c *CheckDBs) DB(target string) (*sql.DB, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if sdb, ok := c.dbs[target]; ok {
+		return sdb, nil
+	}
+
+	u := *c.base
+	if user, ok := c.targets[target]; ok {
+		u.User = user
+	} else if c.global != nil {
+		u.User = c.global
+	}
+	sdb, err := dburl.Open(u.String())
+	if err != nil {
+		return nil, err
+	}
+	sdb.SetMaxIdleConns(0)
+	c.dbs[target] = sdb
+	return sdb, nil
+}
+
+func (c *CheckDBs) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var errs error
+	for _, sdb := range c.dbs {
+		errs = multierr.Append(errs, sdb.Close())
+	}
+	return errs
+}
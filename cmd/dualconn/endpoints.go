@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// endpointGroups are the groups of the endpoints which can be disabled together,
+// import has no endpoints yet.
+var endpointGroups = map[string][]string{
+	"query":  {"/query", "/watch", "/diff", "/checksum", "/profile", "/format", "/tables/"},
+	"export": {"/cdc"},
+	"import": nil,
+	"admin":  {"/enable", "/targets", "/failback", "/dsn", "/maintenance", "/handoff"},
+	"debug":  {"/info", "/pool", "/haproxy", "/status.num", "/suggestions", "/metrics", "/targets/", "/stats/"},
+}
+
+// disabledPaths returns the paths of the disabled groups, by the flag and the config.
+func disabledPaths(flagGroups []string, configGroups map[string]bool) (map[string]bool, error) {
+	disabled := map[string]bool{}
+	for _, g := range flagGroups {
+		disabled[g] = true
+	}
+	for g, enabled := range configGroups {
+		disabled[g] = disabled[g] || !enabled
+	}
+
+	paths := map[string]bool{}
+	for g, off := range disabled {
+		group, ok := endpointGroups[g]
+		if !ok {
+			return nil, fmt.Errorf("unknown endpoint group %s, available: %v", g, groupNames())
+		}
+		for _, p := range group {
+			paths[p] = off
+		}
+	}
+	return paths, nil
+}
+
+func groupNames() []string {
+	names := make([]string, 0, len(endpointGroups))
+	for name := range endpointGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gateEndpoints serves 404 for the disabled paths, as if they were never registered.
+func gateEndpoints(disabled map[string]bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matchPath(disabled, r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
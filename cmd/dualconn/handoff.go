@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+)
+
+// The environment variables of the new process in the handoff, the listener is the inherited fd 3,
+// the new process writes a byte to the inherited fd 4 when it is ready to serve,
+// and the listener of the proxy mode is the inherited fd 5 if any.
+const (
+	handoffListenEnv = "DUALCONN_HANDOFF_LISTENER"
+	handoffProxyEnv  = "DUALCONN_HANDOFF_PROXY"
+	handoffStateEnv  = "DUALCONN_HANDOFF_STATE"
+)
+
+// handoffState is the health knowledge of the targets passed to the new process.
+type handoffState struct {
+	Active  string          `json:"active,omitempty"`
+	Targets []handoffTarget `json:"targets"`
+}
+
+type handoffTarget struct {
+	Addr     string `json:"addr"`
+	Disabled bool   `json:"disabled,omitempty"`
+	LastErr  string `json:"lastErr,omitempty"`
+}
+
+// listenOrInherit listens on the address, or takes over the listener inherited from the old process,
+// the returned ready is to be signaled by signalReady when serving.
+func listenOrInherit(addr string) (ln net.Listener, ready *os.File, err error) {
+	if os.Getenv(handoffListenEnv) == "" {
+		ln, err = net.Listen("tcp", addr)
+		return ln, nil, err
+	}
+
+	f := os.NewFile(3, "listener")
+	defer f.Close()
+
+	if ln, err = net.FileListener(f); err != nil {
+		return nil, nil, fmt.Errorf("inherited listener: %w", err)
+	}
+	return ln, os.NewFile(4, "ready"), nil
+}
+
+// listenProxyOrInherit listens on the address of the proxy mode, or takes over the proxy listener
+// inherited from the old process.
+func listenProxyOrInherit(addr string) (net.Listener, error) {
+	if os.Getenv(handoffProxyEnv) == "" {
+		return net.Listen("tcp", addr)
+	}
+
+	f := os.NewFile(5, "proxy listener")
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherited proxy listener: %w", err)
+	}
+	return ln, nil
+}
+
+func signalReady(ready *os.File) {
+	if ready == nil {
+		return
+	}
+	if _, err := ready.Write([]byte{1}); err != nil {
+		log.Printf("signal handoff ready error: %v", err)
+	}
+	_ = ready.Close()
+}
+
+// restoreHandoffState restores the health of the targets from the old process.
+func restoreHandoffState(m *dualconn.Manager) {
+	v := os.Getenv(handoffStateEnv)
+	if v == "" {
+		return
+	}
+
+	var s handoffState
+	if err := json.Unmarshal([]byte(v), &s); err != nil {
+		log.Printf("restore handoff state error: %v", err)
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, t := range m.Targets {
+		for _, st := range s.Targets {
+			if t.Addr == st.Addr {
+				t.SetDisabled(st.Disabled)
+				t.LastErr = st.LastErr
+			}
+		}
+		// the active one passed the smoke test already
+		if t.Addr == s.Active {
+			m.Active = s.Active
+		}
+	}
+}
+
+func snapshotHandoffState(m *dualconn.Manager) handoffState {
+	m.Lock()
+	defer m.Unlock()
+
+	s := handoffState{Active: m.Active}
+	for _, t := range m.Targets {
+		s.Targets = append(s.Targets, handoffTarget{Addr: t.Addr, Disabled: t.Disabled, LastErr: t.LastErr})
+	}
+	return s
+}
+
+// Handoff upgrades the binary without downtime, by POST /handoff after the binary is replaced:
+// it starts the new binary with the listeners and the health of the targets,
+// and shuts down the current process gracefully once the new one is serving.
+type Handoff struct {
+	ln net.Listener
+	// proxy is the listener of the proxy mode, nil if off
+	proxy  net.Listener
+	server *http.Server
+	m      *dualconn.Manager
+	// ReadyTimeout is the max wait of the new process to be ready.
+	ReadyTimeout time.Duration
+	// ShutdownTimeout is the max wait of the in-flight requests, like the long watches, before closing them.
+	ShutdownTimeout time.Duration
+
+	lock sync.Mutex
+	done bool
+}
+
+func (h *Handoff) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST to hand off", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.done {
+		http.Error(w, "handed off already", http.StatusConflict)
+		return
+	}
+
+	pid, err := h.start()
+	if err != nil {
+		log.Printf("handoff error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	h.done = true
+	log.Printf("handed off to process %d by %s, shutting down", pid, remoteIP(r))
+	_ = json.NewEncoder(w).Encode(map[string]int{"pid": pid})
+
+	go func() {
+		// the new process accepts the proxied connections from now on, the ones in flight are drained at the exit
+		if h.proxy != nil {
+			_ = h.proxy.Close()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), h.ShutdownTimeout)
+		defer cancel()
+		if err := h.server.Shutdown(ctx); err != nil {
+			_ = h.server.Close()
+		}
+	}()
+}
+
+// start starts the new process and waits for it to be ready.
+func (h *Handoff) start() (int, error) {
+	lf, err := listenerFile(h.ln)
+	if err != nil {
+		return 0, err
+	}
+	defer lf.Close()
+	env := []string{handoffListenEnv + "=1"}
+	extra := []*os.File{lf, nil}
+	if h.proxy != nil {
+		pf, err := listenerFile(h.proxy)
+		if err != nil {
+			return 0, err
+		}
+		defer pf.Close()
+		env = append(env, handoffProxyEnv+"=1")
+		extra = append(extra, pf)
+	}
+
+	state, err := json.Marshal(snapshotHandoffState(h.m))
+	if err != nil {
+		return 0, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer pr.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(append(os.Environ(), env...), handoffStateEnv+"="+string(state))
+	extra[1] = pw
+	cmd.ExtraFiles = extra
+	err = cmd.Start()
+	_ = pw.Close()
+	if err != nil {
+		return 0, fmt.Errorf("start %s: %w", exe, err)
+	}
+	// reaps the new process if it exits before the current one
+	go func() { _ = cmd.Wait() }()
+
+	_ = pr.SetReadDeadline(time.Now().Add(h.ReadyTimeout))
+	if _, err := pr.Read(make([]byte, 1)); err != nil {
+		_ = cmd.Process.Kill()
+		return 0, fmt.Errorf("wait for process %d ready: %w", cmd.Process.Pid, err)
+	}
+	return cmd.Process.Pid, nil
+}
+
+// listenerFile returns the dup of the fd of the TCP listener, to be inherited by the new process.
+func listenerFile(ln net.Listener) (*os.File, error) {
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("listener %T can not be handed off", ln)
+	}
+	return tl.File()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+)
+
+var handoffTargets = []string{"127.0.0.1:3301", "127.0.0.1:3302"}
+
+func TestMain(m *testing.M) {
+	// the test binary started by the handoff serves as the new process
+	if os.Getenv(handoffListenEnv) != "" {
+		serveHandoff()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// serveHandoff takes over the listeners, serving the handoff state restored on the HTTP one,
+// and "new" on the proxy one, until killed or 10s later.
+func serveHandoff() {
+	ln, ready, err := listenOrInherit("")
+	if err != nil {
+		log.Fatalf("inherit listener error: %v", err)
+	}
+	proxy, err := listenProxyOrInherit("")
+	if err != nil {
+		log.Fatalf("inherit proxy listener error: %v", err)
+	}
+
+	m := dualconn.NewManager(handoffTargets, time.Second)
+	restoreHandoffState(m)
+	state, _ := json.Marshal(snapshotHandoffState(m))
+
+	go func() {
+		for {
+			c, err := proxy.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = c.Write([]byte("new"))
+			_ = c.Close()
+		}
+	}()
+	time.AfterFunc(10*time.Second, func() { os.Exit(0) })
+	signalReady(ready)
+	_ = http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(state) }))
+}
+
+func TestHandoff(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("old")) })}
+	go func() { _ = server.Serve(ln) }()
+
+	m := dualconn.NewManager(handoffTargets, time.Second)
+	m.Lock()
+	m.Targets[0].SetDisabled(true)
+	m.Active = handoffTargets[1]
+	m.Unlock()
+
+	h := &Handoff{ln: ln, proxy: proxy, server: server, m: m, ReadyTimeout: 10 * time.Second, ShutdownTimeout: time.Second}
+	if w := handoff(h, http.MethodGet); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /handoff status %d, want 405", w.Code)
+	}
+
+	w := handoff(h, http.MethodPost)
+	var started struct {
+		Pid int `json:"pid"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &started); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("POST /handoff status %d: %s", w.Code, w.Body)
+	}
+	t.Cleanup(func() {
+		if p, err := os.FindProcess(started.Pid); err == nil {
+			_ = p.Kill()
+		}
+	})
+	if w := handoff(h, http.MethodPost); w.Code != http.StatusConflict {
+		t.Fatalf("second POST /handoff status %d, want 409", w.Code)
+	}
+
+	// the new process serves on the same addresses once the old one shuts down
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: time.Second}
+	body := waitFor(t, func() (string, error) {
+		rsp, err := client.Get("http://" + ln.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer rsp.Body.Close()
+		data, err := io.ReadAll(rsp.Body)
+		return string(data), err
+	})
+	var state handoffState
+	if err := json.Unmarshal([]byte(body), &state); err != nil {
+		t.Fatalf("state of the new process %q: %v", body, err)
+	}
+	if state.Active != handoffTargets[1] || len(state.Targets) != 2 || !state.Targets[0].Disabled || state.Targets[1].Disabled {
+		t.Fatalf("state of the new process %+v, want the active and the disabled targets handed off", state)
+	}
+
+	waitFor(t, func() (string, error) {
+		c, err := net.DialTimeout("tcp", proxy.Addr().String(), time.Second)
+		if err != nil {
+			return "", err
+		}
+		defer c.Close()
+		data, err := io.ReadAll(c)
+		return string(data), err
+	})
+}
+
+func handoff(h *Handoff, method string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, "/handoff", nil))
+	return w
+}
+
+// waitFor retries the get until it returns something other than the old process, in 5s.
+func waitFor(t *testing.T, get func() (string, error)) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v, err := get()
+		if err == nil && v != "" && v != "old" {
+			return v
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("new process not serving: %q, %v", v, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
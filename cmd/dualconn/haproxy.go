@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+)
+
+// haproxyFields are the fields of the HAProxy stats CSV (the 1.5 layout),
+// the scrapers built for HAProxy locate the fields by their positions.
+var haproxyFields = []string{
+	"pxname", "svname", "qcur", "qmax", "scur", "smax", "slim", "stot", "bin", "bout",
+	"dreq", "dresp", "ereq", "econ", "eresp", "wretr", "wredis", "status", "weight", "act",
+	"bck", "chkfail", "chkdown", "lastchg", "downtime", "qlimit", "pid", "iid", "sid", "throttle",
+	"lbtot", "tracked", "type", "rate", "rate_lim", "rate_max", "check_status", "check_code", "check_duration", "hrsp_1xx",
+	"hrsp_2xx", "hrsp_3xx", "hrsp_4xx", "hrsp_5xx", "hrsp_other", "hanafail", "req_rate", "req_rate_max", "req_tot", "cli_abrt",
+	"srv_abrt", "comp_in", "comp_out", "comp_byp", "comp_rsp", "lastsess", "last_chk", "last_agt", "qtime", "ctime",
+	"rtime", "ttime",
+}
+
+// dialCounts counts the dials of the targets, as the totals of the status page.
+type dialCounts struct {
+	lock   sync.Mutex
+	dials  map[string]int64
+	errors map[string]int64
+	cost   map[string]time.Duration
+}
+
+func newDialCounts() *dialCounts {
+	return &dialCounts{dials: map[string]int64{}, errors: map[string]int64{}, cost: map[string]time.Duration{}}
+}
+
+// Observe is a dualconn.DialObserver.
+func (c *dialCounts) Observe(target string, _ int, cost time.Duration, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err != nil {
+		c.errors[target]++
+		return
+	}
+	c.dials[target]++
+	c.cost[target] = cost
+}
+
+type haproxyRow map[string]string
+
+func (r haproxyRow) record() []string {
+	record := make([]string, len(haproxyFields)+1) // the trailing comma like HAProxy
+	for i, f := range haproxyFields {
+		record[i] = r[f]
+	}
+	return record
+}
+
+// handleHAProxyStats serves the status of the targets like the HAProxy stats CSV,
+// e.g. /haproxy?stats;csv, the targets are the servers of the dualconn backend,
+// the first is the active one and the others are the backups.
+func handleHAProxyStats(m *dualconn.Manager, counts *dialCounts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeHAProxyStats(w, m, counts)
+	}
+}
+
+func writeHAProxyStats(w io.Writer, m *dualconn.Manager, counts *dialCounts) {
+	pid := strconv.Itoa(os.Getpid())
+	backend := haproxyRow{"pxname": "dualconn", "svname": "BACKEND", "pid": pid, "iid": "1", "sid": "0", "type": "1", "status": "DOWN"}
+	var rows []haproxyRow
+	var scur, stot, econ, bin, bout, act, bck int64
+	// the bytes by the counters the connections update without the lock
+	traffic := map[string]dualconn.TargetStats{}
+	for _, s := range m.Stats() {
+		traffic[s.Addr] = s
+	}
+
+	counts.lock.Lock()
+	m.Lock()
+	for i, t := range m.Targets {
+		var cur int64
+		for _, c := range t.Conns {
+			if !c.Closed {
+				cur++
+			}
+		}
+		readN, writeN := traffic[t.Addr].BytesRead, traffic[t.Addr].BytesWritten
+
+		status := "UP"
+		switch {
+		case t.Disabled:
+			status = "MAINT"
+		case t.LastErr != "":
+			status = "DOWN"
+		}
+
+		row := haproxyRow{
+			"pxname": "dualconn", "svname": t.Addr, "pid": pid, "iid": "1", "sid": strconv.Itoa(i + 1), "type": "2",
+			"scur": itoa(cur), "stot": itoa(counts.dials[t.Addr]), "lbtot": itoa(counts.dials[t.Addr]),
+			"bin": itoa(readN), "bout": itoa(writeN), "econ": itoa(counts.errors[t.Addr]),
+			"status": status, "weight": "1", "act": "1", "bck": "0",
+			"ctime": strconv.FormatInt(counts.cost[t.Addr].Milliseconds(), 10),
+		}
+		if i > 0 {
+			row["act"], row["bck"] = "0", "1"
+		}
+		if t.DialTime != nil {
+			row["lastsess"] = itoa(int64(time.Since(*t.DialTime).Seconds()))
+		}
+		if s := t.Smoke; s != nil {
+			row["check_status"], row["last_chk"] = "L7OK", "smoke test passed"
+			if !s.Passed {
+				row["check_status"], row["last_chk"] = "L7STS", s.Error
+			}
+			if cost, err := time.ParseDuration(s.Cost); err == nil {
+				row["check_duration"] = itoa(cost.Milliseconds())
+			}
+		}
+
+		if status == "UP" {
+			backend["status"] = "UP"
+			if i == 0 {
+				act++
+			} else {
+				bck++
+			}
+		}
+		scur, stot, econ = scur+cur, stot+counts.dials[t.Addr], econ+counts.errors[t.Addr]
+		bin, bout = bin+readN, bout+writeN
+		rows = append(rows, row)
+	}
+	m.Unlock()
+	counts.lock.Unlock()
+
+	backend["scur"], backend["stot"], backend["lbtot"], backend["econ"] = itoa(scur), itoa(stot), itoa(stot), itoa(econ)
+	backend["bin"], backend["bout"] = itoa(bin), itoa(bout)
+	backend["act"], backend["bck"], backend["weight"] = itoa(act), itoa(bck), itoa(act+bck)
+	rows = append(rows, backend)
+
+	header := append([]string{}, haproxyFields...)
+	header[0] = "# " + header[0]
+	cw := csv.NewWriter(w)
+	_ = cw.Write(append(header, ""))
+	for _, row := range rows {
+		_ = cw.Write(row.record())
+	}
+	cw.Flush()
+}
+
+func itoa(v int64) string { return strconv.FormatInt(v, 10) }
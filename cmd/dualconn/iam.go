@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/xo/dburl"
+)
+
+// tokenRenewMargin renews the IAM tokens this long before they expire,
+// which exceeds the max lifetime of the connections, so that no connection outlives its token.
+const tokenRenewMargin = 5 * time.Minute
+
+// isTokenRef tells whether the secret reference is an IAM token, which is short-lived.
+func isTokenRef(ref string) bool {
+	return strings.HasPrefix(ref, "rds-iam:") || ref == "cloudsql-iam"
+}
+
+// iamToken generates the IAM token of the reference, URL-escaped to be the password of a DSN:
+// rds-iam:user@host:port for the AWS RDS IAM authentication token (valid in 15 minutes),
+// or cloudsql-iam for the GCP access token of the instance service account.
+func iamToken(ref string) (token string, expires time.Time, err error) {
+	if ref == "cloudsql-iam" {
+		token, expires, err = cloudSQLToken()
+	} else {
+		user, endpoint, ok := strings.Cut(strings.TrimPrefix(ref, "rds-iam:"), "@")
+		if !ok {
+			return "", time.Time{}, fmt.Errorf("secret %s: expect rds-iam:user@host:port", ref)
+		}
+		var c *awsCredentials
+		if c, err = awsCredentialsFromEnv(); err == nil {
+			now := time.Now()
+			token, expires = c.rdsAuthToken(endpoint, user, now), now.Add(15*time.Minute)
+		}
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("secret %s: %w", ref, err)
+	}
+	return url.QueryEscape(token), expires, nil
+}
+
+// rdsAuthToken generates the RDS IAM authentication token, which is a presigned connect URL without the scheme.
+func (c *awsCredentials) rdsAuthToken(endpoint, user string, now time.Time) string {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	q := url.Values{
+		"Action":              {"connect"},
+		"DBUser":              {user},
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {c.AccessKey + "/" + amzDate[:8] + "/" + c.Region + "/rds-db/aws4_request"},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {"900"},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if c.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	query := strings.ReplaceAll(q.Encode(), "+", "%20")
+
+	canonical := "GET\n/\n" + query + "\nhost:" + endpoint + "\n\nhost\n" + sha256Hex(nil)
+	_, signature := c.signature(amzDate, "rds-db", canonical)
+	return endpoint + "/?" + query + "&X-Amz-Signature=" + signature
+}
+
+// cloudSQLToken fetches the access token of the service account from the GCP metadata server.
+func cloudSQLToken() (string, time.Time, error) {
+	req, err := http.NewRequest(http.MethodGet,
+		"http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	rsp, err := secretHTTPClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("gcp metadata token: %s", rsp.Status)
+	}
+
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&t); err != nil {
+		return "", time.Time{}, err
+	}
+	return t.AccessToken, time.Now().Add(time.Duration(t.ExpiresIn) * time.Second), nil
+}
+
+// tokenConnector resolves the DSN at every new connection, so that the connections
+// are always authenticated by a valid IAM token, without reopening the sql.DB.
+type tokenConnector struct {
+	template string
+	secrets  *Secrets
+	driver   driver.Driver
+}
+
+func (c *tokenConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	expanded, err := c.secrets.Expand(c.template)
+	if err != nil {
+		return nil, err
+	}
+	u, err := dburl.Parse(expanded)
+	if err != nil {
+		return nil, err
+	}
+
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(u.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(u.DSN)
+}
+
+func (c *tokenConnector) Driver() driver.Driver { return c.driver }
+
+// openTokenDB opens the database whose DSN references IAM tokens.
+func openTokenDB(template string, s *Secrets) (*sql.DB, error) {
+	expanded, err := s.Expand(template)
+	if err != nil {
+		return nil, err
+	}
+	u, err := dburl.Parse(expanded)
+	if err != nil {
+		return nil, err
+	}
+
+	// get the registered driver by name, sql.Open does not connect
+	probe, err := sql.Open(cmp.Or(u.GoDriver, u.Driver), "")
+	if err != nil {
+		return nil, err
+	}
+	drv := probe.Driver()
+	_ = probe.Close()
+
+	return sql.OpenDB(&tokenConnector{template: template, secrets: s, driver: drv}), nil
+}
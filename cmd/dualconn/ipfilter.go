@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPFilter filters the clients by CIDRs, the deny list wins, an empty allow list allows all.
+type IPFilter struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+func newIPFilter(allow, deny []string) (*IPFilter, error) {
+	f := &IPFilter{}
+	var err error
+	if f.Allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if f.Deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parsePrefixes parses the CIDRs, a bare IP is taken as a single address prefix.
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, c := range cidrs {
+		for _, s := range strings.Split(c, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			if !strings.Contains(s, "/") {
+				addr, err := netip.ParseAddr(s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid CIDR %s: %w", s, err)
+				}
+				prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				continue
+			}
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %s: %w", s, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+		}
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *IPFilter) Allowed(addr netip.Addr) bool {
+	if f == nil {
+		return true
+	}
+	if containsAddr(f.Deny, addr) {
+		return false
+	}
+	return len(f.Allow) == 0 || containsAddr(f.Allow, addr)
+}
+
+// ClientIP resolves the client IP of the request, X-Forwarded-For is trusted only
+// when the peer is one of the trusted proxies, then the rightmost untrusted address is the client.
+type ClientIP struct {
+	TrustedProxies []netip.Prefix
+}
+
+func (c *ClientIP) Resolve(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid remote address %s: %w", r.RemoteAddr, err)
+	}
+	addr = addr.Unmap()
+
+	if c == nil || !containsAddr(c.TrustedProxies, addr) {
+		return addr, nil
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// a malformed hop can not be trusted further
+			return addr, nil
+		}
+		addr = hop.Unmap()
+		if !containsAddr(c.TrustedProxies, addr) {
+			return addr, nil
+		}
+	}
+	return addr, nil
+}
+
+// queryPaths are the endpoints serving data, guarded by the query filter.
+var queryPaths = map[string]bool{"/query": true, "/watch": true, "/cdc": true, "/diff": true, "/checksum": true, "/profile": true, "/format": true, "/tables/": true}
+
+// matchPath tells whether the path is in the paths, where the ones ending with / match the paths under them.
+func matchPath(paths map[string]bool, path string) bool {
+	if paths[path] {
+		return true
+	}
+	for p, ok := range paths {
+		if ok && strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterIP guards the handler by the filters, the query paths by the query one, and the others by the admin one.
+func filterIP(resolver *ClientIP, query, admin *IPFilter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter := admin
+		if matchPath(queryPaths, r.URL.Path) {
+			filter = query
+		}
+
+		addr, err := resolver.Resolve(r)
+		if err != nil || !filter.Allowed(addr) {
+			log.Printf("forbidden client %s (remote %s) to %s", addr, r.RemoteAddr, r.URL.Path)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
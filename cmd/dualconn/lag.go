@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+)
+
+// errReplicationLag is the error of the probes of the replicas lagging behind too much.
+var errReplicationLag = errors.New("replication lag")
+
+// replicationLagProbe probes the targets by the replica status, failing the replicas lagging behind more than maxLag
+// or with the replication stopped, the targets not replicas pass it by the query alone.
+func replicationLagProbe(checks *CheckDBs, maxLag time.Duration) dualconn.Probe {
+	return func(ctx context.Context, target string) error {
+		sdb, err := checks.DB(target)
+		if err != nil {
+			return err
+		}
+		// the probe dials a new connection, which is pinned to the target by ctx
+		lag, replica, err := replicationLag(dualconn.WithTarget(ctx, target), sdb)
+		switch {
+		case err != nil:
+			return err
+		case replica && lag > maxLag:
+			log.Printf("replica %s lags behind by %s, more than %s", target, lag, maxLag)
+			return fmt.Errorf("%w %s of %s", errReplicationLag, lag, target)
+		}
+		return nil
+	}
+}
+
+// replicationLag returns the lag of the replica by SHOW REPLICA STATUS, or SHOW SLAVE STATUS before MySQL 8.0.22,
+// replica is false for the primaries without the replica status.
+func replicationLag(ctx context.Context, sdb *sql.DB) (lag time.Duration, replica bool, err error) {
+	rows, err := sdb.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		if rows, err = sdb.QueryContext(ctx, "SHOW SLAVE STATUS"); err != nil {
+			return 0, false, err
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, false, err
+	}
+	if !rows.Next() {
+		return 0, false, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, true, err
+	}
+
+	for i, c := range columns {
+		if c != "Seconds_Behind_Source" && c != "Seconds_Behind_Master" {
+			continue
+		}
+		// NULL when the replication threads are stopped
+		if !values[i].Valid {
+			return 0, true, fmt.Errorf("%w: replication stopped", errReplicationLag)
+		}
+		seconds, err := strconv.ParseInt(values[i].String, 10, 64)
+		return time.Duration(seconds) * time.Second, true, err
+	}
+	return 0, true, errors.New("no Seconds_Behind_Source in the replica status")
+}
+
+// observeReplicationLag fires the replication lag alerts of the replicas turning down by lagging behind.
+func observeReplicationLag(m *dualconn.Manager, a *Alerter) {
+	m.OnEvent(func(e dualconn.Event) {
+		if e.Kind == dualconn.EventDown && errors.Is(e.Err, errReplicationLag) {
+			a.Fire(AlertReplicationLag, e.Target, fmt.Sprintf("replica %s skipped, %v", e.Target, e.Err))
+		}
+	})
+}
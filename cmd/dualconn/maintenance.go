@@ -0,0 +1,91 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// MaintenanceConfig is the state of the maintenance mode.
+type MaintenanceConfig struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	// AllowAdmin lets the queries tagged by admin=1 (or the X-Admin: 1 header) through,
+	// from the clients allowed to the admin endpoints.
+	AllowAdmin bool `json:"allowAdmin,omitempty"`
+}
+
+// Maintenance is the switch of the planned database maintenance, the queries are rejected with 503 and the message,
+// while the admin endpoints like /info and /enable keep working.
+type Maintenance struct {
+	lock   sync.RWMutex
+	config MaintenanceConfig
+}
+
+const defaultMaintenanceMessage = "database under maintenance"
+
+func newMaintenance(c MaintenanceConfig) *Maintenance {
+	return &Maintenance{config: c}
+}
+
+func (m *Maintenance) state() MaintenanceConfig {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	s := m.config
+	s.Message = cmp.Or(s.Message, defaultMaintenanceMessage)
+	return s
+}
+
+// guard rejects the query requests under maintenance, except the admin ones when allowed.
+func (m *Maintenance) guard(admin *IPFilter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := m.state()
+		if !s.Enabled || !matchPath(queryPaths, r.URL.Path) || s.AllowAdmin && isAdminQuery(r, admin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": s.Message, "maintenance": true})
+	})
+}
+
+func isAdminQuery(r *http.Request, admin *IPFilter) bool {
+	if r.URL.Query().Get("admin") != "1" && r.Header.Get("X-Admin") != "1" {
+		return false
+	}
+	addr, err := clientIP.Resolve(r)
+	return err == nil && admin.Allowed(addr)
+}
+
+// ServeHTTP shows the maintenance state, and switches it by /maintenance?enabled=1&message=...&allowAdmin=1.
+func (m *Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if v := q.Get("enabled"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "enabled: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		m.lock.Lock()
+		m.config.Enabled = enabled
+		if q.Has("message") {
+			m.config.Message = q.Get("message")
+		}
+		if v := q.Get("allowAdmin"); v != "" {
+			m.config.AllowAdmin, _ = strconv.ParseBool(v)
+		}
+		m.lock.Unlock()
+		log.Printf("maintenance enabled=%t by %s", enabled, remoteIP(r))
+	}
+
+	s := m.state()
+	_ = json.NewEncoder(w).Encode(&s)
+}
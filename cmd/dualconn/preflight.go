@@ -0,0 +1,168 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+	"go.uber.org/multierr"
+)
+
+// PreflightCheck is a check of the preflight, the subject is the checked target or database.
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject,omitempty"`
+	Passed  bool   `json:"passed"`
+	Cost    string `json:"cost"`
+	Detail  string `json:"detail,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PreflightReport is the report of the preflight, passed when all the checks pass,
+// except the unreachable targets while at least one is reachable.
+type PreflightReport struct {
+	Time   time.Time        `json:"time"`
+	Passed bool             `json:"passed"`
+	Checks []PreflightCheck `json:"checks"`
+}
+
+func (p *PreflightReport) check(name, subject string, f func() (string, error)) error {
+	start := time.Now()
+	detail, err := f()
+	c := PreflightCheck{Name: name, Subject: subject, Passed: err == nil, Cost: time.Since(start).String(), Detail: detail}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	p.Checks = append(p.Checks, c)
+	return err
+}
+
+// Print writes the report in indented JSON.
+func (p *PreflightReport) Print(w io.Writer) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(p)
+}
+
+// preflight validates the flags and config, resolves and dials the targets,
+// and pings the databases, which are opened already.
+func preflight(ctx context.Context, m *dualconn.Manager, timeout time.Duration) *PreflightReport {
+	p := &PreflightReport{Time: time.Now(), Passed: true}
+	fail := func(err error) {
+		if err != nil {
+			p.Passed = false
+		}
+	}
+
+	fail(p.check("config", "", validateConfig))
+
+	reachable := 0
+	for _, t := range m.Targets {
+		if p.check("resolve", t.Addr, func() (string, error) { return resolveTarget(ctx, t.Addr) }) != nil {
+			p.Passed = false
+			continue
+		}
+		if p.check("reach", t.Addr, func() (string, error) { return dialTarget(ctx, m, t.Addr, timeout) }) == nil {
+			reachable++
+		}
+	}
+	fail(p.check("targets", "", func() (string, error) {
+		if reachable == 0 {
+			return "", fmt.Errorf("none of the %d targets is reachable", len(m.Targets))
+		}
+		return fmt.Sprintf("%d/%d reachable", reachable, len(m.Targets)), nil
+	}))
+
+	for _, name := range cfg.Names() {
+		d := cfg.Databases[name]
+		fail(p.check("database", name, func() (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			sdb, _ := d.Handle()
+			return "", sdb.PingContext(ctx)
+		}))
+	}
+
+	return p
+}
+
+// validateConfig validates the flags and config which are parsed later at serving.
+func validateConfig() (string, error) {
+	var errs error
+	if len(cfg.Databases) == 0 {
+		errs = multierr.Append(errs, fmt.Errorf("no databases configured"))
+	}
+	if err := cfg.Server.Apply(&http.Server{}); err != nil {
+		errs = multierr.Append(errs, err)
+	}
+	if _, err := parseSize(*logMaxSize); err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("log-max-size: %w", err))
+	}
+	for _, cidrs := range [][]string{*allowCIDRs, *denyCIDRs, *adminAllowCIDRs, *adminDenyCIDRs, *trustedProxies} {
+		if _, err := parsePrefixes(cidrs); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+	if _, err := disabledPaths(*disableEndpoints, cfg.Endpoints); err != nil {
+		errs = multierr.Append(errs, err)
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		errs = multierr.Append(errs, fmt.Errorf("tls-cert and tls-key must be given together"))
+	}
+	return fmt.Sprintf("%d databases", len(cfg.Databases)), errs
+}
+
+// resolveTarget resolves the host of the target, the unix sockets and the ones behind the proxies are not resolved.
+func resolveTarget(ctx context.Context, addr string) (string, error) {
+	u, err := dualconn.ParseTarget(addr)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case u.Network == "unix":
+		return u.Address, nil
+	case u.Proxy != nil:
+		return "resolved by proxy " + u.Proxy.Redacted(), nil
+	}
+	host, _, err := net.SplitHostPort(u.Address)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(ips), nil
+}
+
+// dialTarget dials the endpoint of the target directly by the dialer of the Manager, bypassing the failover,
+// or the proxy in front of it.
+func dialTarget(ctx context.Context, m *dualconn.Manager, addr string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	u, err := dualconn.ParseTarget(addr)
+	if err != nil {
+		return "", err
+	}
+	network, address := cmp.Or(u.Network, "tcp"), u.Address
+	if u.Proxy != nil {
+		address = u.Proxy.Host
+	}
+	conn, err := m.Dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.RemoteAddr().String(), nil
+}
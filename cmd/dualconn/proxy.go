@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bingoohuang/dualconn"
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// logProxyConn logs the connection relayed by the proxy, with the original client address.
+func logProxyConn(c dualconn.ProxyConn) {
+	via := ""
+	if c.Proxied {
+		via = " (by PROXY protocol)"
+	}
+	if c.User != "" {
+		via += " user " + c.User
+	}
+	if c.Held > 0 {
+		via += fmt.Sprintf(" held %s", c.Held)
+	}
+	log.Printf("proxy client %s%s to target %s, received %d sent %d bytes in %s, closed by %s, error: %v",
+		c.Client, via, c.Target, c.Received, c.Sent, c.Cost, c.Closed, c.Err)
+}
+
+// logProxyQuery logs the fingerprint of the query relayed by the MySQL-aware proxy, the literals anonymized,
+// or the first words of it if it fails to parse.
+func logProxyQuery(q dualconn.ProxyQuery) {
+	fingerprint, err := db.FormatSQL(q.Query, db.FormatOptions{Anonymize: true})
+	if err != nil {
+		fingerprint = q.Query
+		if len(fingerprint) > 64 {
+			fingerprint = fingerprint[:64] + "..."
+		}
+	}
+	log.Printf("proxy client %s user %s query on target %s: %s", q.Client, q.User, q.Target, fingerprint)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// RotateOptions is the rotation and retention of the file sinks.
+type RotateOptions struct {
+	// MaxSize rotates the file when it would exceed the bytes, 0 to disable.
+	MaxSize int64
+	// Interval rotates the file at every boundary of the interval, like 24h, 0 to disable.
+	Interval time.Duration
+	// Compress gzips the rotated files.
+	Compress bool
+	// MaxBackups is the max number of rotated files to keep, 0 to keep all.
+	MaxBackups int
+	// MaxAge removes the rotated files older than it, 0 to keep all.
+	MaxAge time.Duration
+}
+
+// rotateSuffix is the time layout of the suffix of the rotated files, sortable.
+const rotateSuffix = "2006-01-02T15-04-05.000"
+
+// rotateFile is a file writer rotated by size and time, like file.2024-03-28T12-04-03.832(.gz).
+type rotateFile struct {
+	path string
+	RotateOptions
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotateFile(path string, o RotateOptions) (*rotateFile, error) {
+	r := &rotateFile{path: path, RotateOptions: o}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotateFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	r.f, r.size, r.opened = f, stat.Size(), time.Now()
+	if r.size > 0 {
+		// the existing content belongs to the period of its last modification
+		r.opened = stat.ModTime()
+	}
+	return nil
+}
+
+func (r *rotateFile) Write(p []byte) (int, error) {
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotateFile) shouldRotate(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.MaxSize > 0 && r.size+n > r.MaxSize {
+		return true
+	}
+	return r.Interval > 0 && !time.Now().Truncate(r.Interval).Equal(r.opened.Truncate(r.Interval))
+}
+
+func (r *rotateFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	rotated := r.path + "." + time.Now().Format(rotateSuffix)
+	if err := os.Rename(r.path, rotated); err != nil {
+		return multierr.Append(err, r.open())
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.Compress {
+		if err := gzipFile(rotated); err != nil {
+			log.Printf("compress %s error: %v", rotated, err)
+		}
+	}
+	r.removeExpired()
+	return nil
+}
+
+func gzipFile(file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(file+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	w := gzip.NewWriter(dst)
+	if _, err := io.Copy(w, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// removeExpired removes the rotated files beyond MaxBackups or older than MaxAge.
+func (r *rotateFile) removeExpired() {
+	if r.MaxBackups <= 0 && r.MaxAge <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+
+	var backups []string
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, r.path+"."), ".gz")
+		if _, err := time.Parse(rotateSuffix, suffix); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, b := range backups {
+		expired := r.MaxBackups > 0 && i >= r.MaxBackups
+		if !expired && r.MaxAge > 0 {
+			if stat, err := os.Stat(b); err == nil && time.Since(stat.ModTime()) > r.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(b); err != nil {
+				log.Printf("remove %s error: %v", b, err)
+			}
+		}
+	}
+}
+
+func (r *rotateFile) Close() error { return r.f.Close() }
+
+// parseSize parses the size like 100MB, 1G or 1024.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		bytes  int64
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}} {
+		if num, ok := strings.CutSuffix(upper, u.suffix); ok {
+			upper, unit = strings.TrimSpace(num), u.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+	"github.com/go-sql-driver/mysql"
+	"github.com/xo/dburl"
+)
+
+// replicaNetwork is the network of the MySQL connections dialing the replica targets.
+const replicaNetwork = "replica"
+
+// newReplicaManager balances the dials of the replica network across the replica targets.
+func newReplicaManager(targets []string) *dualconn.Manager {
+	m := dualconn.NewManager(targets, 3*time.Second).WithStrategy(dualconn.RoundRobin())
+	mysql.RegisterDialContext(replicaNetwork, func(ctx context.Context, addr string) (net.Conn, error) {
+		return m.DialContext(ctx, "tcp", addr)
+	})
+	return m
+}
+
+// openReplicaDB opens the MySQL DSN on the replica network, for the reads split from the primary.
+func openReplicaDB(dsn string) (*sql.DB, error) {
+	u, err := dburl.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Driver != "mysql" {
+		return nil, fmt.Errorf("read/write split supports MySQL only, not %s", u.Driver)
+	}
+	c, err := mysql.ParseDSN(u.DSN)
+	if err != nil {
+		return nil, err
+	}
+	c.Net = replicaNetwork
+	connector, err := mysql.NewConnector(c)
+	if err != nil {
+		return nil, err
+	}
+
+	sdb := sql.OpenDB(connector)
+	setPoolSettings(sdb)
+	return sdb, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+	"github.com/bingoohuang/dualconn/server"
+)
+
+// writeStatusFile writes the health in JSON to the file periodically, until the context is done.
+// The file is replaced by renaming, so the tailing agents never read a partial one.
+func writeStatusFile(ctx context.Context, m *dualconn.Manager, file string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := replaceFile(file, server.HealthOf(m)); err != nil {
+			log.Printf("write status file %s error: %v", file, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func replaceFile(file string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// readable by the agents, unlike the 0600 of the temp files
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// handleNumericStatus serves the health as numeric lines of name and value, like targets.up 1,
+// for the SNMP agents (like the extend of net-snmp) and the scripts, the targets are numbered from 1.
+func handleNumericStatus(m *dualconn.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeNumericStatus(w, server.HealthOf(m))
+	}
+}
+
+func writeNumericStatus(w io.Writer, h *server.Health) {
+	active := 0
+	for i, t := range h.Targets {
+		if t.Active {
+			active = i + 1
+		}
+	}
+
+	fmt.Fprintf(w, "targets.total %d\n", len(h.Targets))
+	fmt.Fprintf(w, "targets.up %d\n", h.Up)
+	fmt.Fprintf(w, "targets.active %d\n", active)
+	for i, t := range h.Targets {
+		fmt.Fprintf(w, "target.%d.up %d\n", i+1, boolInt(t.Up))
+		fmt.Fprintf(w, "target.%d.active %d\n", i+1, boolInt(t.Active))
+		fmt.Fprintf(w, "target.%d.disabled %d\n", i+1, boolInt(t.Disabled))
+		fmt.Fprintf(w, "target.%d.conns %d\n", i+1, t.Conns)
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
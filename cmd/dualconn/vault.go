@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var secretHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// vaultLease is a secret read from Vault, with the lease of a dynamic credential, like database/creds/app,
+// which is renewed at the half of its duration while in use, and revoked once the databases using it are swapped out.
+// The static secrets, like the KV ones, have no lease ID and are read again at every expansion.
+type vaultLease struct {
+	path   string
+	fields map[string]string
+
+	// id, duration, expires and renewable are of the lease, refs are the databases using it, under the lock of Secrets.
+	id        string
+	duration  time.Duration
+	expires   time.Time
+	renewable bool
+	refs      int
+	revoked   bool
+}
+
+// vaultResponse is the response of the reads and the lease operations of Vault.
+type vaultResponse struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int            `json:"lease_duration"`
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+}
+
+// vaultRequest requests the path of HashiCorp Vault, addressed by VAULT_ADDR
+// and authenticated by VAULT_TOKEN (and VAULT_NAMESPACE), the body is sent in JSON if not nil.
+func vaultRequest(method, path string, body any) (*vaultResponse, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN required")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	url := strings.TrimSuffix(addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	rsp, err := secretHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK && rsp.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("vault %s: %s", rsp.Status, data)
+	}
+
+	var result vaultResponse
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+// vaultSecret reads the secret at the path from HashiCorp Vault, like database/creds/app
+// of the database secrets engine, or secret/data/app of the KV v2 engine.
+func vaultSecret(path string) (*vaultLease, error) {
+	result, err := vaultRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// KV v2 nests the secret in data.data
+	if inner, ok := result.Data["data"].(map[string]any); ok && result.Data["metadata"] != nil {
+		result.Data = inner
+	}
+	l := &vaultLease{path: path, fields: stringFields(result.Data), id: result.LeaseID, renewable: result.Renewable}
+	l.extend(result.LeaseDuration)
+	return l, nil
+}
+
+// extend sets the duration of the lease, in seconds, from now.
+func (l *vaultLease) extend(seconds int) {
+	l.duration = time.Duration(seconds) * time.Second
+	l.expires = time.Now().Add(l.duration)
+}
+
+// stale tells whether the lease is too close to its expiry to be used by a new database, called under the lock.
+func (l *vaultLease) stale() bool {
+	return time.Until(l.expires) < l.duration/3
+}
+
+// vaultSecret returns the secret at the path, the current lease of a dynamic credential is taken again
+// until it is stale, that is when it is no more renewable, so that the refreshes rotate it only then.
+func (s *Secrets) vaultSecret(path string) (*vaultLease, error) {
+	s.lock.Lock()
+	if l := s.leases[path]; l != nil && !l.stale() {
+		l.refs++
+		s.lock.Unlock()
+		return l, nil
+	}
+	s.lock.Unlock()
+
+	// read unlocked, not to block the other expansions and the IAM dials for the time of the request
+	l, err := vaultSecret(path)
+	if err != nil || l.id == "" {
+		return l, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the lease read meanwhile by another expansion is taken, the one just read left unused expires by itself
+	if current := s.leases[path]; current != nil && !current.stale() {
+		current.refs++
+		return current, nil
+	}
+	// the previous lease left unused expires by itself, the used ones are revoked by ReleaseLeases
+	if s.leases == nil {
+		s.leases = map[string]*vaultLease{}
+	}
+	s.leases[path], l.refs = l, 1
+	if l.renewable && l.duration > 0 {
+		time.AfterFunc(l.duration/2, func() { s.renewLease(l) })
+	}
+	return l, nil
+}
+
+// renewLease renews the lease while it is in use or current, at the half of its duration.
+func (s *Secrets) renewLease(l *vaultLease) {
+	s.lock.Lock()
+	if l.revoked || l.refs <= 0 && s.leases[l.path] != l {
+		s.lock.Unlock()
+		return
+	}
+	id, increment := l.id, int(l.duration/time.Second)
+	s.lock.Unlock()
+
+	result, err := vaultRequest(http.MethodPut, "sys/leases/renew", map[string]any{"lease_id": id, "increment": increment})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if l.revoked {
+		return
+	}
+	if err != nil {
+		log.Printf("renew vault lease %s error: %v", id, err)
+		if time.Until(l.expires) > time.Minute {
+			time.AfterFunc(time.Minute, func() { s.renewLease(l) })
+		}
+		return
+	}
+
+	// the duration is capped by the max TTL, down to 0, when the credential has to be rotated by the refreshes
+	l.renewable = result.Renewable
+	l.extend(result.LeaseDuration)
+	if l.renewable && l.duration > 0 {
+		time.AfterFunc(l.duration/2, func() { s.renewLease(l) })
+	}
+}
+
+// ReleaseLeases releases the leases taken by ExpandLeases, the ones no more in use and rotated out are revoked,
+// so the database drops their users at once rather than at their expiry.
+func (s *Secrets) ReleaseLeases(leases []*vaultLease) {
+	s.lock.Lock()
+	var revoked []*vaultLease
+	for _, l := range leases {
+		if l.refs--; l.refs <= 0 && s.leases[l.path] != l && !l.revoked {
+			l.revoked = true
+			revoked = append(revoked, l)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, l := range revoked {
+		if _, err := vaultRequest(http.MethodPut, "sys/leases/revoke", map[string]string{"lease_id": l.id}); err != nil {
+			log.Printf("revoke vault lease %s error: %v", l.id, err)
+		}
+	}
+}
+
+// remoteSecret fetches the field of the remote secret, ref is like path#field,
+// the fetched secrets are cached in the fetched, so that the fields of a dynamic credential are consistent.
+func (s *Secrets) remoteSecret(kind, ref string, fetched *fetchedSecrets) (string, error) {
+	path, field, _ := strings.Cut(ref, "#")
+	field = cmp.Or(field, "value")
+
+	key := kind + ":" + path
+	fields, ok := fetched.fields[key]
+	if !ok {
+		var err error
+		switch kind {
+		case "vault":
+			var l *vaultLease
+			if l, err = s.vaultSecret(path); err == nil {
+				fields = l.fields
+				if l.id != "" {
+					fetched.leases = append(fetched.leases, l)
+				}
+			}
+		case "aws-sm":
+			fields, err = awsSecret(path)
+		}
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", key, err)
+		}
+		fetched.fields[key] = fields
+	}
+
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s: no field %s", key, field)
+	}
+	return value, nil
+}
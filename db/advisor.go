@@ -0,0 +1,321 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+	"github.com/xwb1989/sqlparser/dependency/querypb"
+)
+
+// IndexSuggestion is a candidate index on a table scanned fully by the slow queries.
+type IndexSuggestion struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	DDL     string   `json:"ddl"`
+	// Queries are the fingerprints of the slow queries which the index helps.
+	Queries []string `json:"queries"`
+	// Count is the times of the slow queries captured.
+	Count int `json:"count"`
+	// MaxCost is the max cost of the slow queries.
+	MaxCost string `json:"maxCost"`
+}
+
+// Advisor captures the slow selects by UseQueryObserver(advisor.Observe), and suggests the indexes for them
+// by their predicates and their plans.
+type Advisor struct {
+	slow time.Duration
+	max  int
+
+	lock    sync.Mutex
+	queries map[string]*slowQuery
+}
+
+type slowQuery struct {
+	sample  string
+	count   int
+	maxCost time.Duration
+}
+
+// NewAdvisor creates an Advisor capturing the selects slower than slow, up to size distinct ones (100 by default).
+func NewAdvisor(slow time.Duration, size int) *Advisor {
+	if size <= 0 {
+		size = 100
+	}
+	return &Advisor{slow: slow, max: size, queries: map[string]*slowQuery{}}
+}
+
+// Observe is the QueryObserver capturing the slow selects.
+func (a *Advisor) Observe(_ context.Context, query string, result *QueryResult, cost time.Duration) {
+	if cost < a.slow || result.Error != "" {
+		return
+	}
+	fingerprint, ok := selectFingerprint(query)
+	if !ok {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	q := a.queries[fingerprint]
+	if q == nil {
+		if len(a.queries) >= a.max {
+			return
+		}
+		q = &slowQuery{}
+		a.queries[fingerprint] = q
+	}
+	q.sample = query
+	q.count++
+	q.maxCost = max(q.maxCost, cost)
+}
+
+// selectFingerprint normalizes the literals of a select, to group the same queries.
+func selectFingerprint(query string) (string, bool) {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return "", false
+	}
+	if _, ok := stmt.(*sqlparser.Select); !ok {
+		return "", false
+	}
+	sqlparser.Normalize(stmt, map[string]*querypb.BindVariable{}, "v")
+	return sqlparser.String(stmt), true
+}
+
+// Suggest explains the captured slow queries on the database, and suggests the indexes on the tables they scan fully:
+// the columns compared by equality (including the join conditions) first, then the first one by range,
+// or the order by columns without a range. The queries failing to explain, like on the other databases, are skipped.
+func (a *Advisor) Suggest(ctx context.Context, db Queryer) []IndexSuggestion {
+	a.lock.Lock()
+	queries := make(map[string]slowQuery, len(a.queries))
+	for fingerprint, q := range a.queries {
+		queries[fingerprint] = *q
+	}
+	a.lock.Unlock()
+
+	dialect := OptionsFrom(ctx).dialect(db)
+	suggestions := map[string]*IndexSuggestion{}
+	for fingerprint, q := range queries {
+		plan, _, err := Explain(ctx, db, dialect, q.sample, nil)
+		if err != nil {
+			reportError(ctx, fmt.Errorf("explain slow query %s: %w", fingerprint, err))
+			continue
+		}
+
+		candidates := indexCandidates(q.sample)
+		for _, alias := range fullScans(dialect, plan) {
+			c := candidates[alias]
+			if c == nil || len(c.columns()) == 0 {
+				continue
+			}
+
+			columns := c.columns()
+			key := c.table + "(" + strings.Join(columns, ",") + ")"
+			s := suggestions[key]
+			if s == nil {
+				s = &IndexSuggestion{Table: c.table, Columns: columns, DDL: indexDDL(c.table, columns)}
+				suggestions[key] = s
+			}
+			s.Queries = append(s.Queries, fingerprint)
+			s.Count += q.count
+			if cost, _ := time.ParseDuration(s.MaxCost); q.maxCost > cost {
+				s.MaxCost = q.maxCost.String()
+			}
+		}
+	}
+
+	result := make([]IndexSuggestion, 0, len(suggestions))
+	for _, s := range suggestions {
+		sort.Strings(s.Queries)
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].DDL < result[j].DDL
+	})
+	return result
+}
+
+func indexDDL(table string, columns []string) string {
+	return fmt.Sprintf("CREATE INDEX idx_%s_%s ON %s (%s)",
+		table, strings.Join(columns, "_"), table, strings.Join(columns, ", "))
+}
+
+// fullScans returns the aliases (or the names) of the tables scanned fully in the plan.
+func fullScans(dialect Dialect, plan []map[string]any) (aliases []string) {
+	if dialect == DialectPostgres {
+		for _, node := range plan {
+			aliases = append(aliases, seqScans(node)...)
+		}
+		return aliases
+	}
+
+	for _, row := range plan {
+		if strings.EqualFold(fmt.Sprint(row["type"]), "ALL") {
+			aliases = append(aliases, fmt.Sprint(row["table"]))
+		}
+	}
+	return aliases
+}
+
+func seqScans(node map[string]any) (aliases []string) {
+	if node["Node Type"] == "Seq Scan" {
+		if alias, ok := node["Alias"].(string); ok {
+			aliases = append(aliases, alias)
+		}
+	}
+	children, _ := node["Plans"].([]any)
+	for _, c := range children {
+		if child, ok := c.(map[string]any); ok {
+			aliases = append(aliases, seqScans(child)...)
+		}
+	}
+	return aliases
+}
+
+// indexCandidate is the columns of a table in the predicates of a select.
+type indexCandidate struct {
+	table               string
+	equal, rang, orders []string
+}
+
+func (c *indexCandidate) columns() []string {
+	columns := append([]string(nil), c.equal...)
+	switch {
+	case len(c.rang) > 0:
+		columns = appendUnique(columns, c.rang[0])
+	default:
+		for _, o := range c.orders {
+			columns = appendUnique(columns, o)
+		}
+	}
+	return columns
+}
+
+func appendUnique(columns []string, column string) []string {
+	for _, c := range columns {
+		if c == column {
+			return columns
+		}
+	}
+	return append(columns, column)
+}
+
+// indexCandidates extracts the columns in the predicates of the select by the aliases of the tables.
+func indexCandidates(query string) map[string]*indexCandidate {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return nil
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil
+	}
+
+	candidates := map[string]*indexCandidate{}
+	var conditions []sqlparser.Expr
+	var collectTables func(sqlparser.TableExprs)
+	collectTables = func(exprs sqlparser.TableExprs) {
+		for _, expr := range exprs {
+			switch t := expr.(type) {
+			case *sqlparser.AliasedTableExpr:
+				name := sqlparser.GetTableName(t.Expr).String()
+				if name == "" {
+					continue
+				}
+				alias := name
+				if !t.As.IsEmpty() {
+					alias = t.As.String()
+				}
+				candidates[alias] = &indexCandidate{table: name}
+			case *sqlparser.JoinTableExpr:
+				collectTables(sqlparser.TableExprs{t.LeftExpr, t.RightExpr})
+				if t.Condition.On != nil {
+					conditions = append(conditions, t.Condition.On)
+				}
+			case *sqlparser.ParenTableExpr:
+				collectTables(t.Exprs)
+			}
+		}
+	}
+	collectTables(sel.From)
+	if sel.Where != nil {
+		conditions = append(conditions, sel.Where.Expr)
+	}
+
+	// the candidate of a column, by its qualifier or the only table
+	candidate := func(col *sqlparser.ColName) (*indexCandidate, string) {
+		if q := col.Qualifier.Name.String(); q != "" {
+			return candidates[q], col.Name.String()
+		}
+		if len(candidates) == 1 {
+			for _, c := range candidates {
+				return c, col.Name.String()
+			}
+		}
+		return nil, ""
+	}
+
+	var visit func(sqlparser.Expr)
+	visit = func(expr sqlparser.Expr) {
+		switch e := expr.(type) {
+		case *sqlparser.AndExpr:
+			visit(e.Left)
+			visit(e.Right)
+		case *sqlparser.ParenExpr:
+			visit(e.Expr)
+		case *sqlparser.ComparisonExpr:
+			left, leftOK := e.Left.(*sqlparser.ColName)
+			right, rightOK := e.Right.(*sqlparser.ColName)
+			for _, col := range []*sqlparser.ColName{left, right} {
+				if col == nil {
+					continue
+				}
+				c, name := candidate(col)
+				if c == nil {
+					continue
+				}
+				switch e.Operator {
+				case sqlparser.EqualStr, sqlparser.NullSafeEqualStr, sqlparser.InStr:
+					c.equal = appendUnique(c.equal, name)
+				case sqlparser.LessThanStr, sqlparser.GreaterThanStr, sqlparser.LessEqualStr, sqlparser.GreaterEqualStr:
+					// a range between the columns of two tables is not indexable by either
+					if !(leftOK && rightOK) {
+						c.rang = appendUnique(c.rang, name)
+					}
+				case sqlparser.LikeStr:
+					if v, ok := e.Right.(*sqlparser.SQLVal); ok && !strings.HasPrefix(string(v.Val), "%") {
+						c.rang = appendUnique(c.rang, name)
+					}
+				}
+			}
+		case *sqlparser.RangeCond:
+			if col, ok := e.Left.(*sqlparser.ColName); ok && e.Operator == sqlparser.BetweenStr {
+				if c, name := candidate(col); c != nil {
+					c.rang = appendUnique(c.rang, name)
+				}
+			}
+		}
+		// OR and the others are not indexable by a single composite index
+	}
+	for _, cond := range conditions {
+		visit(cond)
+	}
+
+	for _, o := range sel.OrderBy {
+		if col, ok := o.Expr.(*sqlparser.ColName); ok {
+			if c, name := candidate(col); c != nil {
+				c.orders = append(c.orders, name)
+			}
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,240 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter is a condition on a column of the browsed rows, parsed from col:op:value.
+// The ops are eq, ne, lt, le, gt, ge, like, in (values separated by commas), null and notnull (without value).
+type Filter struct {
+	Column string
+	Op     string
+	Value  string
+}
+
+var filterOps = map[string]string{
+	"eq": "=", "ne": "<>", "lt": "<", "le": "<=", "gt": ">", "ge": ">=", "like": "LIKE",
+	"in": "IN", "null": "IS NULL", "notnull": "IS NOT NULL",
+}
+
+// ParseFilter parses the filter in the form of col:op:value.
+func ParseFilter(s string) (Filter, error) {
+	column, rest, _ := strings.Cut(s, ":")
+	op, value, _ := strings.Cut(rest, ":")
+	if _, ok := filterOps[op]; !ok {
+		return Filter{}, fmt.Errorf("unknown op %q of filter %q", op, s)
+	}
+	return Filter{Column: column, Op: op, Value: value}, nil
+}
+
+// Browse selects the rows of a table, generating the SQL with the identifiers validated and quoted,
+// and the values as args.
+type Browse struct {
+	Table   string
+	Columns []string
+	Filters []Filter
+	// Order are the columns to order by, the ones prefixed by - are descending.
+	Order  []string
+	Limit  int
+	Offset int
+}
+
+// SQL generates the select and its args in the dialect.
+func (b *Browse) SQL(dialect Dialect) (string, []any, error) {
+	table, err := quoteIdent(dialect, b.Table)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns := "*"
+	if len(b.Columns) > 0 {
+		quoted := make([]string, len(b.Columns))
+		for i, c := range b.Columns {
+			if quoted[i], err = quoteIdent(dialect, c); err != nil {
+				return "", nil, err
+			}
+		}
+		columns = strings.Join(quoted, ", ")
+	}
+
+	var sb strings.Builder
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return placeholder(dialect, len(args))
+	}
+
+	sb.WriteString("SELECT " + columns + " FROM " + table)
+	for i, f := range b.Filters {
+		column, err := quoteIdent(dialect, f.Column)
+		if err != nil {
+			return "", nil, err
+		}
+		op, ok := filterOps[f.Op]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown filter op %q", f.Op)
+		}
+
+		if i == 0 {
+			sb.WriteString(" WHERE ")
+		} else {
+			sb.WriteString(" AND ")
+		}
+		switch f.Op {
+		case "null", "notnull":
+			sb.WriteString(column + " " + op)
+		case "in":
+			values := strings.Split(f.Value, ",")
+			placeholders := make([]string, len(values))
+			for j, v := range values {
+				placeholders[j] = arg(v)
+			}
+			sb.WriteString(column + " IN (" + strings.Join(placeholders, ", ") + ")")
+		default:
+			sb.WriteString(column + " " + op + " " + arg(f.Value))
+		}
+	}
+
+	for i, o := range b.Order {
+		direction := ""
+		if strings.HasPrefix(o, "-") {
+			o, direction = o[1:], " DESC"
+		}
+		column, err := quoteIdent(dialect, o)
+		if err != nil {
+			return "", nil, err
+		}
+		if i == 0 {
+			sb.WriteString(" ORDER BY ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(column + direction)
+	}
+
+	if b.Limit > 0 {
+		sb.WriteString(" LIMIT " + strconv.Itoa(b.Limit))
+	}
+	if b.Offset > 0 {
+		sb.WriteString(" OFFSET " + strconv.Itoa(b.Offset))
+	}
+	return sb.String(), args, nil
+}
+
+// quoteIdent quotes the identifier, which may be qualified like schema.table, rejecting the unsafe ones.
+func quoteIdent(dialect Dialect, ident string) (string, error) {
+	if ident == "" {
+		return "", fmt.Errorf("empty identifier")
+	}
+
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		if p == "" || strings.IndexFunc(p, func(r rune) bool { return r > 0x7f || !isIdentChar(byte(r)) }) >= 0 {
+			return "", fmt.Errorf("invalid identifier %q", ident)
+		}
+		if dialect == DialectPostgres {
+			parts[i] = `"` + p + `"`
+		} else {
+			parts[i] = "`" + p + "`"
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// Row is a single row of a table by its primary key, for the statements on it.
+type Row struct {
+	Table string
+	// Key are the primary key columns, and KeyValues their values in order.
+	Key       []string
+	KeyValues []string
+}
+
+// Select generates the select of the row.
+func (r *Row) Select(dialect Dialect) (string, []any, error) {
+	if len(r.Key) == 0 || len(r.Key) != len(r.KeyValues) {
+		return "", nil, fmt.Errorf("%d values for the key %v", len(r.KeyValues), r.Key)
+	}
+
+	b := &Browse{Table: r.Table, Limit: 1}
+	for i, k := range r.Key {
+		b.Filters = append(b.Filters, Filter{Column: k, Op: "eq", Value: r.KeyValues[i]})
+	}
+	return b.SQL(dialect)
+}
+
+// Update generates the update of the columns of the row.
+func (r *Row) Update(dialect Dialect, values map[string]any) (string, []any, error) {
+	if len(values) == 0 {
+		return "", nil, fmt.Errorf("no columns to update")
+	}
+	table, err := quoteIdent(dialect, r.Table)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns := make([]string, 0, len(values))
+	for c := range values {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+
+	sets := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, c := range columns {
+		column, err := quoteIdent(dialect, c)
+		if err != nil {
+			return "", nil, err
+		}
+		sets[i] = column + " = " + placeholder(dialect, i+1)
+		args[i] = values[c]
+	}
+	// the placeholders of the key follow the ones of the sets
+	where, keyArgs, err := r.whereFrom(dialect, len(columns)+1)
+	if err != nil {
+		return "", nil, err
+	}
+	return "UPDATE " + table + " SET " + strings.Join(sets, ", ") + where, append(args, keyArgs...), nil
+}
+
+// Delete generates the delete of the row.
+func (r *Row) Delete(dialect Dialect) (string, []any, error) {
+	table, err := quoteIdent(dialect, r.Table)
+	if err != nil {
+		return "", nil, err
+	}
+	where, args, err := r.whereFrom(dialect, 1)
+	if err != nil {
+		return "", nil, err
+	}
+	return "DELETE FROM " + table + where, args, nil
+}
+
+// whereFrom generates the condition on the key, the placeholders numbered from start.
+func (r *Row) whereFrom(dialect Dialect, start int) (string, []any, error) {
+	if len(r.Key) == 0 || len(r.Key) != len(r.KeyValues) {
+		return "", nil, fmt.Errorf("%d values for the key %v", len(r.KeyValues), r.Key)
+	}
+
+	conditions := make([]string, len(r.Key))
+	args := make([]any, len(r.Key))
+	for i, k := range r.Key {
+		column, err := quoteIdent(dialect, k)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions[i] = column + " = " + placeholder(dialect, start+i)
+		args[i] = r.KeyValues[i]
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// placeholder is the nth (from 1) placeholder of the args in the dialect.
+func placeholder(dialect Dialect, n int) string {
+	if dialect == DialectPostgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
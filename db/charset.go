@@ -0,0 +1,58 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Base64Value is emitted for text which can not be transcoded to UTF-8, when Options.InvalidTextAsBase64 is set.
+type Base64Value struct {
+	Base64 string `json:"base64"`
+}
+
+func (b Base64Value) String() string { return "base64:" + b.Base64 }
+
+var errInvalidText = errors.New("invalid text")
+
+// text transcodes the text which is not valid UTF-8 from the source charset,
+// and quotes it if required.
+func (o *Options) text(s string, quoted bool) any {
+	if !utf8.ValidString(s) {
+		decoded, err := o.transcode(s)
+		if err == nil {
+			s = decoded
+		} else if o != nil && o.InvalidTextAsBase64 {
+			return Base64Value{Base64: base64.StdEncoding.EncodeToString([]byte(s))}
+		}
+	}
+
+	if quoted {
+		return Quote(s)
+	}
+	return s
+}
+
+func (o *Options) transcode(s string) (string, error) {
+	if o == nil || o.Charset == "" {
+		return "", errInvalidText
+	}
+
+	enc, err := htmlindex.Get(o.Charset)
+	if err != nil {
+		return "", fmt.Errorf("charset %s: %w", o.Charset, err)
+	}
+
+	decoded, err := enc.NewDecoder().String(s)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(decoded) || strings.ContainsRune(decoded, utf8.RuneError) {
+		return "", errInvalidText
+	}
+	return decoded, nil
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+)
+
+// ChecksumRowsScanner wraps a RowsScanner and checksums the rows of the page,
+// along with a snapshot token of all the rows up to the end of the page.
+// Requesting the next page with the token tells whether the rows before it changed in between,
+// since the rows skipped by the offset are scanned (and checksummed) again.
+type ChecksumRowsScanner struct {
+	RowsScanner
+	Query  string
+	Offset int
+	// Snapshot is the token of the previous page, to verify the rows before the offset.
+	Snapshot string
+
+	all, page hash.Hash
+	prefix    string
+}
+
+func NewChecksumRowsScanner(s RowsScanner, query string, offset int, snapshot string) *ChecksumRowsScanner {
+	return &ChecksumRowsScanner{RowsScanner: s, Query: query, Offset: offset, Snapshot: snapshot}
+}
+
+func (c *ChecksumRowsScanner) StartRows(header []string) {
+	c.all, c.page = sha256.New(), sha256.New()
+	c.RowsScanner.StartRows(header)
+}
+
+func (c *ChecksumRowsScanner) AddRow(rowIndex int, columns []any) bool {
+	// the wrapped scanner stops at the row beyond its window, without taking it
+	ok := c.RowsScanner.AddRow(rowIndex, columns)
+	if !ok {
+		return false
+	}
+
+	if rowIndex == c.Offset {
+		c.prefix = c.token()
+	}
+
+	data, _ := json.Marshal(columns)
+	data = append(data, '\n')
+	c.all.Write(data)
+	if rowIndex >= c.Offset {
+		c.page.Write(data)
+	}
+	return true
+}
+
+func (c *ChecksumRowsScanner) token() string {
+	h := sha256.New()
+	h.Write([]byte(c.Query))
+	h.Write(c.all.Sum(nil))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func (c *ChecksumRowsScanner) Complete(result *QueryResult) {
+	c.RowsScanner.Complete(result)
+	if c.all == nil {
+		// no rows scanned
+		return
+	}
+
+	if c.prefix == "" {
+		// the page is empty, all the rows scanned are before the offset
+		c.prefix = c.token()
+	}
+	result.Checksum = hex.EncodeToString(c.page.Sum(nil))
+	result.Snapshot = c.token()
+	result.SnapshotChanged = c.Snapshot != "" && c.Snapshot != c.prefix
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kind is how RunSQL dispatches a statement, see ClassifyStatement.
+type Kind int
+
+const (
+	// KindExec are the statements run by Exec, like the DMLs without RETURNING, the DDLs, SET and CALL.
+	KindExec Kind = iota
+	// KindQuery are the statements returning rows run by Query, like SELECT, SHOW, EXPLAIN and the DMLs with RETURNING.
+	KindQuery
+)
+
+func (k Kind) String() string {
+	if k == KindQuery {
+		return "query"
+	}
+	return "exec"
+}
+
+// ErrUnterminated is the error of the statements with an unterminated string, quoted identifier or comment.
+var ErrUnterminated = errors.New("unterminated string, quoted identifier or comment")
+
+// ClassifyStatement classifies the statement the way RunSQL dispatches it, by the leading keywords
+// without parsing or running it, so it is cheap and safe on any input. The errors are ErrEmptyQuery
+// and ErrUnterminated, along with the best guess of the kind, the databases report the malformed ones anyway.
+func ClassifyStatement(query string) (Kind, error) {
+	if isBlank(query) {
+		return KindExec, ErrEmptyQuery
+	}
+
+	// the bare first word, compared case-insensitively without lowering it
+	first := ""
+	scanWords(query, func(w string, _, _ int) bool {
+		first = w
+		return false
+	})
+
+	kind := KindExec
+	switch {
+	case wordIn(first, "select", "show", "desc", "describe", "explain", "values", "table", "pragma"):
+		kind = KindQuery
+	case wordIn(first, "insert", "replace", "update", "delete"):
+		if hasWord(query, "returning") {
+			kind = KindQuery
+		}
+	case wordIn(first, "with"):
+		if cteReturnsRows(query) {
+			kind = KindQuery
+		}
+	}
+	if !terminated(query) {
+		return kind, ErrUnterminated
+	}
+	return kind, nil
+}
+
+// IsQuery tells whether the statement returns rows, and should be run by Query instead of Exec.
+func IsQuery(query string) bool {
+	kind, _ := ClassifyStatement(query)
+	return kind == KindQuery
+}
+
+// wordIn tells whether the word is one of the words (case-insensitive).
+func wordIn(word string, words ...string) bool {
+	for _, w := range words {
+		if strings.EqualFold(word, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// cteReturnsRows tells whether the main statement after the WITH clause returns rows.
+func cteReturnsRows(query string) bool {
+	switch main := cteMain(query); main {
+	case "select":
+		return true
+	case "":
+		return false
+	default:
+		return hasWord(query, "returning")
+	}
+}
+
+// cteMain returns the verb of the main statement after the WITH clause, select (for VALUES and TABLE too),
+// insert, replace, update or delete, it is the first one outside of the parentheses of the CTE definitions.
+func cteMain(query string) (main string) {
+	scanWords(query, func(w string, _, depth int) bool {
+		if depth > 0 {
+			return true
+		}
+		switch w = strings.ToLower(w); w {
+		case "select", "values", "table":
+			main = "select"
+		case "insert", "replace", "update", "delete":
+			main = w
+		}
+		return main == ""
+	})
+	return main
+}
@@ -0,0 +1,42 @@
+package db
+
+import "testing"
+
+func FuzzClassifyStatement(f *testing.F) {
+	for _, seed := range []string{
+		"SELECT 1",
+		"select * from t where a = 'it''s' -- trailing",
+		"/* leading */ SELECT `weird``name` FROM t",
+		"-- a comment\nUPDATE t SET a = 1",
+		"# a comment\nDELETE FROM t RETURNING id",
+		"/*!40101 SET NAMES utf8 */",
+		"/*!*/\"/*$1;as(fromé",
+		"/*!50000 SELECT */ 1",
+		`INSERT INTO t VALUES ("a\"b", 'c\'d')`,
+		"WITH a AS (SELECT 1) SELECT * FROM a",
+		"WITH a AS (SELECT 1) UPDATE t SET b = (SELECT * FROM a)",
+		"with recursive r(n) as (select 1 union all select n + 1 from r) select n from r",
+		"(SELECT 1) UNION (SELECT 2)",
+		"SELECT 'unterminated",
+		"SELECT /* unterminated",
+		"$$ body $$",
+		"",
+		"   \n\t",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, query string) {
+		kind, err := ClassifyStatement(query)
+		if again, againErr := ClassifyStatement(query); again != kind || (againErr == nil) != (err == nil) {
+			t.Fatalf("%q classified as %v (%v), then %v (%v)", query, kind, err, again, againErr)
+		}
+		// the surrounding whitespace changes nothing
+		if spaced, spacedErr := ClassifyStatement(" \t" + query + "\n"); spaced != kind || (spacedErr == nil) != (err == nil) {
+			t.Fatalf("%q classified as %v (%v), but %v (%v) with the whitespace", query, kind, err, spaced, spacedErr)
+		}
+		if kind != KindQuery && kind != KindExec {
+			t.Fatalf("%q classified as the unknown kind %v", query, kind)
+		}
+	})
+}
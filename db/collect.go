@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// rowsCollector is the RowsScanner keeping all the rows read.
+type rowsCollector struct {
+	header []string
+	rows   [][]any
+}
+
+func (c *rowsCollector) StartExecute()             {}
+func (c *rowsCollector) StartRows(header []string) { c.header = header }
+func (c *rowsCollector) Complete(*QueryResult)     {}
+
+func (c *rowsCollector) AddRow(_ int, columns []any) bool {
+	c.rows = append(c.rows, columns)
+	return true
+}
+
+// collectRows runs the SELECT generated on a table by RunSQLArgs, so it goes through the rewriters
+// (like the tenant and the deny ones), the examined rows gate and the observers like the statements of the clients,
+// and returns all its rows with the strings unquoted. They are left out of the Trace of the context.
+func collectRows(ctx context.Context, dba DB, q string, args []any) ([]string, [][]any, error) {
+	options := *OptionsFrom(ctx)
+	options.Unquoted, options.BigIntAsString = true, false
+	options.DryRun, options.Undo, options.Lint = false, false, nil
+
+	c := &rowsCollector{}
+	ctx = context.WithValue(WithOptions(ctx, &options), traceKey{}, (*Trace)(nil))
+	result := RunSQLArgs(ctx, dba, q, args, c)
+	if result.Error != "" {
+		return nil, nil, errors.New(result.Error)
+	}
+	if result.Truncated {
+		return nil, nil, fmt.Errorf("result truncated at max %d bytes", options.MaxBytes)
+	}
+	return c.header, c.rows, nil
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Danger is why a statement needs a confirmation before it runs, see Dangerous.
+type Danger struct {
+	Reason string `json:"reason"`
+	// Tables are the tables the statement affects, the DDL ones unknown by the parser have none.
+	Tables []string `json:"tables,omitempty"`
+}
+
+// Confirmation asks to resubmit the dangerous statement with the token, see Confirmer.
+type Confirmation struct {
+	Danger
+	Token string `json:"token"`
+	// EstimatedRows is the rows of the affected tables.
+	EstimatedRows int64 `json:"estimatedRows"`
+}
+
+// Dangerous tells whether the statement is an UPDATE/DELETE without WHERE or a DDL, nil if neither.
+// It fails closed: the multiple statements, and the UPDATE/DELETE/REPLACE (after a WITH clause too)
+// the parser fails on, are dangerous regardless of their WHERE.
+func Dangerous(query string) *Danger {
+	if MultiStatement(query) {
+		return &Danger{Reason: "multiple statements"}
+	}
+	stmt, err := parseSQL(query)
+	if err != nil {
+		verb := firstWord(query)
+		if verb == "with" {
+			verb = cteMain(query)
+		}
+		switch verb {
+		case "create", "alter", "drop", "truncate", "rename":
+			return &Danger{Reason: "DDL " + strings.ToUpper(verb)}
+		case "update", "delete", "replace":
+			return &Danger{Reason: "unparsed " + strings.ToUpper(verb)}
+		}
+		return nil
+	}
+
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		if s.Where == nil {
+			return &Danger{Reason: "UPDATE without WHERE", Tables: tableNames(s.TableExprs)}
+		}
+	case *sqlparser.Delete:
+		if s.Where == nil {
+			return &Danger{Reason: "DELETE without WHERE", Tables: tableNames(s.TableExprs)}
+		}
+	case *sqlparser.DDL:
+		d := &Danger{Reason: "DDL " + strings.ToUpper(s.Action)}
+		// the created tables have no rows yet
+		if s.Action != sqlparser.CreateStr && !s.Table.IsEmpty() {
+			d.Tables = []string{qualifiedName(s.Table)}
+		}
+		return d
+	}
+	return nil
+}
+
+func tableNames(exprs sqlparser.TableExprs) (names []string) {
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if t, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if name, ok := t.Expr.(sqlparser.TableName); ok {
+				names = append(names, qualifiedName(name))
+			}
+			return false, nil
+		}
+		return true, nil
+	}, exprs)
+	return names
+}
+
+func qualifiedName(t sqlparser.TableName) string {
+	if t.Qualifier.IsEmpty() {
+		return t.Name.String()
+	}
+	return t.Qualifier.String() + "." + t.Name.String()
+}
+
+// EstimateAffected counts the rows of the tables, the ones a dangerous statement affects,
+// by RunSQL, so the counts are of the tables the rewriters (like TenantSchema) resolve them to.
+func EstimateAffected(ctx context.Context, db DB, dialect Dialect, tables []string) (int64, error) {
+	var total int64
+	for _, table := range tables {
+		parts := strings.Split(table, ".")
+		for i, p := range parts {
+			quoted, err := quoteIdent(dialect, p)
+			if err != nil {
+				return 0, err
+			}
+			parts[i] = quoted
+		}
+
+		n, err := countRows(ctx, db, "SELECT COUNT(*) FROM "+strings.Join(parts, "."))
+		if err != nil {
+			return 0, fmt.Errorf("count %s: %w", table, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func countRows(ctx context.Context, db DB, q string) (int64, error) {
+	_, rows, err := collectRows(ctx, db, q, nil)
+	if err != nil || len(rows) == 0 || len(rows[0]) == 0 {
+		return 0, err
+	}
+	return strconv.ParseInt(fmt.Sprint(rows[0][0]), 10, 64)
+}
+
+// ErrConfirmToken is the error of a confirmation token invalid or expired.
+var ErrConfirmToken = errors.New("confirmation token invalid or expired")
+
+// Confirmer issues and verifies the confirmation tokens of the dangerous statements,
+// signed by HMAC-SHA256 over the subject (like the database and the principal), the statement and the expiry.
+type Confirmer struct {
+	Secret []byte
+	// TTL of the tokens, 5m by default.
+	TTL time.Duration
+}
+
+// Token issues the token to confirm the statement by.
+func (c *Confirmer) Token(subject, query string) string {
+	expiry := strconv.FormatInt(time.Now().Add(c.ttl()).Unix(), 36)
+	return expiry + "." + c.sign(subject, query, expiry)
+}
+
+// Verify checks the token is issued for the subject and the statement, and not expired.
+func (c *Confirmer) Verify(subject, query, token string) error {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(c.sign(subject, query, expiry))) {
+		return ErrConfirmToken
+	}
+	if unix, err := strconv.ParseInt(expiry, 36, 64); err != nil || time.Now().Unix() > unix {
+		return ErrConfirmToken
+	}
+	return nil
+}
+
+func (c *Confirmer) sign(subject, query, expiry string) string {
+	h := hmac.New(sha256.New, c.Secret)
+	h.Write([]byte(subject + "\x00" + query + "\x00" + expiry))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Confirmer) ttl() time.Duration {
+	if c.TTL <= 0 {
+		return 5 * time.Minute
+	}
+	return c.TTL
+}
@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -10,13 +12,46 @@ import (
 
 	"github.com/samber/lo"
 	"github.com/xwb1989/sqlparser"
-	"go.uber.org/multierr"
 )
 
 type QueryResult struct {
 	Error string           `json:"error,omitempty"`
 	Cost  string           `json:"cost,omitempty"`
 	Rows  []map[string]any `json:"rows,omitempty"`
+
+	// Warnings are the errors which did not fail the statement, like failed pre-checks.
+	Warnings []string `json:"warnings,omitempty"`
+	// Truncated tells the rows are partial, cut by the max rows or bytes.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Checksum of the rows of the page, Snapshot is the token to request the next page with,
+	// SnapshotChanged tells the rows before the page changed since the token, see ChecksumRowsScanner.
+	Checksum        string `json:"checksum,omitempty"`
+	Snapshot        string `json:"snapshot,omitempty"`
+	SnapshotChanged bool   `json:"snapshotChanged,omitempty"`
+
+	// Plan is the EXPLAIN output of a query rejected by Options.MaxExaminedRows.
+	Plan []map[string]any `json:"plan,omitempty"`
+	// Confirmation asks to resubmit a dangerous statement with its token, see Confirmer.
+	Confirmation *Confirmation `json:"confirmation,omitempty"`
+	// Undo are the statements reverting the UPDATE/DELETE, captured by Options.Undo.
+	Undo []string `json:"undo,omitempty"`
+	// Trace is the breakdown of the statement, attached by the server on the request, see WithTrace.
+	Trace *Trace `json:"trace,omitempty"`
+	// Position is the replication position after the write, captured by Options.Position, see WritePosition.
+	Position string `json:"position,omitempty"`
+
+	// Header and Values are the ordered representation of the rows.
+	Header []string `json:"header,omitempty"`
+	Values [][]any  `json:"values,omitempty"`
+
+	// ContentType and Data carry the output of scanners which render other formats than JSON rows.
+	ContentType string `json:"-"`
+	Data        []byte `json:"-"`
+	// Streamed tells the rows were written to the stream of the scanner already, like by NdjsonRowsScanner.
+	Streamed bool `json:"-"`
+	// RowCount is the rows read by a query, in any format, or affected by an exec.
+	RowCount int `json:"-"`
 }
 
 type DB interface {
@@ -24,40 +59,153 @@ type DB interface {
 	Queryer
 }
 
+var ErrEmptyQuery = errors.New("empty query")
+
+// RunSQL runs the query by Query or Exec, according to whether it returns rows.
+// The Options carried by ctx apply, the rows are scanned by a JsonRowsScanner with the limit of the options.
 func RunSQL(ctx context.Context, dba DB, query string) *QueryResult {
-	scanner := NewJsonRowsScanner(0, 30)
-	firstWord := strings.ToLower(strings.Fields(query)[0])
-	switch firstWord {
-	default:
-		return Exec(ctx, dba, query, nil, scanner)
-	case "select", "show", "desc", "describe":
-		return Query(ctx, dba, query, nil, scanner)
-	case "insert":
-		if strings.Contains(strings.ToLower(query), "returning") {
-			return Query(ctx, dba, query, nil, scanner)
+	return RunSQLArgs(ctx, dba, query, nil, nil)
+}
+
+// RunSQLScanner is RunSQL with the rows scanned by the scanner, a nil one defaults like RunSQL.
+func RunSQLScanner(ctx context.Context, dba DB, query string, scanner RowsScanner) *QueryResult {
+	return RunSQLArgs(ctx, dba, query, nil, scanner)
+}
+
+// RunSQLArgs is RunSQLScanner with the args of the placeholders in the query.
+func RunSQLArgs(ctx context.Context, dba DB, query string, args []any, scanner RowsScanner) *QueryResult {
+	if isBlank(query) {
+		return &QueryResult{Error: ErrEmptyQuery.Error()}
+	}
+
+	options, trace, prepareStart := OptionsFrom(ctx), TraceFrom(ctx), time.Now()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	lintWarnings, err := Lint(query, options.Lint...)
+	if err != nil {
+		return &QueryResult{Error: err.Error()}
+	}
+	if len(lintWarnings) > 0 && options.Strict {
+		return &QueryResult{Error: "lint failed", Warnings: lintWarnings}
+	}
+
+	stmt, err := Rewrite(Stmt{Ctx: ctx, Dialect: options.dialect(dba), Query: query, Args: args})
+	if err != nil {
+		return &QueryResult{Error: err.Error()}
+	}
+	query, ctx = stmt.Query, withStatementTimeout(ctx, stmt.Timeout)
+	if options.DryRun {
+		if query, stmt.Args, err = DryRunSQL(query, stmt.Args); err != nil {
+			return &QueryResult{Error: err.Error()}
 		}
+	}
 
-		return Exec(ctx, dba, query, nil, scanner)
+	if scanner == nil {
+		scanner = NewJsonRowsScanner(0, options.RowLimit())
+	}
+	// the pre-checks and the pinned connection are on the database the statement runs on
+	route := ""
+	if s, ok := dba.(*Splitter); ok {
+		if dba, route = s.Route(ctx, query), "replica"; dba == s.Primary {
+			route = "primary"
+		}
+	}
+	// the malformed ones are left to the database to report
+	kind, _ := ClassifyStatement(query)
+	if trace != nil {
+		trace.Kind, trace.Route, trace.Query = kind.String(), route, query
+		trace.Prepare = time.Since(prepareStart)
+	}
+
+	start := time.Now()
+	var result *QueryResult
+	if kind == KindQuery {
+		result = Query(ctx, dba, query, stmt.Args, scanner)
+	} else {
+		result = Exec(ctx, dba, query, stmt.Args, scanner)
+	}
+	observeQuery(ctx, query, result, time.Since(start))
+	if len(lintWarnings) > 0 {
+		result.Warnings = append(lintWarnings, result.Warnings...)
 	}
+	if trace != nil {
+		trace.Rows, trace.Total = result.RowCount, time.Since(prepareStart)
+		if trace.analyze && result.Error == "" && kind == KindQuery && IsReadOnly(query) {
+			if trace.Plan, err = ExplainAnalyze(ctx, dba, options.dialect(dba), query, stmt.Args); err != nil {
+				result.Warnings = append(result.Warnings, err.Error())
+			}
+		}
+	}
+
+	return result
 }
 
-func Query(ctx context.Context, db Queryer, q string, args []any, scanner *JsonRowsScanner) *QueryResult {
-	_ = PingDB(ctx, db, 3*time.Second)
+func Query(ctx context.Context, db Queryer, q string, args []any, scanner RowsScanner) *QueryResult {
+	dialect, trace, start := OptionsFrom(ctx).dialect(db), TraceFrom(ctx), time.Now()
+	conn, warnings, err := precheck(ctx, db)
+	if err != nil {
+		return &QueryResult{Error: err.Error()}
+	}
+	if conn != nil {
+		defer conn.Close()
+		db = conn
+		if trace != nil {
+			trace.Conn = connAddr(ctx, conn, dialect)
+		}
+	}
+	reset, err := setStatementTimeout(ctx, conn, dialect)
+	if err != nil {
+		return &QueryResult{Error: err.Error(), Warnings: warnings}
+	}
+	defer reset()
+	if trace != nil {
+		trace.PoolWait, start = time.Since(start), time.Now()
+	}
+
+	err = gateExamined(ctx, db, dialect, q, args)
+	if trace != nil && OptionsFrom(ctx).MaxExaminedRows > 0 {
+		trace.Check, start = time.Since(start), time.Now()
+	}
+	if err != nil {
+		result := &QueryResult{Error: err.Error(), Warnings: warnings}
+		var explainErr *ExplainError
+		if errors.As(err, &explainErr) {
+			result.Plan = explainErr.Plan
+		}
+		return result
+	}
 
 	scanner.StartExecute()
+	count := 0
+	scanner = countingRowsScanner{RowsScanner: scanner, rows: &count}
 
 	rows, err := db.QueryContext(ctx, q, args...)
+	if trace != nil {
+		trace.Exec, start = time.Since(start), time.Now()
+	}
 	if err != nil {
-		return &QueryResult{Error: err.Error()}
+		return &QueryResult{Error: err.Error(), Warnings: warnings}
 	}
 
 	defer rows.Close()
 
-	if err := scanner.Scan(rows); err != nil {
-		return &QueryResult{Error: err.Error()}
+	options := OptionsFrom(ctx)
+	truncated, err := scanRows(rows, scanner, q, options)
+	if trace != nil {
+		trace.Scan = time.Since(start)
+	}
+	if err != nil {
+		return &QueryResult{Error: err.Error(), Warnings: warnings}
+	}
+	if truncated == truncatedByBytes {
+		warnings = append(warnings, fmt.Sprintf("result truncated at max %d bytes", options.MaxBytes))
 	}
 
-	qr := &QueryResult{}
+	qr := &QueryResult{Warnings: warnings, Truncated: truncated != "", RowCount: count}
 	scanner.Complete(qr)
 	return qr
 }
@@ -77,49 +225,171 @@ type RowsScanner interface {
 	Complete(result *QueryResult)
 }
 
-func Exec(ctx context.Context, db DB, q string, args []any, rowsScanner RowsScanner) *QueryResult {
-	_ = PingDB(ctx, db, 3*time.Second)
+// countingRowsScanner counts the rows added to the scanner, for QueryResult.RowCount.
+type countingRowsScanner struct {
+	RowsScanner
+	rows *int
+}
 
-	rowsScanner.StartExecute()
-	result, err := db.ExecContext(ctx, q, args...)
+func (c countingRowsScanner) AddRow(rowIndex int, columns []any) bool {
+	*c.rows++
+	return c.RowsScanner.AddRow(rowIndex, columns)
+}
+
+func Exec(ctx context.Context, db DB, q string, args []any, rowsScanner RowsScanner) *QueryResult {
+	dialect, trace, start := OptionsFrom(ctx).dialect(db), TraceFrom(ctx), time.Now()
+	conn, warnings, err := precheck(ctx, db)
 	if err != nil {
 		return &QueryResult{Error: err.Error()}
 	}
+	if conn != nil {
+		defer conn.Close()
+		db = conn
+		if trace != nil {
+			trace.Conn = connAddr(ctx, conn, dialect)
+		}
+	}
+	reset, err := setStatementTimeout(ctx, conn, dialect)
+	if err != nil {
+		return &QueryResult{Error: err.Error(), Warnings: warnings}
+	}
+	defer reset()
+	if trace != nil {
+		trace.PoolWait, start = time.Since(start), time.Now()
+	}
 
-	id, err1 := result.LastInsertId()
-	affected, err2 := result.RowsAffected()
+	options := OptionsFrom(ctx)
+	rowsScanner.StartExecute()
+	var result sql.Result
+	var undo []string
+	if options.Undo {
+		result, undo, err = execUndo(ctx, db, dialect, q, args)
+		// unsupported by the undo log, runs without it unless strict
+		if errors.Is(err, ErrUndo) && !options.Strict {
+			reportError(ctx, err)
+			warnings = append(warnings, err.Error())
+			result, err = db.ExecContext(ctx, q, args...)
+		}
+	} else if dialect == DialectPostgres && firstWord(q) == "insert" {
+		result, err = execReturning(ctx, db, q, args)
+	} else {
+		result, err = db.ExecContext(ctx, q, args...)
+	}
+	if trace != nil {
+		trace.Exec = time.Since(start)
+	}
+	if err != nil {
+		return &QueryResult{Error: err.Error(), Warnings: warnings}
+	}
 
-	if err := multierr.Append(err1, err2); err != nil {
-		rowsScanner.StartRows([]string{"lastInsertId", "rowsAffected", "error"})
-		rowsScanner.AddRow(0, []any{id, affected, err})
+	// fields unsupported by the driver are omitted, instead of surfacing their errors
+	var header []string
+	var row []any
+	if r, ok := result.(returningResult); ok && r.hasID || SupportsLastInsertId(dialect) {
+		if id, err := result.LastInsertId(); err == nil {
+			header, row = append(header, "lastInsertId"), append(row, options.safeInt(id))
+		} else {
+			reportError(ctx, fmt.Errorf("last insert id: %w", err))
+		}
+	}
+	var count int64
+	if affected, err := result.RowsAffected(); err == nil {
+		count = affected
+		header, row = append(header, "rowsAffected"), append(row, options.safeInt(affected))
 	} else {
-		rowsScanner.StartRows([]string{"lastInsertId", "rowsAffected"})
-		rowsScanner.AddRow(0, []any{id, affected})
+		reportError(ctx, fmt.Errorf("rows affected: %w", err))
+	}
+
+	rowsScanner.StartRows(header)
+	if len(header) > 0 {
+		rowsScanner.AddRow(0, row)
 	}
 
-	qr := &QueryResult{}
+	qr := &QueryResult{Warnings: warnings, Undo: undo, RowCount: int(count)}
+	if options.Position {
+		if qr.Position, err = WritePosition(ctx, db, dialect); err != nil {
+			err = fmt.Errorf("write position: %w", err)
+			reportError(ctx, err)
+			qr.Warnings = append(qr.Warnings, err.Error())
+		}
+	}
 	rowsScanner.Complete(qr)
 
 	return qr
 }
 
-func PingDB(ctx context.Context, db Queryer, timeout time.Duration) error {
+// precheck pings the database before running a statement, see pinConn.
+// The ping error fails the statement in strict mode, or becomes a warning otherwise.
+func precheck(ctx context.Context, db Queryer) (*sql.Conn, []string, error) {
+	conn, err := pinConn(ctx, db, 3*time.Second)
+	if err == nil {
+		return conn, nil, nil
+	}
+
+	err = fmt.Errorf("precheck: %w", err)
+	if OptionsFrom(ctx).Strict {
+		return nil, nil, err
+	}
+
+	reportError(ctx, err)
+	return nil, []string{err.Error()}, nil
+}
 
+// pinConn takes a dedicated connection from the pool of *sql.DB, validated by the driver Pinger,
+// so that the upcoming statement runs on the very connection (and the very target) which was checked.
+// Stale connections failing the ping are discarded, the pool then dials a fresh one.
+// For other databases, it falls back to PingDB and returns a nil connection.
+func pinConn(ctx context.Context, db Queryer, timeout time.Duration) (*sql.Conn, error) {
+	sdb, ok := db.(*sql.DB)
+	if !ok {
+		return nil, PingDB(ctx, db, timeout)
+	}
+
+	return PingConn(ctx, sdb, timeout)
+}
+
+// PingConn takes a connection from the pool, and pings it by the driver, retrying up to 3 times.
+func PingConn(ctx context.Context, sdb *sql.DB, timeout time.Duration) (*sql.Conn, error) {
 	timeoutCtx, cancelFunc := context.WithTimeout(ctx, timeout)
 	defer cancelFunc()
 
+	var err error
 	for i := 0; i < 3; i++ {
-		rows, err := db.QueryContext(timeoutCtx, "select 1")
-		if err != nil {
+		var conn *sql.Conn
+		if conn, err = sdb.Conn(timeoutCtx); err != nil {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		if err = conn.PingContext(timeoutCtx); err != nil {
+			// discard the connection, instead of returning it to the pool
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+			_ = conn.Close()
+			continue
+		}
+
+		return conn, nil
+	}
+
+	return nil, err
+}
+
+func PingDB(ctx context.Context, db Queryer, timeout time.Duration) error {
+	timeoutCtx, cancelFunc := context.WithTimeout(ctx, timeout)
+	defer cancelFunc()
+
+	var err error
+	for i := 0; i < 3; i++ {
+		var rows *sql.Rows
+		if rows, err = db.QueryContext(timeoutCtx, "select 1"); err != nil {
 			time.Sleep(100 * time.Millisecond)
 			continue
 		}
 
-		_ = rows.Close()
-		break
+		return rows.Close()
 	}
 
-	return nil
+	return err
 }
 
 type Queryer interface {
@@ -143,7 +413,7 @@ func (j *JsonRowsScanner) StartExecute() {
 }
 
 func (j *JsonRowsScanner) StartRows(header []string) {
-	j.Header = header
+	j.Header = DedupColumns(header)
 }
 
 func (j *JsonRowsScanner) AddRow(rowIndex int, columns []any) bool {
@@ -170,31 +440,80 @@ func (j *JsonRowsScanner) Complete(result *QueryResult) {
 }
 
 func (j *JsonRowsScanner) Scan(rows *sql.Rows) error {
+	return ScanRows(rows, j)
+}
+
+// ScanRows feeds the rows to the scanner, until the rows are exhausted or the scanner stops.
+func ScanRows(rows *sql.Rows, j RowsScanner) error {
+	_, err := scanRows(rows, j, "", &Options{})
+	return err
+}
+
+// the reasons of a truncated result
+const (
+	truncatedByRows  = "rows"
+	truncatedByBytes = "bytes"
+)
+
+// scanRows feeds the rows to the scanner, returns the reason when the rows are truncated.
+func scanRows(rows *sql.Rows, j RowsScanner, query string, options *Options) (truncated string, err error) {
 	scan, err := NewRowScanner(rows)
 	if err != nil {
-		return err
+		return "", err
 	}
+	scan.Options = options
 
 	rowNum := 0
 	columns, err := rows.Columns()
 	if err != nil {
-		return err
+		return "", err
+	}
+	if columns, err = ResolveColumns(columns, query, options.DuplicateColumns); err != nil {
+		return "", err
 	}
 
 	j.StartRows(columns)
 
+	size := 0
 	for ; scan.Next(); rowNum++ {
 		row, err := scan.Scan()
 		if err != nil {
-			return err
+			return "", err
 		}
 
+		if options.MaxBytes > 0 {
+			if size += rowSize(row); size > options.MaxBytes {
+				truncated = truncatedByBytes
+				break
+			}
+		}
+
+		// the scanners stop only when there are more rows than their limits
 		if !j.AddRow(rowNum, row) {
+			truncated = truncatedByRows
 			break
 		}
 	}
 
-	return rows.Err()
+	return truncated, rows.Err()
+}
+
+// rowSize estimates the bytes of the values in a row.
+func rowSize(row []any) int {
+	size := 0
+	for _, v := range row {
+		switch t := v.(type) {
+		case string:
+			size += len(t)
+		case []byte:
+			size += len(t)
+		case Base64Value:
+			size += len(t.Base64)
+		default:
+			size += 8
+		}
+	}
+	return size
 }
 
 type ValueType int
@@ -207,6 +526,9 @@ const (
 	ValueTypeString
 	ValueTypeBytes
 	ValueTypeOther
+	ValueTypeUint64
+	ValueTypeYear
+	ValueTypeTime
 )
 
 type RowScanner struct {
@@ -215,6 +537,8 @@ type RowScanner struct {
 	Types        []ValueType
 	LowerColumns []string
 	Columns      []string
+
+	Options *Options
 }
 
 func NewRowScanner(rows *sql.Rows) (*RowScanner, error) {
@@ -239,6 +563,12 @@ func NewRowScanner(rows *sql.Rows) (*RowScanner, error) {
 			return ValueTypeString
 		case Contains(typeName, "BOOL"):
 			return ValueTypeBool
+		case typeName == "YEAR":
+			return ValueTypeYear
+		case typeName == "TIME":
+			return ValueTypeTime
+		case strings.HasPrefix(typeName, "UNSIGNED") && Contains(typeName, "INT"):
+			return ValueTypeUint64
 		case Contains(typeName, "BOOL", "INT", "NUMBER"):
 			return ValueTypeInt64
 		case Contains(typeName, "DECIMAL"):
@@ -268,7 +598,11 @@ func (s RowScanner) Next() bool {
 
 func (s RowScanner) Scan() ([]any, error) {
 	values := lo.Map(s.Types, func(t ValueType, index int) any {
-		return &NullAny{ValueType: t}
+		n := &NullAny{ValueType: t}
+		if s.Options != nil {
+			n.TimeFormat = s.Options.TimeFormat
+		}
+		return n
 	})
 	if err := s.Rows.Scan(values...); err != nil {
 		return nil, err
@@ -287,15 +621,17 @@ func (s RowScanner) getColValue(n NullAny) any {
 	}
 
 	switch n.ValueType {
-	case ValueTypeInt64, ValueTypeFloat64:
+	case ValueTypeInt64, ValueTypeUint64:
+		return s.Options.safeInt(n.Value)
+	case ValueTypeFloat64, ValueTypeYear, ValueTypeTime:
 		return n.Value
 	case ValueTypeBytes:
 		if data, ok := n.Value.([]byte); ok {
-			return string(data)
+			return s.Options.text(string(data), false)
 		}
 	}
 
-	return Quote(fmt.Sprintf("%v", n.Value))
+	return s.Options.text(fmt.Sprintf("%v", n.Value), s.Options == nil || !s.Options.Unquoted)
 }
 
 const (
@@ -303,6 +639,14 @@ const (
 	escape = '\\'
 )
 
+// Unquote reverses Quote, strings not quoted are returned as is.
+func Unquote(s string) string {
+	if len(s) < 2 || s[0] != quote || s[len(s)-1] != quote {
+		return s
+	}
+	return strings.ReplaceAll(s[1:len(s)-1], string([]rune{escape, quote}), string(quote))
+}
+
 // Quote returns a single-quoted Go string literal representing s. But, nothing else escapes.
 func Quote(s string) string {
 	out := []rune{quote}
@@ -319,7 +663,7 @@ func Quote(s string) string {
 }
 
 func GetSingleTableName(query string) string {
-	result, err := sqlparser.Parse(query)
+	result, err := parseSQL(query)
 	if err != nil {
 		return ""
 	}
@@ -341,6 +685,9 @@ type NullAny struct {
 	Value     any
 	ValueType ValueType
 	Valid     bool
+
+	// TimeFormat is the layout to format time.Time values, see Options.TimeFormat.
+	TimeFormat string
 }
 
 // Scan implements the Scanner interface.
@@ -361,6 +708,22 @@ func (ns *NullAny) Scan(value any) error {
 		err := v0.Scan(value)
 		ns.Value = v0.Int64
 		return err
+	case ValueTypeUint64:
+		// UNSIGNED BIGINT overflows int64
+		var v0 sql.Null[uint64]
+		err := v0.Scan(value)
+		ns.Value = v0.V
+		return err
+	case ValueTypeYear:
+		var v0 sql.NullInt64
+		err := v0.Scan(value)
+		ns.Value = v0.Int64
+		return err
+	case ValueTypeTime:
+		var v0 sql.NullString
+		err := v0.Scan(value)
+		ns.Value = formatTime(v0.String)
+		return err
 	case ValueTypeFloat64:
 		var v1 sql.NullFloat64
 		err := v1.Scan(value)
@@ -406,6 +769,14 @@ func (ns *NullAny) Scan(value any) error {
 	}
 }
 
+// formatTime formats the TIME value like -838:59:59[.ffffff], without trailing fractional zeros.
+func formatTime(s string) string {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
 func (ns *NullAny) convertAlias(value any) {
 	rv := reflect.ValueOf(value)
 
@@ -429,6 +800,11 @@ var aliasConverters = []AliasConvert{
 		Type: reflect.TypeOf((*time.Time)(nil)).Elem(),
 		Converter: func(typ reflect.Type, rv reflect.Value, ns *NullAny) {
 			t := rv.Convert(typ).Interface().(time.Time)
+			ns.ValueType = ValueTypeString
+			if ns.TimeFormat != "" {
+				ns.Value = t.Format(ns.TimeFormat)
+				return
+			}
 
 			// refer: https://github.com/hexon/mysqltsv/blob/main/mysqltsv.go
 			hour, minute, sec := t.Clock()
@@ -441,7 +817,6 @@ var aliasConverters = []AliasConvert{
 			default:
 				ns.Value = t.Format("2006-01-02 15:04:05.999999999")
 			}
-			ns.ValueType = ValueTypeString
 		},
 	},
 
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialect is the SQL dialect of a database.
+type Dialect string
+
+const (
+	DialectUnknown  Dialect = ""
+	DialectMySQL    Dialect = "mysql"
+	DialectPostgres Dialect = "postgres"
+)
+
+// DetectDialect detects the dialect by the driver of the database.
+func DetectDialect(dba any) Dialect {
+	sdb, ok := dba.(*sql.DB)
+	if !ok {
+		return DialectUnknown
+	}
+
+	switch driver := strings.ToLower(fmt.Sprintf("%T", sdb.Driver())); {
+	case strings.Contains(driver, "mysql"):
+		return DialectMySQL
+	case Contains(driver, "pq.", "pgx", "stdlib.", "postgres"):
+		return DialectPostgres
+	default:
+		return DialectUnknown
+	}
+}
+
+// SupportsLastInsertId tells whether the driver of the dialect supports sql.Result.LastInsertId,
+// Postgres drivers do not, RETURNING is the way to get generated ids there, see execReturning.
+func SupportsLastInsertId(d Dialect) bool {
+	return d != DialectPostgres
+}
+
+// returningResult is the sql.Result of an INSERT run with RETURNING its primary key by execReturning.
+type returningResult struct {
+	id, affected int64
+	// hasID tells the primary key returned is an integer, like a serial or identity one.
+	hasID bool
+}
+
+func (r returningResult) LastInsertId() (int64, error) {
+	if !r.hasID {
+		return 0, errors.New("no integer primary key returned")
+	}
+	return r.id, nil
+}
+
+func (r returningResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// execReturning runs the Postgres INSERT with RETURNING the primary key of its table, when it is a single column,
+// the last returned one is the last insert id. The INSERTs into the quoted tables, or the ones without
+// such a primary key, run as is.
+func execReturning(ctx context.Context, db DB, q string, args []any) (sql.Result, error) {
+	table := insertTable(q)
+	if table == "" || hasWord(q, "returning") {
+		return db.ExecContext(ctx, q, args...)
+	}
+	key, err := primaryKey(ctx, db, DialectPostgres, table)
+	if err != nil || len(key) != 1 {
+		if err != nil && !errors.Is(err, ErrNoPrimaryKey) {
+			reportError(ctx, err)
+		}
+		return db.ExecContext(ctx, q, args...)
+	}
+	column, err := quoteIdent(DialectPostgres, key[0])
+	if err != nil {
+		return db.ExecContext(ctx, q, args...)
+	}
+
+	// on a new line, after any trailing line comment
+	q = strings.TrimRight(strings.TrimSpace(q), "; \t\r\n") + "\nRETURNING " + column
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var r returningResult
+	for rows.Next() {
+		var id any
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		r.affected++
+		r.id, r.hasID = id.(int64)
+	}
+	return r, rows.Err()
+}
+
+// insertTable returns the table of the INSERT INTO, like schema.table, empty if quoted, which the parser of MySQL
+// fails on like the placeholders $1 of Postgres.
+func insertTable(q string) (table string) {
+	words := 0
+	scanWords(q, func(w string, pos, _ int) bool {
+		if words++; words == 2 && strings.EqualFold(w, "into") {
+			rest := q[pos+len(w):]
+			start := skipSpaceAndComments(rest)
+			end := start
+			for end < len(rest) && (isIdentChar(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			table = rest[start:end]
+		}
+		return words < 2
+	})
+	return table
+}
+
+// DeadlineHint injects the execution time limit derived from the deadline of the statement context,
+// so that the server gives up at the same time as the client: MySQL gets an optimizer hint
+// /*+ MAX_EXECUTION_TIME(ms) */ on SELECT, Postgres gets the Timeout of the statement, which sets
+// statement_timeout on the pinned connection around the statement, rather than a SET LOCAL prefix
+// turning it into multiple statements.
+func DeadlineHint(stmt Stmt) (Stmt, error) {
+	if stmt.Ctx == nil || stmt.Dialect != DialectMySQL && stmt.Dialect != DialectPostgres {
+		return stmt, nil
+	}
+	deadline, ok := stmt.Ctx.Deadline()
+	if !ok {
+		return stmt, nil
+	}
+	ms := max(time.Until(deadline).Milliseconds(), 1)
+	if stmt.Dialect == DialectPostgres {
+		stmt.Timeout = time.Duration(ms) * time.Millisecond
+		return stmt, nil
+	}
+
+	pos := skipSpaceAndComments(stmt.Query)
+	if !hasKeywordAt(stmt.Query, pos, "select") || strings.Contains(strings.ToUpper(stmt.Query), "MAX_EXECUTION_TIME") {
+		return stmt, nil
+	}
+	pos += len("select")
+	stmt.Query = fmt.Sprintf("%s /*+ MAX_EXECUTION_TIME(%d) */%s", stmt.Query[:pos], ms, stmt.Query[pos:])
+	return stmt, nil
+}
+
+type statementTimeoutKey struct{}
+
+// withStatementTimeout returns a context carrying the Timeout of the statement for Query and Exec.
+func withStatementTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, statementTimeoutKey{}, timeout)
+}
+
+// setStatementTimeout sets the statement_timeout of the pinned Postgres connection by the Timeout of the statement,
+// and returns the reset to run before the connection goes back to the pool, which discards it if the reset fails.
+func setStatementTimeout(ctx context.Context, conn *sql.Conn, dialect Dialect) (reset func(), err error) {
+	timeout, _ := ctx.Value(statementTimeoutKey{}).(time.Duration)
+	if conn == nil || dialect != DialectPostgres || timeout <= 0 {
+		return func() {}, nil
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET statement_timeout = %d", timeout.Milliseconds())); err != nil {
+		return func() {}, fmt.Errorf("statement timeout: %w", err)
+	}
+	return func() {
+		// the context of the statement may be done already
+		resetCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+		defer cancel()
+
+		if _, err := conn.ExecContext(resetCtx, "RESET statement_timeout"); err != nil {
+			reportError(ctx, fmt.Errorf("reset statement timeout: %w", err))
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}, nil
+}
+
+func hasKeywordAt(q string, pos int, keyword string) bool {
+	end := pos + len(keyword)
+	if end > len(q) || !strings.EqualFold(q[pos:end], keyword) {
+		return false
+	}
+	return end == len(q) || !isIdentChar(q[end])
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
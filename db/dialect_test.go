@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDB is a database/sql driver recording the statements by connection, failing the ones of fail.
+type recordingDB struct {
+	fail string
+	// rows answers the queries by the rows of a column, none if nil.
+	rows func(query string) []driver.Value
+
+	lock       sync.Mutex
+	conns      int
+	statements []string
+}
+
+func (r *recordingDB) Connect(context.Context) (driver.Conn, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.conns++
+	return &recordingConn{r: r, id: r.conns}, nil
+}
+
+func (r *recordingDB) Driver() driver.Driver            { return r }
+func (r *recordingDB) Open(string) (driver.Conn, error) { return r.Connect(context.Background()) }
+
+// Statements returns the statements run so far, prefixed by the numbers of their connections.
+func (r *recordingDB) Statements() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return slices.Clone(r.statements)
+}
+
+type recordingConn struct {
+	r  *recordingDB
+	id int
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare unsupported")
+}
+func (c *recordingConn) Close() error               { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)  { return nil, errors.New("begin unsupported") }
+func (c *recordingConn) Ping(context.Context) error { return nil }
+
+func (c *recordingConn) record(query string) error {
+	c.r.lock.Lock()
+	defer c.r.lock.Unlock()
+
+	c.r.statements = append(c.r.statements, fmt.Sprintf("%d: %s", c.id, query))
+	if c.r.fail != "" && strings.HasPrefix(query, c.r.fail) {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	if err := c.record(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.record(query); err != nil {
+		return nil, err
+	}
+	if c.r.rows != nil {
+		return &valueRows{values: c.r.rows(query)}, nil
+	}
+	return &emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (*emptyRows) Columns() []string         { return []string{"a"} }
+func (*emptyRows) Close() error              { return nil }
+func (*emptyRows) Next([]driver.Value) error { return io.EOF }
+
+// valueRows are the rows of a column.
+type valueRows struct{ values []driver.Value }
+
+func (*valueRows) Columns() []string { return []string{"a"} }
+func (*valueRows) Close() error      { return nil }
+
+func (r *valueRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func TestDeadlineHint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	stmt, _ := DeadlineHint(Stmt{Ctx: ctx, Dialect: DialectMySQL, Query: "select a from t"})
+	if !strings.HasPrefix(stmt.Query, "select /*+ MAX_EXECUTION_TIME(") || stmt.Timeout != 0 {
+		t.Fatalf("mysql: %+v, want the optimizer hint", stmt)
+	}
+	stmt, _ = DeadlineHint(Stmt{Ctx: ctx, Dialect: DialectPostgres, Query: "select a from t"})
+	if stmt.Query != "select a from t" || stmt.Timeout <= 50*time.Second || stmt.Timeout > time.Minute {
+		t.Fatalf("postgres: %+v, want the timeout of the deadline", stmt)
+	}
+	stmt, _ = DeadlineHint(Stmt{Ctx: context.Background(), Dialect: DialectPostgres, Query: "select a from t"})
+	if stmt.Timeout != 0 {
+		t.Fatalf("postgres without deadline: %+v, want no timeout", stmt)
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		dialect Dialect
+		fail    string
+		want    []string
+	}{
+		{
+			name: "postgres", dialect: DialectPostgres,
+			want: []string{"1: SET statement_timeout = 1500", "1: %s", "1: RESET statement_timeout"},
+		},
+		{name: "mysql", dialect: DialectMySQL, want: []string{"1: %s"}},
+		{
+			name: "postgres failing the set", dialect: DialectPostgres, fail: "SET",
+			want: []string{"1: SET statement_timeout = 1500"},
+		},
+	} {
+		for _, query := range []string{"select a from t", "update t set a = 1"} {
+			r := &recordingDB{fail: c.fail}
+			sdb := sql.OpenDB(r)
+			ctx := WithOptions(context.Background(), &Options{Dialect: c.dialect})
+			ctx = withStatementTimeout(ctx, 1500*time.Millisecond)
+
+			var result *QueryResult
+			if strings.HasPrefix(query, "select") {
+				result = Query(ctx, sdb, query, nil, NewJsonRowsScanner(0, 0))
+			} else {
+				result = Exec(ctx, sdb, query, nil, NewJsonRowsScanner(0, 0))
+			}
+			_ = sdb.Close()
+
+			want := make([]string, len(c.want))
+			for i, w := range c.want {
+				want[i] = strings.ReplaceAll(w, "%s", query)
+			}
+			if got := r.Statements(); !slices.Equal(got, want) {
+				t.Errorf("%s %s: statements %q, want %q", c.name, query, got, want)
+			}
+			if (result.Error != "") != (c.fail != "") {
+				t.Errorf("%s %s: error %q", c.name, query, result.Error)
+			}
+		}
+	}
+}
+
+func TestStatementTimeoutResetFailed(t *testing.T) {
+	r := &recordingDB{fail: "RESET"}
+	sdb := sql.OpenDB(r)
+	defer sdb.Close()
+	sdb.SetMaxOpenConns(1)
+
+	ctx := WithOptions(context.Background(), &Options{Dialect: DialectPostgres})
+	Exec(withStatementTimeout(ctx, time.Second), sdb, "update t set a = 1", nil, NewJsonRowsScanner(0, 0))
+	// the connection with the timeout left is discarded, the next statement runs on another one
+	Exec(ctx, sdb, "update t set a = 2", nil, NewJsonRowsScanner(0, 0))
+
+	want := []string{"1: SET statement_timeout = 1000", "1: update t set a = 1", "1: RESET statement_timeout", "2: update t set a = 2"}
+	if got := r.Statements(); !slices.Equal(got, want) {
+		t.Fatalf("statements %q, want %q", got, want)
+	}
+}
+
+func TestExecReturning(t *testing.T) {
+	for _, c := range []struct {
+		query, key string
+		returned   []driver.Value
+		want       []string
+		header     []string
+	}{
+		{
+			query: "insert into s.t(a) values ($1), ($2);", key: "id", returned: []driver.Value{int64(7), int64(8)},
+			want:   []string{"pk s.t", "insert into s.t(a) values ($1), ($2)\nRETURNING \"id\""},
+			header: []string{"lastInsertId", "rowsAffected"},
+		},
+		{
+			query: "insert into t(a) values ($1) -- note", key: "uid", returned: []driver.Value{"a1b2"},
+			want:   []string{"pk t", "insert into t(a) values ($1) -- note\nRETURNING \"uid\""},
+			header: []string{"rowsAffected"},
+		},
+		{
+			query: "insert into t(a) values ($1)", want: []string{"pk t", "insert into t(a) values ($1)"},
+			header: []string{"rowsAffected"},
+		},
+		{query: `insert into "T"(a) values ($1)`, want: []string{`insert into "T"(a) values ($1)`}, header: []string{"rowsAffected"}},
+	} {
+		r := &recordingDB{rows: func(query string) []driver.Value {
+			if strings.Contains(query, "indisprimary") {
+				if c.key == "" {
+					return nil
+				}
+				return []driver.Value{c.key}
+			}
+			return c.returned
+		}}
+		sdb := sql.OpenDB(r)
+		ctx := WithOptions(context.Background(), &Options{Dialect: DialectPostgres})
+		scanner := NewJsonRowsScanner(0, 1)
+		result := Exec(ctx, sdb, c.query, []any{1, 2}[:strings.Count(c.query, "$")], scanner)
+		_ = sdb.Close()
+
+		var got []string
+		for _, s := range r.Statements() {
+			s = strings.TrimPrefix(s, "1: ")
+			if strings.Contains(s, "indisprimary") {
+				s = "pk " + c.query[len("insert into "):strings.IndexByte(c.query, '(')]
+			}
+			got = append(got, s)
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%s: statements %q, want %q", c.query, got, c.want)
+		}
+		if result.Error != "" || !slices.Equal(scanner.Header, c.header) {
+			t.Errorf("%s: header %v, error %q, want %v", c.query, scanner.Header, result.Error, c.header)
+		}
+		if len(c.header) == 2 && (scanner.Rows[0]["lastInsertId"] != int64(8) || scanner.Rows[0]["rowsAffected"] != int64(2)) {
+			t.Errorf("%s: row %v, want the last id 8 of the 2 rows", c.query, scanner.Rows[0])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// The types of RowChange.
+const (
+	RowAdded   = "added"
+	RowChanged = "changed"
+	RowRemoved = "removed"
+)
+
+// RowChange is a change of a row between two results, identified by the key columns,
+// whose values are joined by commas in Key.
+type RowChange struct {
+	Type string         `json:"type"`
+	Key  string         `json:"key"`
+	Row  map[string]any `json:"row,omitempty"`
+	// Before is the previous row of a changed or removed one.
+	Before map[string]any `json:"before,omitempty"`
+}
+
+// DiffRows diffs the rows of two results by the key columns separated by commas, like id or region,id,
+// the added and changed rows come in the order of after, then the removed ones in the order of before.
+func DiffRows(key string, before, after []map[string]any) ([]RowChange, error) {
+	columns := strings.Split(key, ",")
+	beforeKeys, err := keyRows(columns, before)
+	if err != nil {
+		return nil, err
+	}
+	afterKeys, err := keyRows(columns, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []RowChange
+	for _, row := range after {
+		k := rowKey(columns, row)
+		prev, ok := beforeKeys[k]
+		switch {
+		case !ok:
+			changes = append(changes, RowChange{Type: RowAdded, Key: k, Row: row})
+		case !reflect.DeepEqual(prev, row):
+			changes = append(changes, RowChange{Type: RowChanged, Key: k, Row: row, Before: prev})
+		}
+	}
+	for _, row := range before {
+		k := rowKey(columns, row)
+		if _, ok := afterKeys[k]; !ok {
+			changes = append(changes, RowChange{Type: RowRemoved, Key: k, Before: row})
+		}
+	}
+	return changes, nil
+}
+
+func keyRows(columns []string, rows []map[string]any) (map[string]map[string]any, error) {
+	m := make(map[string]map[string]any, len(rows))
+	for _, row := range rows {
+		for _, c := range columns {
+			if _, ok := row[c]; !ok {
+				return nil, fmt.Errorf("key column %s not found", c)
+			}
+		}
+		m[rowKey(columns, row)] = row
+	}
+	return m, nil
+}
+
+func rowKey(columns []string, row map[string]any) string {
+	if len(columns) == 1 {
+		return fmt.Sprint(row[columns[0]])
+	}
+
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		values[i] = fmt.Sprint(row[c])
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// ErrDryRun is the error of the statements which can not be dry run.
+var ErrDryRun = errors.New("dry run supports UPDATE and DELETE only")
+
+// DryRunSQL rewrites the UPDATE or DELETE into the SELECT COUNT(*) AS rowsAffected of the rows it would affect,
+// by the same tables and predicates, the ones with ORDER BY or LIMIT are counted over the subquery of them.
+// The rows of the multi-table statements are counted over their joins.
+// The ? placeholders are kept, and the args returned are the ones left without the ones of the SET clause.
+func DryRunSQL(query string, args []any) (string, []any, error) {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrDryRun, err)
+	}
+
+	var from sqlparser.TableExprs
+	var where *sqlparser.Where
+	var orderBy sqlparser.OrderBy
+	var limit *sqlparser.Limit
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		from, where, orderBy, limit = s.TableExprs, s.Where, s.OrderBy, s.Limit
+		args = dropArgs(s.Exprs, args)
+	case *sqlparser.Delete:
+		from, where, orderBy, limit = s.TableExprs, s.Where, s.OrderBy, s.Limit
+	default:
+		return "", nil, ErrDryRun
+	}
+
+	if len(orderBy) > 0 || limit != nil {
+		rows := &sqlparser.Select{
+			SelectExprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: sqlparser.NewIntVal([]byte("1"))}},
+			From:        from, Where: where, OrderBy: orderBy, Limit: limit,
+		}
+		from = sqlparser.TableExprs{&sqlparser.AliasedTableExpr{
+			Expr: &sqlparser.Subquery{Select: rows},
+			As:   sqlparser.NewTableIdent("dry_run"),
+		}}
+		where = nil
+	}
+
+	count := &sqlparser.Select{
+		SelectExprs: sqlparser.SelectExprs{&sqlparser.AliasedExpr{
+			Expr: &sqlparser.FuncExpr{Name: sqlparser.NewColIdent("count"), Exprs: sqlparser.SelectExprs{&sqlparser.StarExpr{}}},
+			As:   sqlparser.NewColIdent("rowsAffected"),
+		}},
+		From:  from,
+		Where: where,
+	}
+	return sqlString(count), args, nil
+}
+
+// dropArgs returns the args without the ones of the positional placeholders in the node.
+func dropArgs(node sqlparser.SQLNode, args []any) []any {
+	dropped := map[int]bool{}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if v, ok := node.(*sqlparser.SQLVal); ok && v.Type == sqlparser.ValArg && positionalArg.Match(v.Val) {
+			n, _ := strconv.Atoi(string(v.Val[2:]))
+			dropped[n-1] = true
+		}
+		return true, nil
+	}, node)
+
+	var kept []any
+	for i, arg := range args {
+		if !dropped[i] {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDryRunSQL(t *testing.T) {
+	for _, c := range []struct {
+		query    string
+		args     []any
+		want     string
+		wantArgs []any
+	}{
+		{
+			query: "delete from t where created < '2020-01-01'",
+			want:  "select count(*) as rowsAffected from t where created < '2020-01-01'",
+		},
+		{
+			query:    "update t set a = ?, b = ? where c = ? and d > ?",
+			args:     []any{1, 2, 3, 4},
+			want:     "select count(*) as rowsAffected from t where c = ? and d > ?",
+			wantArgs: []any{3, 4},
+		},
+		{
+			query: "delete from t where a = 1 order by id limit 10",
+			want:  "select count(*) as rowsAffected from (select 1 from t where a = 1 order by id asc limit 10) as dry_run",
+		},
+		{
+			query: "update t join u on t.id = u.id set t.a = 1 where u.b = 2",
+			want:  "select count(*) as rowsAffected from t join u on t.id = u.id where u.b = 2",
+		},
+	} {
+		q, args, err := DryRunSQL(c.query, c.args)
+		if err != nil || q != c.want || !reflect.DeepEqual(args, c.wantArgs) {
+			t.Errorf("%s: %q %v, %v, want %q %v", c.query, q, args, err, c.want, c.wantArgs)
+		}
+	}
+
+	for _, q := range []string{"insert into t values (1)", "select * from t", "drop table t"} {
+		if _, _, err := DryRunSQL(q, nil); !errors.Is(err, ErrDryRun) {
+			t.Errorf("%s: %v, want %v", q, err, ErrDryRun)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ExplainError rejects a query whose estimated examined rows exceed Options.MaxExaminedRows,
+// carrying the plan for the user to fix the query.
+type ExplainError struct {
+	Estimated int64
+	Max       int64
+	Plan      []map[string]any
+}
+
+func (e *ExplainError) Error() string {
+	return fmt.Sprintf("estimated %d examined rows exceed the max %d, see the plan", e.Estimated, e.Max)
+}
+
+// Explain runs EXPLAIN on the query, and estimates the rows it examines:
+// for MySQL, the rows of the tables joined in a select (the same id) are multiplied, and the selects are summed;
+// for Postgres, the plan rows of the scans (the leaf nodes) are summed.
+func Explain(ctx context.Context, db Queryer, dialect Dialect, q string, args []any) ([]map[string]any, int64, error) {
+	explain := "EXPLAIN " + q
+	if dialect == DialectPostgres {
+		explain = "EXPLAIN (FORMAT JSON) " + q
+	}
+
+	plan, err := explainPlan(ctx, db, explain, args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if dialect == DialectPostgres {
+		return postgresEstimate(plan)
+	}
+	return plan, mysqlEstimate(plan), nil
+}
+
+// explainPlan runs the EXPLAIN statement, and returns its rows.
+func explainPlan(ctx context.Context, db Queryer, explain string, args []any) ([]map[string]any, error) {
+	rows, err := db.QueryContext(ctx, explain, args...)
+	if err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+	defer rows.Close()
+
+	scanner, err := NewRowScanner(rows)
+	if err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+	scanner.Options = &Options{Unquoted: true}
+
+	var plan []map[string]any
+	for scanner.Next() {
+		values, err := scanner.Scan()
+		if err != nil {
+			return nil, fmt.Errorf("explain: %w", err)
+		}
+		row := make(map[string]any, len(values))
+		for i, v := range values {
+			row[scanner.Columns[i]] = v
+		}
+		plan = append(plan, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+	return plan, nil
+}
+
+func mysqlEstimate(plan []map[string]any) int64 {
+	selects := map[string]float64{}
+	for _, row := range plan {
+		n, err := strconv.ParseFloat(fmt.Sprint(row["rows"]), 64)
+		if err != nil || n <= 0 {
+			continue
+		}
+		id := fmt.Sprint(row["id"])
+		if v, ok := selects[id]; ok {
+			selects[id] = v * n
+		} else {
+			selects[id] = n
+		}
+	}
+
+	var total float64
+	for _, v := range selects {
+		total += v
+	}
+	return int64(math.Min(total, math.MaxInt64))
+}
+
+// postgresEstimate parses the JSON plan in the single row, and replaces the rows by the parsed plan.
+func postgresEstimate(plan []map[string]any) ([]map[string]any, int64, error) {
+	if len(plan) != 1 || len(plan[0]) != 1 {
+		return plan, 0, nil
+	}
+
+	var v any
+	for _, column := range plan[0] {
+		v = column
+	}
+	var nodes []struct {
+		Plan json.RawMessage `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(fmt.Sprint(v)), &nodes); err != nil {
+		return plan, 0, fmt.Errorf("parse explain: %w", err)
+	}
+
+	var parsed []map[string]any
+	var total float64
+	for _, n := range nodes {
+		var node map[string]any
+		if err := json.Unmarshal(n.Plan, &node); err != nil {
+			return plan, 0, fmt.Errorf("parse explain: %w", err)
+		}
+		parsed = append(parsed, node)
+		total += leafRows(node)
+	}
+	return parsed, int64(math.Min(total, math.MaxInt64)), nil
+}
+
+func leafRows(node map[string]any) float64 {
+	children, _ := node["Plans"].([]any)
+	if len(children) == 0 {
+		rows, _ := node["Plan Rows"].(float64)
+		return rows
+	}
+
+	var total float64
+	for _, c := range children {
+		if child, ok := c.(map[string]any); ok {
+			total += leafRows(child)
+		}
+	}
+	return total
+}
+
+// gateExamined rejects the query when its estimated examined rows exceed the max of the options,
+// only the SELECT and WITH ones, the others like SHOW, DESC and EXPLAIN can not be explained.
+func gateExamined(ctx context.Context, db Queryer, dialect Dialect, q string, args []any) error {
+	limit := OptionsFrom(ctx).MaxExaminedRows
+	if limit <= 0 {
+		return nil
+	}
+	if first := firstWord(q); first != "select" && first != "with" {
+		return nil
+	}
+
+	plan, estimated, err := Explain(ctx, db, dialect, q, args)
+	if err != nil {
+		return err
+	}
+	if estimated > limit {
+		return &ExplainError{Estimated: estimated, Max: limit, Plan: plan}
+	}
+	return nil
+}
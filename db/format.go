@@ -0,0 +1,136 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// FormatOptions tunes FormatSQL.
+type FormatOptions struct {
+	// Indent breaks the clauses into the lines, indented by it in the subqueries, all on one line if empty.
+	Indent string
+	// Anonymize replaces the literals by ?, like SELECT * FROM t WHERE id = ?.
+	Anonymize bool
+}
+
+// FormatSQL parses the statement and prints it back in the canonical form, pretty-printed by the options.
+func FormatSQL(query string, o FormatOptions) (string, error) {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return "", err
+	}
+
+	if o.Anonymize {
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			if v, ok := node.(*sqlparser.SQLVal); ok && v.Type != sqlparser.ValArg {
+				v.Type, v.Val = sqlparser.ValArg, []byte("?")
+			}
+			return true, nil
+		}, stmt)
+	}
+
+	s := sqlString(stmt)
+	if !hasWord(query, "dual") {
+		// added by the parser to the selects without tables
+		s = strings.ReplaceAll(s, " from dual", "")
+	}
+	if o.Indent == "" {
+		return s, nil
+	}
+	return breakClauses(s, o.Indent), nil
+}
+
+// parseSQL is sqlparser.Parse, with the panics of its tokenizer on some malformed input
+// (like an unterminated comment after an identifier) turned into errors.
+func parseSQL(query string) (stmt sqlparser.Statement, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stmt, err = nil, fmt.Errorf("parse %q: %v", query, r)
+		}
+	}()
+	return sqlparser.Parse(query)
+}
+
+// positionalArg matches the ? placeholders, turned into :v1, :v2 ... by the parser.
+var positionalArg = regexp.MustCompile(`^:v[0-9]+$`)
+
+// sqlString prints the node like sqlparser.String, with the positional placeholders kept as ?,
+// so the statements rewritten still take their args.
+func sqlString(node sqlparser.SQLNode) string {
+	buf := sqlparser.NewTrackedBuffer(func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+		if v, ok := node.(*sqlparser.SQLVal); ok && v.Type == sqlparser.ValArg && positionalArg.Match(v.Val) {
+			buf.WriteArg("?")
+			return
+		}
+		node.Format(buf)
+	})
+	buf.Myprintf("%v", node)
+	return buf.String()
+}
+
+// clauseWords start the clauses broken into the lines.
+var clauseWords = map[string]bool{
+	"select": true, "from": true, "where": true, "group": true, "having": true, "order": true, "limit": true,
+	"union": true, "join": true, "straight_join": true, "left": true, "right": true, "cross": true, "natural": true,
+	"set": true, "values": true,
+}
+
+// joinPrefixes keep the join following them on the same line, like left join.
+var joinPrefixes = map[string]bool{"left": true, "right": true, "cross": true, "natural": true, "inner": true, "outer": true}
+
+// breakClauses breaks the canonical statement before the clauses of it and of its subqueries,
+// leaving the ones in the function calls like extract(year from d) in place.
+func breakClauses(s, indent string) string {
+	var b strings.Builder
+	var subqueries []bool // per open parenthesis, whether it is a subquery
+	prev := ""
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			j = min(j+1, len(s))
+			b.WriteString(s[i:j])
+			i, prev = j, ""
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			word := s[i:j]
+			depth := len(subqueries)
+			if depth > 0 && i > 0 && s[i-1] == '(' && word == "select" {
+				subqueries[depth-1] = true
+			}
+			subquery := depth == 0 || subqueries[depth-1]
+			if i > 0 && subquery && clauseWords[word] &&
+				!(word == "join" && joinPrefixes[prev]) && !(word == "set" && prev == "character") {
+				trimmed := strings.TrimRight(b.String(), " ")
+				b.Reset()
+				b.WriteString(trimmed)
+				b.WriteString("\n" + strings.Repeat(indent, depth))
+			}
+			b.WriteString(word)
+			i, prev = j, word
+		default:
+			if c == '(' {
+				subqueries = append(subqueries, false)
+			} else if c == ')' && len(subqueries) > 0 {
+				subqueries = subqueries[:len(subqueries)-1]
+			}
+			b.WriteByte(c)
+			if c != ' ' {
+				prev = ""
+			}
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"strings"
+)
+
+// scanWords visits the bare words (keywords and unquoted identifiers) of the query in order,
+// with their parentheses depth, skipping string literals, quoted identifiers and comments,
+// until visit returns false.
+func scanWords(q string, visit func(word string, pos, depth int) bool) {
+	depth := 0
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(q) && q[j] != c; j++ {
+				if q[j] == '\\' {
+					j++
+				}
+			}
+			i = j + 1
+		case c == '#' || strings.HasPrefix(q[i:], "--"):
+			j := strings.IndexByte(q[i:], '\n')
+			if j < 0 {
+				return
+			}
+			i += j + 1
+		case strings.HasPrefix(q[i:], "/*!"):
+			// MySQL executable comment, its content is part of the statement
+			for i += 3; i < len(q) && '0' <= q[i] && q[i] <= '9'; i++ {
+			}
+		case strings.HasPrefix(q[i:], "/*"):
+			j := strings.Index(q[i+2:], "*/")
+			if j < 0 {
+				return
+			}
+			i += 2 + j + 2
+		case isIdentChar(c):
+			j := i
+			for j < len(q) && isIdentChar(q[j]) {
+				j++
+			}
+			if !visit(q[i:j], i, depth) {
+				return
+			}
+			i = j
+		default:
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+			i++
+		}
+	}
+}
+
+// skipSpaceAndComments returns the position of the first token which is not a space or comment.
+func skipSpaceAndComments(q string) int {
+	for i := 0; i < len(q); {
+		switch {
+		case q[i] == ' ' || q[i] == '\t' || q[i] == '\n' || q[i] == '\r':
+			i++
+		case strings.HasPrefix(q[i:], "--") || q[i] == '#':
+			j := strings.IndexByte(q[i:], '\n')
+			if j < 0 {
+				return len(q)
+			}
+			i += j + 1
+		case strings.HasPrefix(q[i:], "/*") && !strings.HasPrefix(q[i:], "/*!"):
+			j := strings.Index(q[i+2:], "*/")
+			if j < 0 {
+				return len(q)
+			}
+			i += 2 + j + 2
+		default:
+			return i
+		}
+	}
+	return len(q)
+}
+
+// isBlank tells whether the query has nothing but spaces and comments.
+func isBlank(q string) bool {
+	return skipSpaceAndComments(q) == len(q)
+}
+
+// terminated tells whether the string literals, quoted identifiers and block comments of the query are all closed,
+// the way scanWords skips them.
+func terminated(q string) bool {
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(q) && q[j] != c; j++ {
+				if q[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(q) {
+				return false
+			}
+			i = j + 1
+		case c == '#' || strings.HasPrefix(q[i:], "--"):
+			j := strings.IndexByte(q[i:], '\n')
+			if j < 0 {
+				return true
+			}
+			i += j + 1
+		case strings.HasPrefix(q[i:], "/*!"):
+			i += 3
+		case strings.HasPrefix(q[i:], "/*"):
+			j := strings.Index(q[i+2:], "*/")
+			if j < 0 {
+				return false
+			}
+			i += 2 + j + 2
+		default:
+			i++
+		}
+	}
+	return true
+}
+
+// MultiStatement tells whether the query holds more than one statement, by a semicolon outside of
+// the string literals, quoted identifiers and comments followed by anything but spaces and comments.
+func MultiStatement(q string) bool {
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(q) && q[j] != c; j++ {
+				if q[j] == '\\' {
+					j++
+				}
+			}
+			i = j + 1
+		case c == '#' || strings.HasPrefix(q[i:], "--"):
+			j := strings.IndexByte(q[i:], '\n')
+			if j < 0 {
+				return false
+			}
+			i += j + 1
+		case strings.HasPrefix(q[i:], "/*!"):
+			i += 3
+		case strings.HasPrefix(q[i:], "/*"):
+			j := strings.Index(q[i+2:], "*/")
+			if j < 0 {
+				return false
+			}
+			i += 2 + j + 2
+		case c == ';':
+			return !isBlank(strings.TrimLeft(q[i+1:], ";"))
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+// hasWord tells whether the query contains the bare word (case-insensitive).
+func hasWord(q, word string) (found bool) {
+	scanWords(q, func(w string, _, _ int) bool {
+		found = strings.EqualFold(w, word)
+		return !found
+	})
+	return found
+}
+
+// ReturnsRows tells whether an INSERT/REPLACE/UPDATE/DELETE statement returns rows by a RETURNING clause.
+func ReturnsRows(query string) bool {
+	switch firstWord(query) {
+	case "insert", "replace", "update", "delete":
+		return hasWord(query, "returning")
+	default:
+		return false
+	}
+}
+
+// firstWord returns the first bare word of the query in lower case.
+func firstWord(q string) (first string) {
+	scanWords(q, func(w string, _, _ int) bool {
+		first = strings.ToLower(w)
+		return false
+	})
+	return first
+}
+
+// tokenFingerprint normalizes the statement by its tokens, for the ones the parser fails on: the literals turn into ?,
+// the comments are dropped, the bare words lowered and the spaces collapsed, so the fingerprint leaks no values.
+func tokenFingerprint(q string) string {
+	var b strings.Builder
+	space := false
+	emit := func(token string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(token)
+	}
+
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"':
+			j := i + 1
+			for ; j < len(q) && q[j] != c; j++ {
+				if q[j] == '\\' {
+					j++
+				}
+			}
+			emit("?")
+			i = j + 1
+		case c == '`':
+			j := strings.IndexByte(q[i+1:], '`')
+			if j < 0 {
+				emit(q[i:])
+				return b.String()
+			}
+			emit(q[i : i+1+j+1])
+			i += 1 + j + 1
+		case c == '#' || strings.HasPrefix(q[i:], "--"):
+			j := strings.IndexByte(q[i:], '\n')
+			if j < 0 {
+				return b.String()
+			}
+			i += j + 1
+			space = true
+		case strings.HasPrefix(q[i:], "/*!"):
+			// MySQL executable comment, its content is part of the statement
+			for i += 3; i < len(q) && '0' <= q[i] && q[i] <= '9'; i++ {
+			}
+			space = true
+		case strings.HasPrefix(q[i:], "/*"):
+			j := strings.Index(q[i+2:], "*/")
+			if j < 0 {
+				return b.String()
+			}
+			i += 2 + j + 2
+			space = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			space = true
+		case '0' <= c && c <= '9':
+			j := i
+			for j < len(q) && (isIdentChar(q[j]) || q[j] == '.') {
+				j++
+			}
+			emit("?")
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(q) && isIdentChar(q[j]) {
+				j++
+			}
+			emit(strings.ToLower(q[i:j]))
+			i = j
+		default:
+			emit(q[i : i+1])
+			i++
+		}
+	}
+	return b.String()
+}
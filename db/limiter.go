@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrLimited = errors.New("concurrency limited")
+
+// Priority is the class of a query, under saturation batch queries are shed first.
+type Priority string
+
+const (
+	PriorityInteractive Priority = "interactive"
+	PriorityBatch       Priority = "batch"
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context carrying the priority of the query.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority carried by the context, PriorityInteractive by default.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, _ := ctx.Value(priorityKey{}).(Priority); p == PriorityBatch {
+		return p
+	}
+	return PriorityInteractive
+}
+
+// AdaptiveLimiter limits the in-flight queries, adapting the limit by AIMD to keep their latency
+// within the target: every query finished in time increases the limit by 1/limit (about 1 per round),
+// every slow one decreases it multiplicatively by Backoff.
+// Waiting interactive queries are always granted before batch ones.
+// A nil AdaptiveLimiter does not limit.
+type AdaptiveLimiter struct {
+	Target   time.Duration
+	MinLimit int
+	MaxLimit int
+	// Backoff is the ratio to decrease the limit on slow queries, 0.9 by default.
+	Backoff float64
+	// MaxBatchWaiting is the max batch queries waiting for a slot, more are shed at once.
+	// 0 by default, which sheds batch queries as soon as the limit is reached.
+	MaxBatchWaiting int
+
+	lock         sync.Mutex
+	limit        float64
+	inflight     int
+	waiters      []chan struct{}
+	batchWaiters []chan struct{}
+}
+
+// LimiterStats is the snapshot of the limiter state.
+type LimiterStats struct {
+	Limit    int `json:"limit"`
+	InFlight int `json:"inFlight"`
+	Waiting  int `json:"waiting"`
+	// BatchWaiting is the waiting batch queries.
+	BatchWaiting int `json:"batchWaiting"`
+}
+
+func NewAdaptiveLimiter(target time.Duration, minLimit, maxLimit int) *AdaptiveLimiter {
+	minLimit = max(minLimit, 1)
+	maxLimit = max(maxLimit, minLimit)
+	return &AdaptiveLimiter{
+		Target:   target,
+		MinLimit: minLimit,
+		MaxLimit: maxLimit,
+		Backoff:  0.9,
+		limit:    float64(maxLimit),
+	}
+}
+
+// Acquire waits for a slot to run a query, until the context is done.
+// The returned release must be called when the query finishes.
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	batch := PriorityFrom(ctx) == PriorityBatch
+
+	l.lock.Lock()
+	if len(l.waiters) == 0 && (!batch || len(l.batchWaiters) == 0) && l.inflight < int(l.limit) {
+		l.inflight++
+		l.lock.Unlock()
+		return l.releaser(), nil
+	}
+
+	ch := make(chan struct{})
+	if batch {
+		if len(l.batchWaiters) >= l.MaxBatchWaiting {
+			l.lock.Unlock()
+			return nil, ErrLimited
+		}
+		l.batchWaiters = append(l.batchWaiters, ch)
+	} else {
+		l.waiters = append(l.waiters, ch)
+	}
+	l.lock.Unlock()
+
+	select {
+	case <-ch:
+		return l.releaser(), nil
+	case <-ctx.Done():
+		l.lock.Lock()
+		defer l.lock.Unlock()
+
+		if !removeWaiter(&l.waiters, ch) && !removeWaiter(&l.batchWaiters, ch) {
+			// granted at the same time, hand the slot over
+			l.inflight--
+			l.wakeLocked()
+		}
+		return nil, errors.Join(ErrLimited, ctx.Err())
+	}
+}
+
+func (l *AdaptiveLimiter) releaser() func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(time.Since(start)) })
+	}
+}
+
+func (l *AdaptiveLimiter) release(latency time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inflight--
+	if latency > l.Target {
+		l.limit = max(float64(l.MinLimit), l.limit*l.Backoff)
+	} else {
+		l.limit = min(float64(l.MaxLimit), l.limit+1/l.limit)
+	}
+	l.wakeLocked()
+}
+
+func (l *AdaptiveLimiter) wakeLocked() {
+	for l.inflight < int(l.limit) {
+		var ch chan struct{}
+		switch {
+		case len(l.waiters) > 0:
+			ch, l.waiters = l.waiters[0], l.waiters[1:]
+		case len(l.batchWaiters) > 0:
+			ch, l.batchWaiters = l.batchWaiters[0], l.batchWaiters[1:]
+		default:
+			return
+		}
+		l.inflight++
+		close(ch)
+	}
+}
+
+func removeWaiter(waiters *[]chan struct{}, ch chan struct{}) bool {
+	for i, w := range *waiters {
+		if w == ch {
+			*waiters = append((*waiters)[:i], (*waiters)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *AdaptiveLimiter) Stats() LimiterStats {
+	if l == nil {
+		return LimiterStats{}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return LimiterStats{
+		Limit:        int(l.limit),
+		InFlight:     l.inflight,
+		Waiting:      len(l.waiters),
+		BatchWaiting: len(l.batchWaiters),
+	}
+}
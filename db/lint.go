@@ -0,0 +1,208 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// LintRule checks a parsed statement, and returns the warnings of it.
+type LintRule func(stmt sqlparser.Statement) []string
+
+// The built-in lint rules.
+const (
+	LintSelectStar  = "select-star"
+	LintNoWhere     = "no-where"
+	LintCrossJoin   = "cross-join"
+	LintNonSargable = "non-sargable"
+)
+
+var (
+	lintRulesLock sync.RWMutex
+	lintRules     = map[string]LintRule{
+		LintSelectStar:  lintSelectStar,
+		LintNoWhere:     lintNoWhere,
+		LintCrossJoin:   lintCrossJoin,
+		LintNonSargable: lintNonSargable,
+	}
+)
+
+// UseLintRule registers a lint rule by name, to be enabled by Options.Lint.
+func UseLintRule(name string, rule LintRule) {
+	lintRulesLock.Lock()
+	defer lintRulesLock.Unlock()
+
+	lintRules[name] = rule
+}
+
+// LintRuleNames returns the names of the registered lint rules, sorted.
+func LintRuleNames() []string {
+	lintRulesLock.RLock()
+	defer lintRulesLock.RUnlock()
+
+	names := make([]string, 0, len(lintRules))
+	for name := range lintRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lint checks the query by the rules named, all for all the registered ones,
+// the warnings are prefixed by the rule names. The queries failing to parse, like in other dialects, are not checked.
+func Lint(query string, names ...string) ([]string, error) {
+	lintRulesLock.RLock()
+	checks := map[string]LintRule{}
+	for _, name := range names {
+		if name == "all" {
+			for n, r := range lintRules {
+				checks[n] = r
+			}
+			continue
+		}
+		r, ok := lintRules[name]
+		if !ok {
+			lintRulesLock.RUnlock()
+			return nil, fmt.Errorf("unknown lint rule %s, available: %v", name, LintRuleNames())
+		}
+		checks[name] = r
+	}
+	lintRulesLock.RUnlock()
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return nil, nil
+	}
+
+	rules := make([]string, 0, len(checks))
+	for name := range checks {
+		rules = append(rules, name)
+	}
+	sort.Strings(rules)
+	var warnings []string
+	for _, name := range rules {
+		for _, w := range checks[name](stmt) {
+			warnings = append(warnings, "lint "+name+": "+w)
+		}
+	}
+	return warnings, nil
+}
+
+func lintSelectStar(stmt sqlparser.Statement) (warnings []string) {
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if _, ok := node.(*sqlparser.StarExpr); ok {
+			warnings = []string{"SELECT * is discouraged, list the columns"}
+			return false, nil
+		}
+		return warnings == nil, nil
+	}, stmt)
+	return warnings
+}
+
+func lintNoWhere(stmt sqlparser.Statement) []string {
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		if s.Where == nil {
+			return []string{"UPDATE without WHERE changes all the rows"}
+		}
+	case *sqlparser.Delete:
+		if s.Where == nil {
+			return []string{"DELETE without WHERE removes all the rows"}
+		}
+	}
+	return nil
+}
+
+// lintCrossJoin warns the joins without conditions, and the tables listed by commas
+// without a WHERE equality between their columns.
+func lintCrossJoin(stmt sqlparser.Statement) (warnings []string) {
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch n := node.(type) {
+		case *sqlparser.JoinTableExpr:
+			if n.Join == sqlparser.JoinStr && n.Condition.On == nil && len(n.Condition.Using) == 0 {
+				warnings = append(warnings, fmt.Sprintf("JOIN without ON or USING is a cross join: %s", sqlparser.String(n)))
+			}
+		case *sqlparser.Select:
+			if len(n.From) > 1 && !joinsTables(n.Where) {
+				warnings = append(warnings, fmt.Sprintf("tables %s are cross joined, without a WHERE condition between them", sqlparser.String(n.From)))
+			}
+		}
+		return true, nil
+	}, stmt)
+	return warnings
+}
+
+// joinsTables tells whether the where has an equality between the columns of different tables.
+func joinsTables(where *sqlparser.Where) (joined bool) {
+	if where == nil {
+		return false
+	}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		c, ok := node.(*sqlparser.ComparisonExpr)
+		if !ok || c.Operator != sqlparser.EqualStr {
+			return true, nil
+		}
+		l, lok := c.Left.(*sqlparser.ColName)
+		r, rok := c.Right.(*sqlparser.ColName)
+		if lok && rok && !l.Qualifier.IsEmpty() && l.Qualifier != r.Qualifier {
+			joined = true
+			return false, nil
+		}
+		return true, nil
+	}, where)
+	return joined
+}
+
+// lintNonSargable warns the WHERE conditions which can not use the indexes on the columns,
+// like the functions or arithmetic on the columns, and the LIKE patterns with a leading wildcard.
+func lintNonSargable(stmt sqlparser.Statement) (warnings []string) {
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		where, ok := node.(*sqlparser.Where)
+		if !ok || where == nil {
+			return true, nil
+		}
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			if _, ok := node.(*sqlparser.Subquery); ok {
+				// checked by the outer walk
+				return false, nil
+			}
+			c, ok := node.(*sqlparser.ComparisonExpr)
+			if !ok {
+				return true, nil
+			}
+			for _, side := range []sqlparser.Expr{c.Left, c.Right} {
+				switch side.(type) {
+				case *sqlparser.FuncExpr, *sqlparser.BinaryExpr, *sqlparser.ConvertExpr, *sqlparser.UnaryExpr:
+					if hasColumn(side) {
+						warnings = append(warnings, fmt.Sprintf("%s wraps a column, which can not use its index", sqlparser.String(side)))
+					}
+				}
+			}
+			if c.Operator == sqlparser.LikeStr {
+				if v, ok := c.Right.(*sqlparser.SQLVal); ok && v.Type == sqlparser.StrVal && strings.HasPrefix(string(v.Val), "%") {
+					warnings = append(warnings, fmt.Sprintf("LIKE '%s' with a leading wildcard can not use the index", v.Val))
+				}
+			}
+			return true, nil
+		}, where.Expr)
+		return true, nil
+	}, stmt)
+	return warnings
+}
+
+func hasColumn(expr sqlparser.Expr) (found bool) {
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if _, ok := node.(*sqlparser.ColName); ok {
+			found = true
+			return false, nil
+		}
+		return true, nil
+	}, expr)
+	return found
+}
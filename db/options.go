@@ -0,0 +1,233 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// ErrorHook observes the errors which are ignored or turned into warnings, nil by default.
+var ErrorHook func(ctx context.Context, err error)
+
+func reportError(ctx context.Context, err error) {
+	if hook := ErrorHook; hook != nil {
+		hook(ctx, err)
+	}
+}
+
+// QueryObserver observes every statement run by RunSQL, e.g. for metrics.
+type QueryObserver func(ctx context.Context, query string, result *QueryResult, cost time.Duration)
+
+var (
+	queryObserversLock sync.RWMutex
+	queryObservers     []QueryObserver
+)
+
+// UseQueryObserver adds observers of the statements run by RunSQL.
+func UseQueryObserver(o ...QueryObserver) {
+	queryObserversLock.Lock()
+	defer queryObserversLock.Unlock()
+
+	queryObservers = append(queryObservers, o...)
+}
+
+func observeQuery(ctx context.Context, query string, result *QueryResult, cost time.Duration) {
+	queryObserversLock.RLock()
+	observers := queryObservers
+	queryObserversLock.RUnlock()
+
+	for _, o := range observers {
+		o(ctx, query, result, cost)
+	}
+}
+
+// Options tunes how statements are run and their results rendered,
+// they are usually configured per database.
+type Options struct {
+	// Dialect overrides the one detected by the driver.
+	Dialect Dialect `json:"dialect,omitempty"`
+	// Limit is the default max rows of a result, 30 if not set.
+	Limit int `json:"limit,omitempty"`
+	// MaxBytes bounds the approximate size of the values of a result, the rows beyond are cut, no limit if not set.
+	MaxBytes int `json:"maxBytes,omitempty"`
+	// Timeout of a statement run by RunSQL, no timeout if not set.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Unquoted emits strings as is, instead of single-quoted.
+	Unquoted bool `json:"unquoted,omitempty"`
+	// TimeFormat is the layout of date and time values, like time.RFC3339,
+	// if not set, the shortest of 2006-01-02, 2006-01-02 15:04:05 and 2006-01-02 15:04:05.999999999 is used.
+	TimeFormat string `json:"timeFormat,omitempty"`
+
+	// DuplicateColumns is the policy of duplicate column names, DuplicateSuffix by default.
+	DuplicateColumns DuplicatePolicy `json:"duplicateColumns,omitempty"`
+	// BigIntAsString emits integers beyond ±2^53 as strings,
+	// which JavaScript consumers would otherwise corrupt.
+	BigIntAsString bool `json:"bigIntAsString,omitempty"`
+	// Charset is the source charset (like latin1, gbk) of text which is not valid UTF-8,
+	// such text is transcoded to UTF-8 before being emitted.
+	Charset string `json:"charset,omitempty"`
+	// InvalidTextAsBase64 emits text which still can not be transcoded as Base64Value.
+	InvalidTextAsBase64 bool `json:"invalidTextAsBase64,omitempty"`
+	// MaxExaminedRows rejects the queries whose rows examined estimated by EXPLAIN exceed it, no limit if not set.
+	MaxExaminedRows int64 `json:"maxExaminedRows,omitempty"`
+	// DryRun counts the rows the UPDATE/DELETE statements would affect, instead of running them, see DryRunSQL.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Undo captures the pre-image of the rows the UPDATE/DELETE statements affect in their transactions,
+	// into the statements reverting them, see QueryResult.Undo.
+	Undo bool `json:"undo,omitempty"`
+	// Position captures the replication position (GTID set, binlog position or LSN) after the writes, see WritePosition.
+	Position bool `json:"position,omitempty"`
+	// Lint names the rules to check the statements by, like select-star and no-where, or all, see Lint.
+	Lint []string `json:"lint,omitempty"`
+	// Strict fails the statement when the pre-checks (like ping, lint and undo) fail, instead of warning.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// RowLimit returns the default max rows of a result.
+func (o *Options) RowLimit() int {
+	if o == nil || o.Limit <= 0 {
+		return 30
+	}
+	return o.Limit
+}
+
+func (o *Options) dialect(dba any) Dialect {
+	if o != nil && o.Dialect != DialectUnknown {
+		return o.Dialect
+	}
+	return DetectDialect(dba)
+}
+
+// maxSafeInt is the max integer which float64 (and then JavaScript number) holds exactly.
+const maxSafeInt = 1<<53 - 1
+
+func (o *Options) safeInt(v any) any {
+	if o == nil || !o.BigIntAsString {
+		return v
+	}
+
+	switch i := v.(type) {
+	case int64:
+		if i > maxSafeInt || i < -maxSafeInt {
+			return strconv.FormatInt(i, 10)
+		}
+	case int:
+		if i > maxSafeInt || i < -maxSafeInt {
+			return strconv.Itoa(i)
+		}
+	case uint64:
+		if i > maxSafeInt {
+			return strconv.FormatUint(i, 10)
+		}
+	case uint:
+		if i > maxSafeInt {
+			return strconv.FormatUint(uint64(i), 10)
+		}
+	}
+	return v
+}
+
+type optionsKey struct{}
+
+// WithOptions returns a context carrying the options for RunSQL, Query and Exec.
+func WithOptions(ctx context.Context, options *Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, options)
+}
+
+// OptionsFrom returns the options carried by the context, or the default ones.
+func OptionsFrom(ctx context.Context) *Options {
+	if ctx != nil {
+		if options, _ := ctx.Value(optionsKey{}).(*Options); options != nil {
+			return options
+		}
+	}
+	return &Options{}
+}
+
+// DuplicatePolicy is the policy of duplicate column names in a result.
+type DuplicatePolicy string
+
+const (
+	// DuplicateSuffix suffixes the later duplicates with their occurrence number, like id, id_2.
+	DuplicateSuffix DuplicatePolicy = "suffix"
+	// DuplicateQualify qualifies the duplicates with their table names resolved by the parser,
+	// like t1.id, t2.id, and falls back to suffixing when the parser can not tell.
+	DuplicateQualify DuplicatePolicy = "qualify"
+	// DuplicateError fails the query.
+	DuplicateError DuplicatePolicy = "error"
+)
+
+// ResolveColumns applies the policy to the column names of the query result.
+func ResolveColumns(columns []string, query string, policy DuplicatePolicy) ([]string, error) {
+	counts := make(map[string]int, len(columns))
+	var duplicates []string
+	for _, c := range columns {
+		if counts[c]++; counts[c] == 2 {
+			duplicates = append(duplicates, c)
+		}
+	}
+	if len(duplicates) == 0 {
+		return columns, nil
+	}
+
+	switch policy {
+	case DuplicateError:
+		return nil, fmt.Errorf("duplicate column names: %s", strings.Join(duplicates, ", "))
+	case DuplicateQualify:
+		columns = qualifyColumns(columns, counts, query)
+	}
+
+	return DedupColumns(columns), nil
+}
+
+func qualifyColumns(columns []string, counts map[string]int, query string) []string {
+	parsed, err := parseSQL(query)
+	if err != nil {
+		return columns
+	}
+	sel, ok := parsed.(*sqlparser.Select)
+	if !ok || len(sel.SelectExprs) != len(columns) {
+		return columns
+	}
+
+	// table aliases to table names
+	tables := map[string]string{}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch n := node.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if t, ok := n.Expr.(sqlparser.TableName); ok {
+				tables[t.Name.String()] = t.Name.String()
+				if !n.As.IsEmpty() {
+					tables[n.As.String()] = t.Name.String()
+				}
+			}
+			return false, nil
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return true, nil
+	}, sel.From)
+
+	qualified := make([]string, len(columns))
+	copy(qualified, columns)
+	for i, expr := range sel.SelectExprs {
+		aliased, ok := expr.(*sqlparser.AliasedExpr)
+		if !ok || counts[columns[i]] < 2 || !aliased.As.IsEmpty() {
+			continue
+		}
+		col, ok := aliased.Expr.(*sqlparser.ColName)
+		if !ok || col.Qualifier.IsEmpty() {
+			continue
+		}
+		if table, ok := tables[col.Qualifier.Name.String()]; ok {
+			qualified[i] = table + "." + columns[i]
+		}
+	}
+
+	return qualified
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// PoolMonitor turns the cumulative wait statistics of a *sql.DB into a live signal:
+// the average time to wait for a connection in the recent sampling interval.
+type PoolMonitor struct {
+	DB       *sql.DB
+	Interval time.Duration
+
+	lock         sync.Mutex
+	lastSample   time.Time
+	lastCount    int64
+	lastDuration time.Duration
+	recentWait   time.Duration
+}
+
+// PoolStats is the snapshot of the pool statistics.
+type PoolStats struct {
+	sql.DBStats
+	// RecentWait is the average wait for a connection in the recent sampling interval.
+	RecentWait time.Duration `json:"recentWait"`
+	// Saturated tells all the connections are in use.
+	Saturated bool `json:"saturated"`
+}
+
+func NewPoolMonitor(sdb *sql.DB, interval time.Duration) *PoolMonitor {
+	return &PoolMonitor{DB: sdb, Interval: interval}
+}
+
+// Stats samples the pool statistics, the recent wait is refreshed at most once per interval.
+func (p *PoolMonitor) Stats() PoolStats {
+	stats := p.DB.Stats()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if now := time.Now(); now.Sub(p.lastSample) >= p.Interval {
+		if count := stats.WaitCount - p.lastCount; count > 0 {
+			p.recentWait = (stats.WaitDuration - p.lastDuration) / time.Duration(count)
+		} else {
+			p.recentWait = 0
+		}
+		p.lastSample, p.lastCount, p.lastDuration = now, stats.WaitCount, stats.WaitDuration
+	}
+
+	return PoolStats{
+		DBStats:    stats,
+		RecentWait: p.recentWait,
+		Saturated:  stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections,
+	}
+}
+
+// Overloaded tells whether new statements should be shed: the pool is saturated,
+// and the recent wait for a connection exceeds the threshold.
+func (p *PoolMonitor) Overloaded(threshold time.Duration) bool {
+	stats := p.Stats()
+	return threshold > 0 && stats.Saturated && stats.RecentWait > threshold
+}
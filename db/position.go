@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// WritePosition returns the replication position of the database after a write, by the same connection:
+// the GTID set executed by MySQL in GTID mode, or else its binlog file:position, and the WAL LSN of Postgres.
+// It is the position of the server, the concurrent writes of the others before it are included.
+func WritePosition(ctx context.Context, db Queryer, dialect Dialect) (string, error) {
+	switch dialect {
+	case DialectPostgres:
+		return singleValue(ctx, db, "SELECT pg_current_wal_lsn()::text")
+	case DialectMySQL, DialectUnknown:
+		gtid, err := singleValue(ctx, db, "SELECT @@GLOBAL.gtid_executed")
+		if err != nil || gtid != "" {
+			// the GTID sets of the multiple sources are separated by the new lines
+			return strings.ReplaceAll(gtid, "\n", ""), err
+		}
+
+		// SHOW MASTER STATUS is renamed since MySQL 8.4
+		values, err := firstRow(ctx, db, "SHOW MASTER STATUS")
+		if err != nil {
+			values, err = firstRow(ctx, db, "SHOW BINARY LOG STATUS")
+		}
+		if err != nil || len(values) < 2 {
+			return "", err
+		}
+		return values[0] + ":" + values[1], nil
+	default:
+		return "", fmt.Errorf("write position of dialect %s unsupported", dialect)
+	}
+}
+
+func singleValue(ctx context.Context, db Queryer, q string) (string, error) {
+	values, err := firstRow(ctx, db, q)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	return values[0], nil
+}
+
+// firstRow queries the values of the first row in text, none if no rows.
+func firstRow(ctx context.Context, db Queryer, q string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	raw := make([]sql.NullString, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range raw {
+		pointers[i] = &raw[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(raw))
+	for i, v := range raw {
+		values[i] = v.String
+	}
+	return values, nil
+}
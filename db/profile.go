@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ColumnProfile is the statistics of a column in the sampled rows.
+type ColumnProfile struct {
+	Name     string  `json:"name"`
+	NullRate float64 `json:"nullRate"`
+	// Distinct is the distinct values in the sample, a lower bound of the ones in the table.
+	Distinct  int          `json:"distinct"`
+	Min       any          `json:"min,omitempty"`
+	Max       any          `json:"max,omitempty"`
+	TopValues []ValueCount `json:"topValues,omitempty"`
+	// Format is inferred from the values: int, float, bool, date, datetime, uuid, email, json or text.
+	Format string `json:"format,omitempty"`
+}
+
+// ValueCount is a value and its occurrences.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// TableProfile is the profile of a table by the sampled rows.
+type TableProfile struct {
+	Table   string          `json:"table"`
+	Rows    int             `json:"rows"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// ProfileTable samples up to size rows (1000 by default) of the table, the random ones if random,
+// or else the first ones, and profiles its columns. The sample is read by RunSQL, see ProfileSQL.
+func ProfileTable(ctx context.Context, db DB, dialect Dialect, table string, size int, random bool) (*TableProfile, error) {
+	q, err := ProfileSQL(dialect, table, size, random)
+	if err != nil {
+		return nil, err
+	}
+	header, sample, err := collectRows(ctx, db, q, nil)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", table, err)
+	}
+	return &TableProfile{Table: table, Rows: len(sample), Columns: ProfileRows(header, sample, 5)}, nil
+}
+
+// ProfileSQL is the SELECT of the sample of ProfileTable.
+func ProfileSQL(dialect Dialect, table string, size int, random bool) (string, error) {
+	if size <= 0 {
+		size = 1000
+	}
+	quoted, err := quoteIdent(dialect, table)
+	if err != nil {
+		return "", err
+	}
+
+	order := ""
+	switch {
+	case random && dialect == DialectPostgres:
+		order = " ORDER BY random()"
+	case random:
+		order = " ORDER BY RAND()"
+	}
+	return "SELECT * FROM " + quoted + order + " LIMIT " + strconv.Itoa(size), nil
+}
+
+// ProfileRows profiles the columns of the rows, with up to top values of each.
+func ProfileRows(header []string, rows [][]any, top int) []ColumnProfile {
+	profiles := make([]ColumnProfile, len(header))
+	for i, name := range header {
+		var values []any
+		for _, row := range rows {
+			values = append(values, row[i])
+		}
+		profiles[i] = profileColumn(name, values, top)
+	}
+	return profiles
+}
+
+func profileColumn(name string, values []any, top int) ColumnProfile {
+	p := ColumnProfile{Name: name}
+	counts := map[string]int{}
+	var nonNull []string
+	nulls := 0
+	for _, v := range values {
+		if v == nil {
+			nulls++
+			continue
+		}
+		s := fmt.Sprint(v)
+		if t, ok := v.(time.Time); ok {
+			s = t.Format(time.RFC3339Nano)
+		}
+		counts[s]++
+		nonNull = append(nonNull, s)
+	}
+	if len(values) > 0 {
+		p.NullRate = float64(nulls) / float64(len(values))
+	}
+	p.Distinct = len(counts)
+	if len(nonNull) == 0 {
+		return p
+	}
+
+	p.Format = inferFormat(nonNull)
+	p.Min, p.Max = minMax(nonNull, p.Format == "int" || p.Format == "float")
+
+	for v, n := range counts {
+		p.TopValues = append(p.TopValues, ValueCount{Value: v, Count: n})
+	}
+	sort.Slice(p.TopValues, func(i, j int) bool {
+		a, b := p.TopValues[i], p.TopValues[j]
+		return a.Count > b.Count || a.Count == b.Count && a.Value < b.Value
+	})
+	if len(p.TopValues) > top {
+		p.TopValues = p.TopValues[:top]
+	}
+	return p
+}
+
+func minMax(values []string, numeric bool) (lo, hi any) {
+	if numeric {
+		minF, maxF := 0.0, 0.0
+		for i, v := range values {
+			f, _ := strconv.ParseFloat(v, 64)
+			if i == 0 || f < minF {
+				minF = f
+			}
+			if i == 0 || f > maxF {
+				maxF = f
+			}
+		}
+		return minF, maxF
+	}
+
+	minS, maxS := values[0], values[0]
+	for _, v := range values[1:] {
+		minS, maxS = min(minS, v), max(maxS, v)
+	}
+	return minS, maxS
+}
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	formats     = []struct {
+		name  string
+		match func(string) bool
+	}{
+		{"int", func(s string) bool { _, err := strconv.ParseInt(s, 10, 64); return err == nil }},
+		{"float", func(s string) bool { _, err := strconv.ParseFloat(s, 64); return err == nil }},
+		{"bool", func(s string) bool { _, err := strconv.ParseBool(s); return err == nil }},
+		{"date", func(s string) bool { _, err := time.Parse(time.DateOnly, s); return err == nil }},
+		{"datetime", func(s string) bool {
+			for _, layout := range []string{time.DateTime, time.RFC3339Nano, "2006-01-02 15:04:05.999999999"} {
+				if _, err := time.Parse(layout, s); err == nil {
+					return true
+				}
+			}
+			return false
+		}},
+		{"uuid", uuidPattern.MatchString},
+		{"email", func(s string) bool { a, err := mail.ParseAddress(s); return err == nil && a.Address == s }},
+		{"json", func(s string) bool { return len(s) > 1 && (s[0] == '{' || s[0] == '[') && json.Valid([]byte(s)) }},
+	}
+)
+
+// inferFormat returns the first format all the values match, or text.
+func inferFormat(values []string) string {
+	for _, f := range formats {
+		matched := true
+		for _, v := range values {
+			if !f.match(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return f.name
+		}
+	}
+	return "text"
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueryDigest is the totals of the statements of a fingerprint in the window of the QueryStats.
+type QueryDigest struct {
+	// Fingerprint is the statement with the literals anonymized, by its tokens if it fails to parse.
+	Fingerprint string `json:"fingerprint"`
+	Count       int    `json:"count"`
+	Errors      int    `json:"errors"`
+	// Rows are the rows read by the queries, or affected by the execs.
+	Rows int64 `json:"rows"`
+	// TotalLatency orders the digests, the heaviest first, P95Latency is estimated within 12.5%.
+	TotalLatency time.Duration `json:"totalLatency"`
+	AvgLatency   time.Duration `json:"avgLatency"`
+	P95Latency   time.Duration `json:"p95Latency"`
+	MaxLatency   time.Duration `json:"maxLatency"`
+	LastSeen     time.Time     `json:"lastSeen"`
+}
+
+// the slots of the sliding window, and the latency buckets growing by 1.25 from 10µs up to about 100s
+const (
+	statsSlots     = 10
+	latencyBuckets = 72
+	latencyBase    = 10 * time.Microsecond
+	latencyGrowth  = 1.25
+)
+
+// QueryStats summarizes the statements run by RunSQL per fingerprint over a sliding window in memory,
+// like the digests of performance_schema, observed by UseQueryObserver(stats.Observe).
+type QueryStats struct {
+	window time.Duration
+	max    int
+
+	lock    sync.Mutex
+	digests map[string]*queryDigest
+}
+
+type queryDigest struct {
+	slots    [statsSlots]digestSlot
+	lastSeen time.Time
+}
+
+// digestSlot is the totals of a slot of the window, the epoch tells which one it is.
+type digestSlot struct {
+	epoch         int64
+	count, errors int
+	rows          int64
+	total, max    time.Duration
+	latencies     [latencyBuckets]uint32
+}
+
+// NewQueryStats creates the QueryStats over the window (5m by default), of up to size fingerprints (1000 by default),
+// the new ones are skipped when full until the idle ones slide out of the window.
+func NewQueryStats(window time.Duration, size int) *QueryStats {
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	if size <= 0 {
+		size = 1000
+	}
+	return &QueryStats{window: window, max: size, digests: map[string]*queryDigest{}}
+}
+
+// Observe is the QueryObserver summarizing the statements.
+func (s *QueryStats) Observe(_ context.Context, query string, result *QueryResult, cost time.Duration) {
+	fingerprint, err := FormatSQL(query, FormatOptions{Anonymize: true})
+	if err != nil {
+		fingerprint = tokenFingerprint(query)
+	}
+	now := time.Now()
+	epoch := s.epoch(now)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	d := s.digests[fingerprint]
+	if d == nil {
+		if len(s.digests) >= s.max && !s.evict(epoch) {
+			return
+		}
+		d = &queryDigest{}
+		s.digests[fingerprint] = d
+	}
+
+	slot := &d.slots[epoch%statsSlots]
+	if slot.epoch != epoch {
+		*slot = digestSlot{epoch: epoch}
+	}
+	slot.count++
+	if result.Error != "" {
+		slot.errors++
+	}
+	slot.rows += int64(result.RowCount)
+	slot.total += cost
+	slot.max = max(slot.max, cost)
+	slot.latencies[latencyBucket(cost)]++
+	d.lastSeen = now
+}
+
+// Stats returns the digests of the window, the heaviest by the total latency first.
+func (s *QueryStats) Stats() []QueryDigest {
+	epoch := s.epoch(time.Now())
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	digests := make([]QueryDigest, 0, len(s.digests))
+	for fingerprint, d := range s.digests {
+		q := QueryDigest{Fingerprint: fingerprint, LastSeen: d.lastSeen}
+		var latencies [latencyBuckets]uint32
+		for _, slot := range d.slots {
+			if epoch-slot.epoch >= statsSlots {
+				continue
+			}
+			q.Count += slot.count
+			q.Errors += slot.errors
+			q.Rows += slot.rows
+			q.TotalLatency += slot.total
+			q.MaxLatency = max(q.MaxLatency, slot.max)
+			for i, n := range slot.latencies {
+				latencies[i] += n
+			}
+		}
+		if q.Count == 0 {
+			continue
+		}
+		q.AvgLatency = q.TotalLatency / time.Duration(q.Count)
+		q.P95Latency = min(percentile(latencies, q.Count, 0.95), q.MaxLatency)
+		digests = append(digests, q)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		if digests[i].TotalLatency != digests[j].TotalLatency {
+			return digests[i].TotalLatency > digests[j].TotalLatency
+		}
+		return digests[i].Fingerprint < digests[j].Fingerprint
+	})
+	return digests
+}
+
+// Reset drops all the digests.
+func (s *QueryStats) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.digests = map[string]*queryDigest{}
+}
+
+// epoch is the index of the slot of the time since the Unix epoch.
+func (s *QueryStats) epoch(t time.Time) int64 {
+	return t.UnixNano() / int64(s.window/statsSlots)
+}
+
+// evict drops the digests slid out of the window, and tells whether any is dropped, called under the lock.
+func (s *QueryStats) evict(epoch int64) bool {
+	evicted := false
+	for fingerprint, d := range s.digests {
+		idle := true
+		for _, slot := range d.slots {
+			idle = idle && epoch-slot.epoch >= statsSlots
+		}
+		if idle {
+			delete(s.digests, fingerprint)
+			evicted = true
+		}
+	}
+	return evicted
+}
+
+func latencyBucket(d time.Duration) int {
+	if d <= latencyBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(latencyBase)) / math.Log(latencyGrowth)))
+	return min(i, latencyBuckets-1)
+}
+
+// percentile returns the upper bound of the bucket of the percentile.
+func percentile(latencies [latencyBuckets]uint32, count int, p float64) time.Duration {
+	rank := uint32(math.Ceil(float64(count) * p))
+	var seen uint32
+	for i, n := range latencies {
+		if seen += n; seen >= rank {
+			return time.Duration(float64(latencyBase) * math.Pow(latencyGrowth, float64(i)))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Stmt is a statement on its way to the database.
+type Stmt struct {
+	// Ctx is the context of the request which issued the statement,
+	// rewriters can pick request scoped values (like tenant) from it.
+	Ctx     context.Context
+	Dialect Dialect
+	Query   string
+	Args    []any
+	// Timeout is the execution time limit of the statement on the server, like by DeadlineHint,
+	// set on the pinned connection before the statement and reset after it.
+	Timeout time.Duration
+}
+
+// Rewriter rewrites a statement before it is executed,
+// or rejects it by returning an error.
+type Rewriter func(Stmt) (Stmt, error)
+
+// Chain composes the rewriters into one, which applies them in order.
+func Chain(rewriters ...Rewriter) Rewriter {
+	return func(stmt Stmt) (Stmt, error) {
+		for _, r := range rewriters {
+			var err error
+			if stmt, err = r(stmt); err != nil {
+				return stmt, err
+			}
+		}
+		return stmt, nil
+	}
+}
+
+var (
+	rewritersLock sync.RWMutex
+	rewriters     []Rewriter
+)
+
+// UseRewriter appends rewriters to the chain applied by RunSQL.
+func UseRewriter(r ...Rewriter) {
+	rewritersLock.Lock()
+	defer rewritersLock.Unlock()
+
+	rewriters = append(rewriters, r...)
+}
+
+// Rewrite applies the registered rewriters to the statement.
+func Rewrite(stmt Stmt) (Stmt, error) {
+	rewritersLock.RLock()
+	chain := Chain(rewriters...)
+	rewritersLock.RUnlock()
+
+	return chain(stmt)
+}
+
+// StripComments removes comments from the statement,
+// optimizer hints (/*+ ... */) and MySQL executable comments (/*! ... */) are kept.
+func StripComments(stmt Stmt) (Stmt, error) {
+	stmt.Query = strings.TrimSpace(stripComments(stmt.Query))
+	return stmt, nil
+}
+
+func stripComments(q string) string {
+	var b strings.Builder
+	for i := 0; i < len(q); i++ {
+		switch c := q[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(q) && q[j] != c; j++ {
+				if q[j] == '\\' {
+					j++
+				}
+			}
+			b.WriteString(q[i:min(j+1, len(q))])
+			i = j
+		case c == '#' || c == '-' && strings.HasPrefix(q[i:], "-- "):
+			j := strings.IndexByte(q[i:], '\n')
+			if j < 0 {
+				return b.String()
+			}
+			b.WriteByte('\n')
+			i += j
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			j := strings.Index(q[i+2:], "*/")
+			if j < 0 {
+				return b.String()
+			}
+			end := i + 2 + j + 2
+			if strings.HasPrefix(q[i:], "/*+") || strings.HasPrefix(q[i:], "/*!") {
+				b.WriteString(q[i:end])
+			} else {
+				b.WriteByte(' ')
+			}
+			i = end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// DenyFunctions rejects statements which call any of the functions (case-insensitive).
+func DenyFunctions(names ...string) Rewriter {
+	denied := make(map[string]bool, len(names))
+	for _, name := range names {
+		denied[strings.ToLower(name)] = true
+	}
+
+	return func(stmt Stmt) (Stmt, error) {
+		if fn := findFunction(stmt.Query, denied); fn != "" {
+			return stmt, fmt.Errorf("function %s is denied", fn)
+		}
+		return stmt, nil
+	}
+}
+
+var funcCallRegexp = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*\(`)
+
+func findFunction(query string, denied map[string]bool) (found string) {
+	parsed, err := parseSQL(query)
+	if err != nil {
+		// the parser does not know every dialect, fallback to the lexical way
+		for _, m := range funcCallRegexp.FindAllStringSubmatch(stripComments(query), -1) {
+			if denied[strings.ToLower(m[1])] {
+				return m[1]
+			}
+		}
+		return ""
+	}
+
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if f, ok := node.(*sqlparser.FuncExpr); ok && denied[f.Name.Lowered()] {
+			found = f.Name.String()
+			return false, nil
+		}
+		return found == "", nil
+	}, parsed)
+
+	return found
+}
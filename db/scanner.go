@@ -0,0 +1,317 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ScannerFactory creates a RowsScanner for the rows window (offset, limit).
+type ScannerFactory func(offset, limit int) RowsScanner
+
+var (
+	scannersLock sync.RWMutex
+	scanners     = map[string]ScannerFactory{
+		"json":  func(offset, limit int) RowsScanner { return NewJsonRowsScanner(offset, limit) },
+		"csv":   func(offset, limit int) RowsScanner { return NewCsvRowsScanner(offset, limit) },
+		"array": func(offset, limit int) RowsScanner { return NewArrayRowsScanner(offset, limit) },
+	}
+)
+
+// RegisterScanner registers the factory of the output format, replacing the existing one.
+func RegisterScanner(format string, factory ScannerFactory) {
+	scannersLock.Lock()
+	defer scannersLock.Unlock()
+
+	scanners[format] = factory
+}
+
+// NewScanner creates a RowsScanner of the registered output format.
+func NewScanner(format string, offset, limit int) (RowsScanner, error) {
+	scannersLock.RLock()
+	factory, ok := scanners[format]
+	scannersLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return factory(offset, limit), nil
+}
+
+// ScannerFormats returns the registered output formats, sorted.
+func ScannerFormats() []string {
+	scannersLock.RLock()
+	defer scannersLock.RUnlock()
+
+	formats := make([]string, 0, len(scanners))
+	for format := range scanners {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// DedupColumns disambiguates duplicate column names (e.g. two id columns from a join)
+// by suffixing the later ones with their occurrence number, like id, id_2.
+func DedupColumns(header []string) []string {
+	seen := make(map[string]bool, len(header))
+	for _, h := range header {
+		seen[h] = true
+	}
+
+	deduped := make([]string, len(header))
+	counts := make(map[string]int, len(header))
+	for i, h := range header {
+		counts[h]++
+		if counts[h] == 1 {
+			deduped[i] = h
+			continue
+		}
+
+		name := fmt.Sprintf("%s_%d", h, counts[h])
+		for ; seen[name]; counts[h]++ {
+			name = fmt.Sprintf("%s_%d", h, counts[h]+1)
+		}
+		seen[name] = true
+		deduped[i] = name
+	}
+	return deduped
+}
+
+// ArrayRowsScanner keeps the rows as arrays in the column order, along with the header.
+type ArrayRowsScanner struct {
+	start         time.Time
+	Header        []string
+	Limit, Offset int
+
+	Values [][]any
+}
+
+func NewArrayRowsScanner(offset, limit int) *ArrayRowsScanner {
+	return &ArrayRowsScanner{Limit: limit, Offset: offset}
+}
+
+func (a *ArrayRowsScanner) StartExecute() {
+	a.start = time.Now()
+}
+
+func (a *ArrayRowsScanner) StartRows(header []string) {
+	a.Header = DedupColumns(header)
+}
+
+func (a *ArrayRowsScanner) AddRow(rowIndex int, columns []any) bool {
+	if a.Offset > 0 && rowIndex < a.Offset {
+		return true
+	}
+
+	if a.Limit > 0 && rowIndex+1 > a.Limit+a.Offset {
+		return false
+	}
+
+	a.Values = append(a.Values, columns)
+	return true
+}
+
+func (a *ArrayRowsScanner) Complete(result *QueryResult) {
+	result.Cost = time.Since(a.start).String()
+	result.Header = a.Header
+	result.Values = a.Values
+}
+
+// CsvRowsScanner renders the rows as CSV, with the header as the first record.
+type CsvRowsScanner struct {
+	start         time.Time
+	Limit, Offset int
+
+	buf bytes.Buffer
+	w   *csv.Writer
+}
+
+func NewCsvRowsScanner(offset, limit int) *CsvRowsScanner {
+	c := &CsvRowsScanner{Limit: limit, Offset: offset}
+	c.w = csv.NewWriter(&c.buf)
+	return c
+}
+
+func (c *CsvRowsScanner) StartExecute() {
+	c.start = time.Now()
+}
+
+func (c *CsvRowsScanner) StartRows(header []string) {
+	_ = c.w.Write(header)
+}
+
+func (c *CsvRowsScanner) AddRow(rowIndex int, columns []any) bool {
+	if c.Offset > 0 && rowIndex < c.Offset {
+		return true
+	}
+
+	if c.Limit > 0 && rowIndex+1 > c.Limit+c.Offset {
+		return false
+	}
+
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		switch v := col.(type) {
+		case nil:
+		case string:
+			record[i] = Unquote(v)
+		default:
+			record[i] = fmt.Sprintf("%v", v)
+		}
+	}
+	_ = c.w.Write(record)
+
+	return true
+}
+
+func (c *CsvRowsScanner) Complete(result *QueryResult) {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		result.Warnings = append(result.Warnings, "csv: "+err.Error())
+	}
+	result.Cost = time.Since(c.start).String()
+	result.ContentType = "text/csv; charset=utf-8"
+	result.Data = c.buf.Bytes()
+}
+
+// NdjsonRowsScanner streams the rows as one JSON object per line to the writer while scanning,
+// flushing every FlushRows rows, so that the client receives the rows before the query completes
+// and a slow client backpressures the scanning by the flow control of the transport.
+type NdjsonRowsScanner struct {
+	start         time.Time
+	Header        []string
+	Limit, Offset int
+	// FlushRows is the rows between flushes, 100 by default.
+	FlushRows int
+	// Flush pushes the written rows to the client, like http.Flusher, optional.
+	Flush func()
+
+	w       *bufio.Writer
+	pending int
+	err     error
+}
+
+func NewNdjsonRowsScanner(w io.Writer, flush func(), offset, limit int) *NdjsonRowsScanner {
+	return &NdjsonRowsScanner{Limit: limit, Offset: offset, FlushRows: 100, Flush: flush, w: bufio.NewWriter(w)}
+}
+
+func (n *NdjsonRowsScanner) StartExecute() {
+	n.start = time.Now()
+}
+
+func (n *NdjsonRowsScanner) StartRows(header []string) {
+	n.Header = DedupColumns(header)
+}
+
+func (n *NdjsonRowsScanner) AddRow(rowIndex int, columns []any) bool {
+	if n.Offset > 0 && rowIndex < n.Offset {
+		return true
+	}
+
+	if n.Limit > 0 && rowIndex+1 > n.Limit+n.Offset {
+		return false
+	}
+
+	row := make(map[string]any, len(n.Header))
+	for i, h := range n.Header {
+		row[h] = columns[i]
+	}
+	data, err := json.Marshal(row)
+	if err == nil {
+		_, err = n.w.Write(append(data, '\n'))
+	}
+	if err != nil {
+		// the client is gone, stop scanning
+		n.err = err
+		return false
+	}
+
+	if n.pending++; n.pending >= max(n.FlushRows, 1) {
+		n.flush()
+	}
+	return n.err == nil
+}
+
+func (n *NdjsonRowsScanner) flush() {
+	n.pending = 0
+	if err := n.w.Flush(); err != nil {
+		n.err = err
+		return
+	}
+	if n.Flush != nil {
+		n.Flush()
+	}
+}
+
+func (n *NdjsonRowsScanner) Complete(result *QueryResult) {
+	n.flush()
+	if n.err != nil {
+		result.Warnings = append(result.Warnings, "ndjson: "+n.err.Error())
+	}
+	result.Cost = time.Since(n.start).String()
+	result.Streamed = true
+}
+
+// TransformRowsScanner wraps a RowsScanner and passes every row through a callback first,
+// which can mutate, enrich, or drop it, e.g. to anonymize or join in reference data on the fly.
+type TransformRowsScanner struct {
+	RowsScanner
+
+	// MapHeader optionally changes the header, e.g. appends the columns added by MapRow.
+	MapHeader func(header []string) []string
+	// MapRow returns the row to pass on, or false to drop it.
+	// The header is the original one, before MapHeader.
+	MapRow func(header []string, row []any) ([]any, bool)
+
+	header  []string
+	dropped int
+}
+
+func NewTransformRowsScanner(s RowsScanner, mapRow func(header []string, row []any) ([]any, bool)) *TransformRowsScanner {
+	return &TransformRowsScanner{RowsScanner: s, MapRow: mapRow}
+}
+
+func (t *TransformRowsScanner) StartRows(header []string) {
+	t.header = header
+	if t.MapHeader != nil {
+		header = t.MapHeader(header)
+	}
+	t.RowsScanner.StartRows(header)
+}
+
+func (t *TransformRowsScanner) AddRow(rowIndex int, columns []any) bool {
+	if t.MapRow != nil {
+		var keep bool
+		if columns, keep = t.MapRow(t.header, columns); !keep {
+			t.dropped++
+			return true
+		}
+	}
+
+	// renumber the rows, so that the window of the wrapped scanner applies to the kept rows
+	return t.RowsScanner.AddRow(rowIndex-t.dropped, columns)
+}
+
+// MaskColumns returns a MapRow callback which replaces the values of the columns with the mask.
+func MaskColumns(mask string, columns ...string) func(header []string, row []any) ([]any, bool) {
+	masked := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		masked[c] = true
+	}
+
+	return func(header []string, row []any) ([]any, bool) {
+		for i, h := range header {
+			if masked[h] && row[i] != nil {
+				row[i] = mask
+			}
+		}
+		return row, true
+	}
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoPrimaryKey is returned for the tables without a primary key, or not found.
+var ErrNoPrimaryKey = errors.New("no primary key")
+
+// SchemaCache caches the primary keys of the tables, looked up from the catalog of the databases.
+type SchemaCache struct {
+	ttl time.Duration
+
+	lock sync.Mutex
+	keys map[schemaKey]cachedKey
+}
+
+type schemaKey struct {
+	db    Queryer
+	table string
+}
+
+type cachedKey struct {
+	columns []string
+	expires time.Time
+}
+
+// NewSchemaCache creates a SchemaCache, whose entries expire after ttl (5m by default) to catch the schema changes.
+func NewSchemaCache(ttl time.Duration) *SchemaCache {
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	return &SchemaCache{ttl: ttl, keys: map[schemaKey]cachedKey{}}
+}
+
+// PrimaryKey returns the primary key columns of the table in order, which may be qualified like schema.table.
+func (c *SchemaCache) PrimaryKey(ctx context.Context, db Queryer, dialect Dialect, table string) ([]string, error) {
+	key := schemaKey{db: db, table: table}
+	c.lock.Lock()
+	cached, ok := c.keys[key]
+	c.lock.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.columns, nil
+	}
+
+	columns, err := primaryKey(ctx, db, dialect, table)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	c.keys[key] = cachedKey{columns: columns, expires: time.Now().Add(c.ttl)}
+	c.lock.Unlock()
+	return columns, nil
+}
+
+func primaryKey(ctx context.Context, db Queryer, dialect Dialect, table string) ([]string, error) {
+	if _, err := quoteIdent(dialect, table); err != nil {
+		return nil, err
+	}
+
+	var q string
+	var args []any
+	switch dialect {
+	case DialectPostgres:
+		q = `SELECT a.attname FROM pg_index i JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+WHERE i.indrelid = $1::regclass AND i.indisprimary ORDER BY array_position(i.indkey::int2[], a.attnum)`
+		args = []any{table}
+	default:
+		schema, name, ok := strings.Cut(table, ".")
+		if !ok {
+			schema, name = "", table
+		}
+		q = `SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY' ORDER BY ORDINAL_POSITION`
+		args = []any{schema, name}
+	}
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("primary key of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("primary key of %s: %w", table, err)
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("primary key of %s: %w", table, err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPrimaryKey, table)
+	}
+	return columns, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Splitter splits the statements between the databases: the reads run on the Replica, like the one dialing
+// a replica group of targets, and the writes, the locking reads and the unknown statements on the Primary.
+type Splitter struct {
+	Primary, Replica DB
+}
+
+// NewSplitter creates the Splitter of the databases.
+func NewSplitter(primary, replica DB) *Splitter {
+	return &Splitter{Primary: primary, Replica: replica}
+}
+
+type routePrimaryKey struct{}
+
+// WithPrimary routes the reads with the returned context to the primary, like to read the own writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, routePrimaryKey{}, true)
+}
+
+// Route returns the database the query runs on.
+func (s *Splitter) Route(ctx context.Context, query string) DB {
+	if primary, _ := ctx.Value(routePrimaryKey{}).(bool); primary || !IsReadOnly(query) {
+		return s.Primary
+	}
+	return s.Replica
+}
+
+func (s *Splitter) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.Route(ctx, query).QueryContext(ctx, query, args...)
+}
+
+func (s *Splitter) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.Primary.ExecContext(ctx, query, args...)
+}
+
+// IsReadOnly tells whether the statement is a SELECT (or UNION of them) without locking the rows,
+// like FOR UPDATE or LOCK IN SHARE MODE, the ones the parser does not understand are not.
+func IsReadOnly(query string) bool {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return false
+	}
+
+	readOnly := true
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if sel, ok := node.(*sqlparser.Select); ok && sel.Lock != "" {
+			readOnly = false
+		}
+		if union, ok := node.(*sqlparser.Union); ok && union.Lock != "" {
+			readOnly = false
+		}
+		return readOnly, nil
+	}, stmt)
+
+	switch stmt.(type) {
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect:
+		return readOnly
+	default:
+		return false
+	}
+}
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// Chunk is a range of the rows of a table ordered by the key, after Lower (exclusive) up to Upper (inclusive),
+// a nil Lower is from the first row, and a nil Upper to the last.
+type Chunk struct {
+	Lower []any `json:"lower,omitempty"`
+	Upper []any `json:"upper,omitempty"`
+}
+
+// ChunkChecksum is the checksum of the rows of a chunk.
+type ChunkChecksum struct {
+	Chunk
+	Rows     int    `json:"rows"`
+	Checksum string `json:"checksum"`
+}
+
+// ChunkMismatch is a chunk whose checksums differ between the databases.
+type ChunkMismatch struct {
+	Index int           `json:"index"`
+	Left  ChunkChecksum `json:"left"`
+	Right ChunkChecksum `json:"right"`
+}
+
+// ChecksumReport is the comparison of a table between two databases by ChecksumTables.
+type ChecksumReport struct {
+	Table      string          `json:"table"`
+	Key        []string        `json:"key"`
+	Chunks     int             `json:"chunks"`
+	LeftRows   int             `json:"leftRows"`
+	RightRows  int             `json:"rightRows"`
+	Mismatches []ChunkMismatch `json:"mismatches,omitempty"`
+}
+
+// ChunkTable splits the rows of the table ordered by the key into the chunks of size rows (1000 by default),
+// by reading the key columns only.
+func ChunkTable(ctx context.Context, db DB, dialect Dialect, table string, key []string, size int) ([]Chunk, error) {
+	if size <= 0 {
+		size = 1000
+	}
+	keys, _, err := (&Browse{Table: table, Columns: key, Order: key}).SQL(dialect)
+	if err != nil {
+		return nil, err
+	}
+	_, rows, err := collectRows(ctx, db, keys, nil)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", table, err)
+	}
+
+	var chunks []Chunk
+	var lower []any
+	for i, values := range rows {
+		if (i+1)%size == 0 {
+			chunks = append(chunks, Chunk{Lower: lower, Upper: values})
+			lower = values
+		}
+	}
+	// the last chunk is open, to catch the rows beyond in the other databases
+	return append(chunks, Chunk{Lower: lower}), nil
+}
+
+// ChecksumTable checksums the rows of the table in the chunks by SHA-256 over their values in the order of the key.
+func ChecksumTable(ctx context.Context, db DB, dialect Dialect, table string, key []string, chunks []Chunk) ([]ChunkChecksum, error) {
+	checksums := make([]ChunkChecksum, len(chunks))
+	for i, c := range chunks {
+		q, args, err := chunkSQL(dialect, table, key, c)
+		if err != nil {
+			return nil, err
+		}
+		checksums[i], err = checksumChunk(ctx, db, q, args)
+		if err != nil {
+			return nil, fmt.Errorf("checksum %s: %w", table, err)
+		}
+		checksums[i].Chunk = c
+	}
+	return checksums, nil
+}
+
+// ChecksumTables compares the table between two databases like pt-table-checksum, chunked by the rows of the left,
+// and checksummed on both concurrently. The key is the primary key of the table if empty.
+// The statements are run by RunSQL, through the rewriters like the ones of the clients.
+func ChecksumTables(ctx context.Context, left, right DB, dialect Dialect, table string, key []string, size int) (*ChecksumReport, error) {
+	if len(key) == 0 {
+		resolved, err := rewriteTable(ctx, dialect, table)
+		if err != nil {
+			return nil, err
+		}
+		if key, err = primaryKey(ctx, left, dialect, resolved); err != nil {
+			return nil, err
+		}
+	}
+	chunks, err := ChunkTable(ctx, left, dialect, table, key, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	var checksums [2][]ChunkChecksum
+	var errs [2]error
+	for i, db := range []DB{left, right} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checksums[i], errs[i] = ChecksumTable(ctx, db, dialect, table, key, chunks)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &ChecksumReport{Table: table, Key: key, Chunks: len(chunks)}
+	for i := range chunks {
+		l, r := checksums[0][i], checksums[1][i]
+		report.LeftRows += l.Rows
+		report.RightRows += r.Rows
+		if l.Checksum != r.Checksum {
+			report.Mismatches = append(report.Mismatches, ChunkMismatch{Index: i, Left: l, Right: r})
+		}
+	}
+	return report, nil
+}
+
+// chunkSQL selects the rows of the chunk ordered by the key, compared as row values like (a, b) > (?, ?).
+func chunkSQL(dialect Dialect, table string, key []string, c Chunk) (string, []any, error) {
+	quotedTable, err := quoteIdent(dialect, table)
+	if err != nil {
+		return "", nil, err
+	}
+	quoted := make([]string, len(key))
+	for i, k := range key {
+		if quoted[i], err = quoteIdent(dialect, k); err != nil {
+			return "", nil, err
+		}
+	}
+	columns := strings.Join(quoted, ", ")
+
+	var conditions []string
+	var args []any
+	bound := func(op string, values []any) {
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = placeholder(dialect, len(args))
+		}
+		conditions = append(conditions, "("+columns+") "+op+" ("+strings.Join(placeholders, ", ")+")")
+	}
+	if c.Lower != nil {
+		bound(">", c.Lower)
+	}
+	if c.Upper != nil {
+		bound("<=", c.Upper)
+	}
+
+	q := "SELECT * FROM " + quotedTable
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return q + " ORDER BY " + columns, args, nil
+}
+
+func checksumChunk(ctx context.Context, db DB, q string, args []any) (ChunkChecksum, error) {
+	_, rows, err := collectRows(ctx, db, q, args)
+	if err != nil {
+		return ChunkChecksum{}, err
+	}
+
+	h := sha256.New()
+	var c ChunkChecksum
+	for _, values := range rows {
+		for _, v := range values {
+			if v == nil {
+				h.Write([]byte{0})
+			} else {
+				fmt.Fprintf(h, "%v", v)
+			}
+			h.Write([]byte{0x1f})
+		}
+		h.Write([]byte{0x1e})
+		c.Rows++
+	}
+	c.Checksum = hex.EncodeToString(h.Sum(nil))
+	return c, nil
+}
+
+// rewriteTable returns the table the rewriters (like TenantSchema) resolve the name to, as is without any.
+func rewriteTable(ctx context.Context, dialect Dialect, table string) (string, error) {
+	quoted, err := quoteIdent(dialect, table)
+	if err != nil {
+		return "", err
+	}
+	q := "SELECT * FROM " + quoted
+	stmt, err := Rewrite(Stmt{Ctx: ctx, Dialect: dialect, Query: q})
+	if err != nil || stmt.Query == q {
+		return table, err
+	}
+
+	parsed, err := parseSQL(stmt.Query)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := parsed.(*sqlparser.Select); ok && len(s.From) == 1 {
+		if names := tableNames(s.From); len(names) == 1 {
+			return names[0], nil
+		}
+	}
+	return "", fmt.Errorf("table %s rewritten to %s", table, stmt.Query)
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context carrying the authenticated tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant carried by the context, or empty.
+func TenantFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+var (
+	ErrNoTenant           = errors.New("no tenant")
+	ErrCrossTenantAccess  = errors.New("cross tenant access")
+	ErrUnsupportedTenancy = errors.New("statement unsupported in tenant mode")
+
+	tenantRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// TenantSchema returns a rewriter which qualifies unqualified table names with the schema of
+// the tenant in the statement context, e.g. TenantSchema("tenant_%s") rewrites
+// `select * from t` to `select * from tenant_x.t` for tenant x.
+// Statements which reference other schemas, or can not be parsed in full, like ALTER, are rejected.
+func TenantSchema(schemaFormat string) Rewriter {
+	return func(stmt Stmt) (Stmt, error) {
+		tenant := TenantFrom(stmt.Ctx)
+		if tenant == "" {
+			return stmt, ErrNoTenant
+		}
+		if !tenantRegexp.MatchString(tenant) {
+			return stmt, fmt.Errorf("invalid tenant %q", tenant)
+		}
+
+		parsed, err := parseSQL(stmt.Query)
+		if err != nil {
+			return stmt, fmt.Errorf("parse statement: %w", err)
+		}
+
+		schema := sqlparser.NewTableIdent(fmt.Sprintf(schemaFormat, tenant))
+		if err := qualifyTables(parsed, stmt.Query, schema); err != nil {
+			return stmt, err
+		}
+
+		stmt.Query = sqlString(parsed)
+		return stmt, nil
+	}
+}
+
+func qualifyTables(parsed sqlparser.Statement, query string, schema sqlparser.TableIdent) error {
+	qualify := func(t *sqlparser.TableName) {
+		if !t.IsEmpty() && t.Qualifier.IsEmpty() {
+			t.Qualifier = schema
+		}
+	}
+
+	switch s := parsed.(type) {
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect,
+		*sqlparser.Update, *sqlparser.Delete, *sqlparser.Begin, *sqlparser.Commit, *sqlparser.Rollback:
+	case *sqlparser.Insert:
+		qualify(&s.Table)
+	case *sqlparser.DDL:
+		// the parser skips the rest of the others, like the ALTER specifications, printed without them,
+		// and prints DROP VIEW as DROP TABLE
+		if !(s.Action == sqlparser.CreateStr && s.TableSpec != nil || s.Action == sqlparser.DropStr && dropsTable(query) ||
+			s.Action == sqlparser.RenameStr || s.Action == sqlparser.TruncateStr) {
+			return ErrUnsupportedTenancy
+		}
+		qualify(&s.Table)
+		qualify(&s.NewName)
+	case *sqlparser.Show:
+		if s.Type != "tables" && s.OnTable.IsEmpty() {
+			return ErrUnsupportedTenancy
+		}
+		if s.Type == "tables" {
+			if s.ShowTablesOpt == nil {
+				s.ShowTablesOpt = &sqlparser.ShowTablesOpt{}
+			}
+			if s.ShowTablesOpt.DbName == "" {
+				s.ShowTablesOpt.DbName = schema.String()
+			} else if s.ShowTablesOpt.DbName != schema.String() {
+				return ErrCrossTenantAccess
+			}
+		}
+		qualify(&s.OnTable)
+	default:
+		return ErrUnsupportedTenancy
+	}
+
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch n := node.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if t, ok := n.Expr.(sqlparser.TableName); ok {
+				qualify(&t)
+				n.Expr = t
+			}
+		case sqlparser.TableName:
+			// unqualified names left here are references to tables or aliases in the FROM clause
+			if !n.Qualifier.IsEmpty() && n.Qualifier != schema {
+				return false, ErrCrossTenantAccess
+			}
+		}
+		return true, nil
+	}, parsed)
+}
+
+// dropsTable tells whether the DROP statement drops a table, instead of a view or an index.
+func dropsTable(query string) bool {
+	words := 0
+	table := false
+	scanWords(query, func(w string, _, _ int) bool {
+		words++
+		table = words == 2 && strings.EqualFold(w, "table")
+		return words < 2
+	})
+	return table
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTenantSchema(t *testing.T) {
+	rewrite := TenantSchema("tenant_%s")
+	ctx := WithTenant(context.Background(), "acme")
+
+	for _, c := range []struct {
+		query string
+		want  string
+		err   error
+	}{
+		{query: "select * from t where id = 1", want: "select * from tenant_acme.t where id = 1"},
+		{query: "select * from tenant_acme.t", want: "select * from tenant_acme.t"},
+		{query: "select t.a, u.b from t join u on t.id = u.id", want: "select t.a, u.b from tenant_acme.t join tenant_acme.u on t.id = u.id"},
+		{query: "select * from t where id in (select id from u)", want: "select * from tenant_acme.t where id in (select id from tenant_acme.u)"},
+		{query: "insert into t(a) values (1)", want: "insert into tenant_acme.t(a) values (1)"},
+		{query: "update t set a = 1 where id = 2", want: "update tenant_acme.t set a = 1 where id = 2"},
+		{query: "delete from t where id = 2", want: "delete from tenant_acme.t where id = 2"},
+		{query: "show tables", want: "show tables from tenant_acme"},
+		{query: "select * from other.t", err: ErrCrossTenantAccess},
+		{query: "select * from t join other.u on t.id = u.id", err: ErrCrossTenantAccess},
+		{query: "select * from t where id in (select id from other.u)", err: ErrCrossTenantAccess},
+		{query: "show tables from other", err: ErrCrossTenantAccess},
+		{query: "alter table t add column c int", err: ErrUnsupportedTenancy},
+		{query: "drop view v", err: ErrUnsupportedTenancy},
+	} {
+		stmt, err := rewrite(Stmt{Ctx: ctx, Query: c.query})
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s: error %v, want %v", c.query, err, c.err)
+			}
+			continue
+		}
+		if err != nil || stmt.Query != c.want {
+			t.Errorf("%s: %q, %v, want %q", c.query, stmt.Query, err, c.want)
+		}
+	}
+
+	if _, err := rewrite(Stmt{Ctx: context.Background(), Query: "select 1"}); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("without a tenant: %v, want %v", err, ErrNoTenant)
+	}
+	if _, err := rewrite(Stmt{Ctx: WithTenant(context.Background(), "a.b"), Query: "select 1"}); err == nil {
+		t.Errorf("invalid tenant accepted")
+	}
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Trace is the breakdown of a statement run by RunSQL, captured by the context of WithTrace,
+// for the performance debugging of the slow requests.
+type Trace struct {
+	Kind string `json:"kind"`
+	// Route is the database the Splitter routes the statement to, primary or replica, empty without a Splitter.
+	Route string `json:"route,omitempty"`
+	// Conn is the client address of the connection the statement runs on as the database reports it,
+	// like 10.0.0.5:53412, and Target is the target of the Manager dialed it, resolved by the server.
+	Conn   string `json:"conn,omitempty"`
+	Target string `json:"target,omitempty"`
+	// Query is the statement run, after the rewriters.
+	Query string `json:"query"`
+
+	// Queue is the wait of the concurrency limiter, filled by the server.
+	Queue time.Duration `json:"queue,omitempty"`
+	// Prepare is the lint, the rewrite and the dry run of the statement before it runs.
+	Prepare time.Duration `json:"prepare"`
+	// PoolWait is the wait for a connection from the pool, with its ping, see Options.
+	PoolWait time.Duration `json:"poolWait"`
+	// Check is the EXPLAIN of Options.MaxExaminedRows.
+	Check time.Duration `json:"check,omitempty"`
+	// Exec is the statement until its first rows or its result, with the prepare by the driver,
+	// Scan the rows read.
+	Exec  time.Duration `json:"exec"`
+	Scan  time.Duration `json:"scan,omitempty"`
+	Total time.Duration `json:"total"`
+
+	// Rows are the rows read by a query, or affected by an exec.
+	Rows int `json:"rows"`
+	// Bytes and Encode are the size and the time of the result encoded, filled by the server.
+	Bytes  int64         `json:"bytes"`
+	Encode time.Duration `json:"encode,omitempty"`
+
+	// Plan is the server-side plan by EXPLAIN ANALYZE if asked, only of the read-only queries, which it runs again.
+	Plan []map[string]any `json:"plan,omitempty"`
+
+	analyze bool
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context capturing the Trace of the statement run by RunSQL with it,
+// along with the server-side plan if analyze.
+func WithTrace(ctx context.Context, analyze bool) (context.Context, *Trace) {
+	t := &Trace{analyze: analyze}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// TraceFrom returns the Trace captured by the context, nil if none.
+func TraceFrom(ctx context.Context) *Trace {
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// connAddr returns the client address of the session of the connection, as the database reports it, empty if unknown.
+func connAddr(ctx context.Context, conn Queryer, dialect Dialect) string {
+	var q string
+	switch dialect {
+	case DialectMySQL:
+		q = "SELECT HOST FROM information_schema.PROCESSLIST WHERE ID = CONNECTION_ID()"
+	case DialectPostgres:
+		q = "SELECT host(inet_client_addr()) || ':' || inet_client_port()"
+	default:
+		return ""
+	}
+
+	rows, err := conn.QueryContext(ctx, q)
+	if err != nil {
+		return ""
+	}
+	defer rows.Close()
+
+	var addr sql.NullString
+	if rows.Next() && rows.Scan(&addr) == nil {
+		return addr.String
+	}
+	return ""
+}
+
+// ExplainAnalyze runs the query by EXPLAIN ANALYZE for its actual plan, the tree of MySQL 8.0.18+ in a row,
+// or the parsed nodes of Postgres, it runs the query again.
+func ExplainAnalyze(ctx context.Context, db Queryer, dialect Dialect, q string, args []any) ([]map[string]any, error) {
+	switch dialect {
+	case DialectMySQL:
+		return explainPlan(ctx, db, "EXPLAIN ANALYZE "+q, args)
+	case DialectPostgres:
+		plan, err := explainPlan(ctx, db, "EXPLAIN (ANALYZE, FORMAT JSON) "+q, args)
+		if err != nil {
+			return nil, err
+		}
+		plan, _, err = postgresEstimate(plan)
+		return plan, err
+	default:
+		return nil, fmt.Errorf("explain analyze: unsupported dialect %q", dialect)
+	}
+}
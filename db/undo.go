@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// ErrUndo is the error of the statements whose undo log can not be captured.
+var ErrUndo = errors.New("undo log unsupported")
+
+// maxUndoRows bounds the pre-image of a statement, the ones affecting more rows fail.
+const maxUndoRows = 10000
+
+// undoPlan selects the pre-image of the rows an UPDATE/DELETE of a single table affects,
+// and generates the statements reverting it.
+type undoPlan struct {
+	table sqlparser.TableName
+	// sets are the columns the UPDATE sets, none for the DELETE.
+	sets []string
+	// pre selects the pre-image, with the args of the statement from argsFrom.
+	pre      string
+	argsFrom int
+}
+
+// planUndo plans the undo log of the UPDATE/DELETE, nil for the other statements.
+func planUndo(dialect Dialect, query string) (*undoPlan, error) {
+	stmt, err := parseSQL(query)
+	if err != nil {
+		if w := firstWord(query); w == "update" || w == "delete" {
+			return nil, fmt.Errorf("%w: %v", ErrUndo, err)
+		}
+		return nil, nil
+	}
+
+	var from sqlparser.TableExprs
+	var where *sqlparser.Where
+	var orderBy sqlparser.OrderBy
+	var limit *sqlparser.Limit
+	p := &undoPlan{}
+	switch s := stmt.(type) {
+	case *sqlparser.Update:
+		from, where, orderBy, limit = s.TableExprs, s.Where, s.OrderBy, s.Limit
+		for _, e := range s.Exprs {
+			p.sets = append(p.sets, e.Name.Name.String())
+		}
+		// the placeholders of the sets precede the ones of the where
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			if v, ok := node.(*sqlparser.SQLVal); ok && v.Type == sqlparser.ValArg {
+				p.argsFrom++
+			}
+			return true, nil
+		}, s.Exprs)
+	case *sqlparser.Delete:
+		if len(s.Targets) > 0 {
+			return nil, fmt.Errorf("%w: multi-table DELETE", ErrUndo)
+		}
+		from, where, orderBy, limit = s.TableExprs, s.Where, s.OrderBy, s.Limit
+	default:
+		return nil, nil
+	}
+
+	if dialect != DialectMySQL && dialect != DialectUnknown {
+		return nil, fmt.Errorf("%w: dialect %s", ErrUndo, dialect)
+	}
+	var ok bool
+	if len(from) == 1 {
+		var t *sqlparser.AliasedTableExpr
+		if t, ok = from[0].(*sqlparser.AliasedTableExpr); ok {
+			p.table, ok = t.Expr.(sqlparser.TableName)
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: multi-table statement", ErrUndo)
+	}
+
+	// the placeholders are parsed as :v1, :v2 and so on
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if v, ok := node.(*sqlparser.SQLVal); ok && v.Type == sqlparser.ValArg {
+			v.Val = []byte("?")
+		}
+		return true, nil
+	}, stmt)
+	p.pre = sqlparser.String(&sqlparser.Select{
+		SelectExprs: sqlparser.SelectExprs{&sqlparser.StarExpr{}},
+		From:        from, Where: where, OrderBy: orderBy, Limit: limit,
+		Lock: sqlparser.ForUpdateStr,
+	})
+	return p, nil
+}
+
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// execUndo executes the statement in a transaction, selecting the pre-image of the rows it affects before,
+// and returns the statements reverting it, like the INSERTs of the deleted rows, and the UPDATEs of the updated
+// ones by their primary keys.
+func execUndo(ctx context.Context, db DB, dialect Dialect, q string, args []any) (sql.Result, []string, error) {
+	plan, err := planUndo(dialect, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if plan == nil {
+		result, err := db.ExecContext(ctx, q, args...)
+		return result, nil, err
+	}
+	beginner, ok := db.(txBeginner)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no transaction on %T", ErrUndo, db)
+	}
+
+	tx, err := beginner.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var key []string
+	if len(plan.sets) > 0 {
+		if key, err = primaryKey(ctx, tx, dialect, qualifiedName(plan.table)); err != nil {
+			return nil, nil, err
+		}
+		if len(key) == 0 {
+			return nil, nil, fmt.Errorf("%w: %s has no primary key", ErrUndo, qualifiedName(plan.table))
+		}
+		for _, k := range key {
+			if slices.Contains(plan.sets, k) {
+				return nil, nil, fmt.Errorf("%w: the primary key %s updated", ErrUndo, k)
+			}
+		}
+	}
+
+	undo, err := plan.capture(ctx, tx, key, args[min(plan.argsFrom, len(args)):])
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return result, undo, nil
+}
+
+// capture selects the pre-image, and generates the undo statements of its rows.
+func (p *undoPlan) capture(ctx context.Context, tx *sql.Tx, key []string, args []any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, p.pre, args...)
+	if err != nil {
+		return nil, fmt.Errorf("undo pre-image: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var undo []string
+	for rows.Next() {
+		if len(undo) == maxUndoRows {
+			return nil, fmt.Errorf("undo log beyond max %d rows", maxUndoRows)
+		}
+
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		undo = append(undo, p.revert(key, columns, values))
+	}
+	return undo, rows.Err()
+}
+
+// revert generates the statement reverting the row of the pre-image.
+func (p *undoPlan) revert(key, columns []string, values []any) string {
+	if len(p.sets) == 0 {
+		tuple := make(sqlparser.ValTuple, len(values))
+		cols := make(sqlparser.Columns, len(columns))
+		for i, v := range values {
+			tuple[i], cols[i] = literal(v), sqlparser.NewColIdent(columns[i])
+		}
+		return sqlparser.String(&sqlparser.Insert{
+			Action: sqlparser.InsertStr, Table: p.table, Columns: cols,
+			Rows: sqlparser.Values{tuple},
+		})
+	}
+
+	update := &sqlparser.Update{TableExprs: sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: p.table}}}
+	var conditions []sqlparser.Expr
+	for i, c := range columns {
+		col := &sqlparser.ColName{Name: sqlparser.NewColIdent(c)}
+		if slices.Contains(p.sets, c) {
+			update.Exprs = append(update.Exprs, &sqlparser.UpdateExpr{Name: col, Expr: literal(values[i])})
+		}
+		if slices.Contains(key, c) {
+			conditions = append(conditions, equals(col, values[i]))
+		}
+	}
+	where := conditions[0]
+	for _, c := range conditions[1:] {
+		where = &sqlparser.AndExpr{Left: where, Right: c}
+	}
+	update.Where = sqlparser.NewWhere(sqlparser.WhereStr, where)
+	return sqlparser.String(update)
+}
+
+func equals(col *sqlparser.ColName, v any) sqlparser.Expr {
+	if v == nil {
+		return &sqlparser.IsExpr{Operator: sqlparser.IsNullStr, Expr: col}
+	}
+	return &sqlparser.ComparisonExpr{Operator: sqlparser.EqualStr, Left: col, Right: literal(v)}
+}
+
+// literal is the SQL literal of the value scanned, the binary ones in hex.
+func literal(v any) sqlparser.Expr {
+	switch t := v.(type) {
+	case nil:
+		return &sqlparser.NullVal{}
+	case []byte:
+		if !utf8.Valid(t) {
+			return sqlparser.NewHexVal([]byte(hex.EncodeToString(t)))
+		}
+		return sqlparser.NewStrVal(t)
+	case string:
+		return sqlparser.NewStrVal([]byte(t))
+	case int64:
+		return sqlparser.NewIntVal([]byte(strconv.FormatInt(t, 10)))
+	case float64:
+		return sqlparser.NewFloatVal([]byte(strconv.FormatFloat(t, 'g', -1, 64)))
+	case bool:
+		if t {
+			return sqlparser.NewIntVal([]byte("1"))
+		}
+		return sqlparser.NewIntVal([]byte("0"))
+	case time.Time:
+		return sqlparser.NewStrVal([]byte(t.Format("2006-01-02 15:04:05.999999")))
+	default:
+		return sqlparser.NewStrVal([]byte(fmt.Sprint(t)))
+	}
+}
@@ -0,0 +1,161 @@
+package dualconn
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DiscoveryConfig tunes the discovery of the targets by DNS.
+type DiscoveryConfig struct {
+	// Names are resolved into the targets, srv+mysql._tcp.db.internal by the SRV records, ordered by the priority
+	// and the weight, or db.internal:3306 (or dns+db.internal:3306) by the A/AAAA records, ordered by the IPs.
+	Names []string
+	// Interval of the re-resolutions, 30s by default.
+	Interval time.Duration
+	// Resolver is net.DefaultResolver by default.
+	Resolver *net.Resolver
+	// OnChange is called with the targets added and removed by a resolution.
+	OnChange func(added, removed []string)
+}
+
+// WithDiscovery resolves the names into the targets now and on the interval, adding the new targets after the
+// configured ones, and draining the ones gone from the records, the failed or empty resolutions change nothing.
+func (d *Manager) WithDiscovery(c DiscoveryConfig) *Manager {
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.Resolver == nil {
+		c.Resolver = net.DefaultResolver
+	}
+
+	d.discover(c)
+	go func() {
+		for {
+			select {
+			case <-d.after(c.Interval):
+				d.discover(c)
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return d
+}
+
+// discover resolves the names, and updates the targets discovered by them.
+func (d *Manager) discover(c DiscoveryConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Interval)
+	defer cancel()
+
+	var addrs []string
+	for _, name := range c.Names {
+		resolved, err := Resolve(ctx, c.Resolver, name)
+		if err != nil || len(resolved) == 0 {
+			log.Printf("discover %s: %d targets, error: %v", name, len(resolved), err)
+			return
+		}
+		addrs = append(addrs, resolved...)
+	}
+
+	added, gone := d.updateDiscovered(addrs)
+	if len(added) == 0 && len(gone) == 0 {
+		return
+	}
+
+	removed := make([]string, len(gone))
+	for i, t := range gone {
+		removed[i] = t.Addr
+	}
+	log.Printf("discovered targets added: %v, removed: %v", added, removed)
+	if c.OnChange != nil {
+		c.OnChange(added, removed)
+	}
+
+	// closes the connections to the gone targets as they turn idle
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.Interval)
+		defer cancel()
+		_ = d.drain(ctx, gone)
+	}()
+}
+
+// updateDiscovered replaces the discovered targets by the addresses, keeping the configured ones and the states
+// of the ones still there, and returns the added addresses and the removed targets.
+func (d *Manager) updateDiscovered(addrs []string) (added []string, removed []*Target) {
+	d.Lock()
+	defer d.Unlock()
+
+	targets := make([]*Target, 0, len(d.Targets)+len(addrs))
+	for _, t := range d.Targets {
+		if !d.discovered[t.Addr] {
+			targets = append(targets, t)
+		}
+	}
+	discovered := map[string]bool{}
+	for _, addr := range addrs {
+		if discovered[addr] || slices.ContainsFunc(targets, func(t *Target) bool { return t.Addr == addr }) {
+			continue
+		}
+		discovered[addr] = true
+
+		i := slices.IndexFunc(d.Targets, func(t *Target) bool { return t.Addr == addr })
+		if i < 0 {
+			targets = append(targets, d.newTarget(addr))
+			added = append(added, addr)
+			continue
+		}
+		targets = append(targets, d.Targets[i])
+	}
+
+	for _, t := range d.Targets {
+		if d.discovered[t.Addr] && !discovered[t.Addr] {
+			removed = append(removed, t)
+			d.forget(t)
+		}
+	}
+	d.Targets, d.discovered = targets, discovered
+	return added, removed
+}
+
+// Resolve resolves the name of the discovery into the addresses of the targets, see DiscoveryConfig.Names.
+func Resolve(ctx context.Context, resolver *net.Resolver, name string) ([]string, error) {
+	if srv, ok := strings.CutPrefix(name, "srv+"); ok {
+		if !strings.HasPrefix(srv, "_") {
+			srv = "_" + srv
+		}
+		_, records, err := resolver.LookupSRV(ctx, "", "", srv)
+		if err != nil {
+			return nil, err
+		}
+
+		slices.SortStableFunc(records, func(a, b *net.SRV) int {
+			return cmp.Or(cmp.Compare(a.Priority, b.Priority), cmp.Compare(b.Weight, a.Weight), strings.Compare(a.Target, b.Target))
+		})
+		addrs := make([]string, len(records))
+		for i, r := range records {
+			addrs[i] = net.JoinHostPort(strings.TrimSuffix(r.Target, "."), fmt.Sprint(r.Port))
+		}
+		return addrs, nil
+	}
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(name, "dns+"))
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(ips)
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip, port)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,166 @@
+package dualconn
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// DNSCacheConfig tunes the cache of the resolutions of the hostname targets, see Manager.WithDNSCache.
+type DNSCacheConfig struct {
+	// TTL of the resolved addresses, overriding the ones of the records, 30s by default.
+	TTL time.Duration
+	// NegativeTTL of the failed resolutions, 5s by default, the stale addresses are dialed in the meantime if any.
+	NegativeTTL time.Duration
+	// Resolver is net.DefaultResolver by default.
+	Resolver *net.Resolver
+}
+
+// ResolveObserver observes the resolutions of the hosts by the DNS cache, not the ones answered by it, e.g. for metrics.
+type ResolveObserver func(host string, cost time.Duration, err error)
+
+// WithDNSCache resolves the hostname targets by the cache, dialing the stale addresses when the resolver fails,
+// so a flaky resolver doesn't turn into the failed dials and the spurious failovers.
+// It wraps the Dialer, set the Dialer before it.
+func (d *Manager) WithDNSCache(c DNSCacheConfig) *Manager {
+	if c.TTL <= 0 {
+		c.TTL = 30 * time.Second
+	}
+	if c.NegativeTTL <= 0 {
+		c.NegativeTTL = 5 * time.Second
+	}
+	if c.Resolver == nil {
+		c.Resolver = net.DefaultResolver
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.Dialer = &cachingDialer{forward: d.Dialer, config: c, observe: d.observeResolve, now: d.now, entries: map[string]*dnsEntry{}}
+	return d
+}
+
+// WithResolveObserver adds an observer of the resolutions by the DNS cache.
+func (d *Manager) WithResolveObserver(o ResolveObserver) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.dnsObservers = append(d.dnsObservers, o)
+	return d
+}
+
+func (d *Manager) observeResolve(host string, cost time.Duration, err error) {
+	d.Lock()
+	observers := d.dnsObservers
+	d.Unlock()
+
+	for _, o := range observers {
+		o(host, cost, err)
+	}
+}
+
+// dnsEntry is the cached resolution of a host, the addresses are kept after they expire for the failed resolutions.
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+	err     error
+	// errExpires is the expiry of the negative caching of err
+	errExpires time.Time
+	// resolving is closed when the resolution in flight is done
+	resolving chan struct{}
+}
+
+// cachingDialer dials the targets by the addresses of their hosts in the cache.
+type cachingDialer struct {
+	sync.Mutex
+	forward Dialer
+	config  DNSCacheConfig
+	observe ResolveObserver
+	// now is the time by the clock of the Manager, for the expiries
+	now     func() time.Time
+	entries map[string]*dnsEntry
+}
+
+func (c *cachingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.forward.DialContext(ctx, network, addr)
+	}
+
+	ips, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = c.forward.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// lookup returns the addresses of the host, from the cache if fresh, or resolved once for the concurrent dials.
+func (c *cachingDialer) lookup(ctx context.Context, host string) ([]string, error) {
+	for {
+		now := c.now()
+		c.Lock()
+		e := c.entries[host]
+		if e == nil {
+			e = &dnsEntry{}
+			c.entries[host] = e
+		}
+		switch {
+		case now.Before(e.expires):
+			c.Unlock()
+			return e.addrs, nil
+		case e.err != nil && now.Before(e.errExpires):
+			c.Unlock()
+			return e.stale()
+		case e.resolving != nil:
+			resolving := e.resolving
+			c.Unlock()
+			select {
+			case <-resolving:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		e.resolving = make(chan struct{})
+		c.Unlock()
+
+		start := time.Now()
+		addrs, err := c.config.Resolver.LookupHost(ctx, host)
+		c.observe(host, time.Since(start), err)
+
+		now = c.now()
+		c.Lock()
+		if err == nil && len(addrs) > 0 {
+			e.addrs, e.expires, e.err = addrs, now.Add(c.config.TTL), nil
+		} else if ctx.Err() == nil {
+			// the failures of the canceled dials are not the resolver's
+			e.err, e.errExpires = err, now.Add(c.config.NegativeTTL)
+			if e.err == nil {
+				e.err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+			}
+		}
+		close(e.resolving)
+		e.resolving = nil
+		addrs, err = e.stale()
+		c.Unlock()
+		if ctx.Err() != nil && err == nil && len(addrs) == 0 {
+			return nil, ctx.Err()
+		}
+		return addrs, err
+	}
+}
+
+// stale returns the addresses even expired, or the error of the resolution if none.
+func (e *dnsEntry) stale() ([]string, error) {
+	if len(e.addrs) > 0 {
+		return e.addrs, nil
+	}
+	return nil, e.err
+}
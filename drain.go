@@ -0,0 +1,89 @@
+package dualconn
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Drain disables the target, and closes its connections gracefully as they turn idle, neither reading nor writing,
+// so the pools like sql.DB re-dial the other targets. The ones still busy when the context is done are closed forcibly.
+func (d *Manager) Drain(ctx context.Context, target string) error {
+	d.Lock()
+	i := slices.IndexFunc(d.Targets, func(t *Target) bool { return t.Addr == target })
+	if i < 0 {
+		d.Unlock()
+		return fmt.Errorf("%w %s", ErrUnknownTarget, target)
+	}
+	t := d.Targets[i]
+	prev := t.state()
+	t.Disabled, t.draining = true, true
+	d.emitState(t, prev, nil)
+	d.Unlock()
+
+	defer func() {
+		d.Lock()
+		t.draining = false
+		d.Unlock()
+	}()
+	return d.drain(ctx, []*Target{t})
+}
+
+// Shutdown stops the background loops and fails the later dials like Close,
+// but drains the connections of all the targets like Drain.
+func (d *Manager) Shutdown(ctx context.Context) error {
+	d.Lock()
+	d.stopLoops()
+	targets := slices.Clone(d.Targets)
+	d.Unlock()
+
+	return d.drain(ctx, targets)
+}
+
+// drain closes the connections of the targets idle in two checks in a row, until none is left or the context is done.
+func (d *Manager) drain(ctx context.Context, targets []*Target) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	// the read and written bytes of the connections found idle in the last check
+	idle := map[*DualConn]int64{}
+	for {
+		d.Lock()
+		left := 0
+		for _, t := range targets {
+			for id, c := range t.Conns {
+				n, seen := idle[c]
+				switch {
+				case c.Closed:
+					delete(t.Conns, id)
+				case c.busy.Load() > 0:
+					delete(idle, c)
+					left++
+				case seen && n == c.transferred.Load():
+					_ = c.Close()
+					delete(t.Conns, id)
+				default:
+					idle[c] = c.transferred.Load()
+					left++
+				}
+			}
+		}
+		d.Unlock()
+		if left == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			d.Lock()
+			for _, t := range targets {
+				_ = t.Close()
+				t.Conns = make(map[string]*DualConn)
+			}
+			d.Unlock()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package dualconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// streamTarget listens on a target writing a byte every 10ms to its connections, until the test ends.
+func streamTarget(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				for {
+					if _, err := c.Write([]byte{1}); err != nil {
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDrainWhileReading(t *testing.T) {
+	addr := streamTarget(t)
+	m := NewManager([]string{addr}, time.Second)
+	t.Cleanup(func() { _ = m.Close() })
+
+	reading, err := m.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := reading.Read(buf); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	// the connection reading all along is not idle, closed forcibly at the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.Drain(ctx, addr); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("drain of the reading connection: %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Fatalf("drained the reading connection in %s, want it kept until the deadline", elapsed)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reading connection not closed at the deadline")
+	}
+}
+
+func TestDrainIdle(t *testing.T) {
+	_, addr := listenTargets(t)
+	m := NewManager([]string{addr}, time.Second)
+	t.Cleanup(func() { _ = m.Close() })
+
+	idle, err := m.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.Drain(ctx, addr); err != nil {
+		t.Fatalf("drain of the idle connection: %v", err)
+	}
+	if _, err := idle.Write([]byte{1}); err == nil {
+		t.Fatal("idle connection not closed by the drain")
+	}
+}
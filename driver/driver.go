@@ -0,0 +1,199 @@
+// Package driver registers the dualmysql database/sql driver, the MySQL driver dialing by a dualconn Manager,
+// whose DSN embeds the targets, like dualmysql://user:pass@(10.0.0.1:3306,10.0.0.2:3306)/db?failover=protagonist.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Name is the name of the registered driver.
+const Name = "dualmysql"
+
+func init() {
+	sql.Register(Name, &Driver{})
+}
+
+// Config is the parsed DSN of dualmysql.
+type Config struct {
+	Targets []string
+	// Failover is how the dials choose the targets: first (the first available one, by default),
+	// protagonist (the first available one, switching back to the first target when it recovers),
+	// round-robin, least-conns or least-latency.
+	Failover string
+	// DialTimeout is the timeout of a dial to a target, 3s by default.
+	DialTimeout time.Duration
+	// MySQL is the config of the MySQL driver, with the other parameters of the DSN.
+	MySQL *mysql.Config
+}
+
+// ParseDSN parses the DSN like dualmysql://user:pass@(10.0.0.1:3306,10.0.0.2:3306)/db?failover=protagonist&dialTimeout=3s,
+// the parameters other than failover and dialTimeout are the ones of the MySQL driver.
+func ParseDSN(dsn string) (*Config, error) {
+	rest, ok := strings.CutPrefix(dsn, Name+"://")
+	if !ok {
+		return nil, fmt.Errorf("dsn %s: missing %s:// scheme", Name, Name)
+	}
+
+	userinfo, rest, ok := strings.Cut(rest, "@(")
+	if !ok {
+		// without the credentials
+		if rest, ok = strings.CutPrefix(userinfo, "("); !ok {
+			return nil, fmt.Errorf("dsn %s: missing the (targets)", Name)
+		}
+		userinfo = ""
+	}
+	targets, rest, ok := strings.Cut(rest, ")")
+	if !ok {
+		return nil, fmt.Errorf("dsn %s: unclosed (targets", Name)
+	}
+
+	c := &Config{Failover: "first", DialTimeout: 3 * time.Second}
+	for _, t := range strings.Split(targets, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(t); err != nil {
+			t = net.JoinHostPort(t, "3306")
+		}
+		c.Targets = append(c.Targets, t)
+	}
+	if len(c.Targets) == 0 {
+		return nil, fmt.Errorf("dsn %s: no targets", Name)
+	}
+
+	path, query, _ := strings.Cut(rest, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("dsn %s: %w", Name, err)
+	}
+	if f := params.Get("failover"); f != "" {
+		c.Failover = f
+		params.Del("failover")
+	}
+	if t := params.Get("dialTimeout"); t != "" {
+		if c.DialTimeout, err = time.ParseDuration(t); err != nil {
+			return nil, fmt.Errorf("dsn %s dialTimeout: %w", Name, err)
+		}
+		params.Del("dialTimeout")
+	}
+	if _, err := strategy(c.Failover); err != nil {
+		return nil, err
+	}
+
+	// the address is replaced by the dials of the Manager
+	mysqlDSN := "tcp(" + c.Targets[0] + ")" + path
+	if userinfo != "" {
+		mysqlDSN = userinfo + "@" + mysqlDSN
+	}
+	if len(params) > 0 {
+		mysqlDSN += "?" + params.Encode()
+	}
+	if c.MySQL, err = mysql.ParseDSN(mysqlDSN); err != nil {
+		return nil, fmt.Errorf("dsn %s: %w", Name, err)
+	}
+	return c, nil
+}
+
+func strategy(failover string) (dualconn.Strategy, error) {
+	switch failover {
+	case "first", "protagonist":
+		return nil, nil
+	case "round-robin":
+		return dualconn.RoundRobin(), nil
+	case "least-conns":
+		return dualconn.LeastConns(), nil
+	case "least-latency":
+		return dualconn.LeastLatency(), nil
+	default:
+		return nil, fmt.Errorf("dsn %s: unknown failover %s", Name, failover)
+	}
+}
+
+// Driver is the dualmysql driver.
+type Driver struct{}
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	return NewConnector(dsn)
+}
+
+// Connector connects by the Manager of the targets, the same targets and failover share one Manager.
+type Connector struct {
+	driver.Connector
+	Manager *dualconn.Manager
+}
+
+// NewConnector parses the DSN, and sets up the Manager of its targets, for sql.OpenDB.
+func NewConnector(dsn string) (*Connector, error) {
+	c, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	m, network := manager(c)
+	mc := *c.MySQL
+	mc.Net = network
+	connector, err := mysql.NewConnector(&mc)
+	if err != nil {
+		return nil, err
+	}
+	return &Connector{Connector: connector, Manager: m}, nil
+}
+
+func (c *Connector) Driver() driver.Driver { return &Driver{} }
+
+var (
+	managersLock sync.Mutex
+	managers     = map[string]*registered{}
+)
+
+type registered struct {
+	manager *dualconn.Manager
+	network string
+}
+
+// manager returns the Manager of the targets and the failover, and the network of the MySQL driver dialing by it.
+func manager(c *Config) (*dualconn.Manager, string) {
+	key := strings.Join(c.Targets, ",") + "?" + c.Failover + "&" + c.DialTimeout.String()
+
+	managersLock.Lock()
+	defer managersLock.Unlock()
+
+	if r, ok := managers[key]; ok {
+		return r.manager, r.network
+	}
+
+	m := dualconn.NewManager(c.Targets, c.DialTimeout)
+	if c.Failover == "protagonist" {
+		m.WithProtagonistHalo()
+	}
+	if s, _ := strategy(c.Failover); s != nil {
+		m.WithStrategy(s)
+	}
+
+	network := Name + "-" + strconv.Itoa(len(managers))
+	mysql.RegisterDialContext(network, func(ctx context.Context, addr string) (net.Conn, error) {
+		return m.DialContext(ctx, "tcp", addr)
+	})
+	managers[key] = &registered{manager: m, network: network}
+	return m, network
+}
@@ -2,10 +2,15 @@ package dualconn
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/segmentio/ksuid"
@@ -22,33 +27,74 @@ type Manager struct {
 
 	// ProtagonistHalo 开启主角光环，一旦主角复活，其它副本自动退位（Close)
 	ProtagonistHalo bool `json:"protagonistHalo"`
-	stop            chan struct{}
+	// Active is the target the dials currently land on.
+	Active string `json:"active,omitempty"`
+	stop   chan struct{}
+	closed bool
+
+	dialObservers []DialObserver
+	dnsObservers  []ResolveObserver
+	failback      FailbackPolicy
+	// recoveredAt is the time the protagonist has been reachable since, failingBack is set by Failback
+	recoveredAt   time.Time
+	failingBack   bool
+	eventHandlers []func(Event)
+	events        chan Event
+	strategy      Strategy
+	breaker       *BreakerConfig
+	smokeTest     SmokeTest
+	smokeLock     *sync.Mutex
+	prober        *ProbeConfig
+	tls           *tls.Config
+	tlsConfigs    map[string]*tls.Config
+	tlsVerifier   TLSVerifier
+	retry         RetryPolicy
+	maxConns      int
+	connsQueue    time.Duration
+	clock         Clock
+	rand          Rand
+	logger        *slog.Logger
+	history       *TimelineConfig
+	timelines     map[string]*timeline
+	slo           *SLOConfig
+	sloTrackers   map[string]*sloTracker
+	tiers         map[string]string
+	store         StateStore
+	saves         chan struct{}
+	// discovered are the addresses of the targets discovered by DNS, see WithDiscovery
+	discovered map[string]bool
 }
 
+// DialObserver observes every dial to a target, e.g. for metrics.
+// The index is the position of the target, the failovers are the EventFailover events, see Manager.OnEvent.
+type DialObserver func(target string, index int, cost time.Duration, err error)
+
 func NewManager(addresses []string, dailTimeout time.Duration) *Manager {
 	m := &Manager{
 		Mutex:   &sync.Mutex{},
 		Timeout: dailTimeout,
 		Dialer:  &net.Dialer{Timeout: dailTimeout},
+		stop:    make(chan struct{}),
+		clock:   systemClock{},
+		rand:    systemRand{},
 	}
 	m.Targets = make([]*Target, len(addresses))
 	for i, addr := range addresses {
-		m.Targets[i] = &Target{
-			Addr:  addr,
-			Conns: make(map[string]*DualConn),
-		}
+		m.Targets[i] = m.newTarget(addr)
 	}
 	go m.recycle(3 * time.Second)
 
 	return m
 }
 
+// Close stops the background loops, like the health checks and the probes,
+// fails the later dials by ErrClosed, and closes all the connections, see Shutdown to drain them.
 func (d *Manager) Close() error {
-	close(d.stop)
-
 	d.Lock()
 	defer d.Unlock()
 
+	d.stopLoops()
+
 	var errs error
 	for _, t := range d.Targets {
 		errs = multierr.Append(errs, t.Close())
@@ -57,6 +103,35 @@ func (d *Manager) Close() error {
 	return errs
 }
 
+// stopLoops stops the background loops once, called under the lock.
+func (d *Manager) stopLoops() {
+	if !d.closed {
+		d.closed = true
+		close(d.stop)
+	}
+}
+
+// WithDialObserver adds an observer of the dials.
+func (d *Manager) WithDialObserver(o DialObserver) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.dialObservers = append(d.dialObservers, o)
+	return d
+}
+
+func (d *Manager) observeDial(target string, index int, start *time.Time, err error) {
+	d.Lock()
+	observers, logger := d.dialObservers, d.logger
+	d.Unlock()
+
+	cost := time.Since(*start)
+	d.logDial(logger, target, index, cost, err)
+	for _, o := range observers {
+		o(target, index, cost, err)
+	}
+}
+
 func (d *Manager) WithProtagonistHalo() *Manager {
 	d.ProtagonistHalo = true
 	return d
@@ -66,14 +141,27 @@ func (d *Manager) MarshalJSON() ([]byte, error) {
 	d.Lock()
 	defer d.Unlock()
 
+	for _, t := range d.Targets {
+		t.InUse = openConns(t)
+	}
 	type alias Manager
-	return json.Marshal(alias(*d))
+	return json.Marshal(struct {
+		alias
+		ActiveTier string        `json:"activeTier,omitempty"`
+		Stats      []TargetStats `json:"stats"`
+		SLO        []TargetSLO   `json:"slo,omitempty"`
+	}{alias(*d), d.activeTier(), d.stats(), d.slos()})
 }
 
 func (d *Manager) Enable(target string, disabled bool) bool {
+	d.Lock()
+	defer d.Unlock()
+
 	for _, t := range d.Targets {
 		if t.Addr == target {
+			prev := t.state()
 			t.SetDisabled(disabled)
+			d.emitState(t, prev, nil)
 			return true
 		}
 	}
@@ -82,51 +170,208 @@ func (d *Manager) Enable(target string, disabled bool) bool {
 }
 
 func (d *Manager) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
-	for i, target := range d.Targets {
-		if target.Disabled {
-			continue
-		}
+	dc, _, err := d.dial(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
 
-		dialTime := Now()
-		conn, err := d.Dialer.DialContext(ctx, network, target.Addr)
-		if err != nil {
-			d.Lock()
-			target.LastErr = err.Error()
-			target.DialTime = dialTime
-			d.Unlock()
-			continue
+func (d *Manager) dial(ctx context.Context, network string) (*DualConn, *Target, error) {
+	d.Lock()
+	closed := d.closed
+	d.Unlock()
+	if closed {
+		return nil, nil, ErrClosed
+	}
+
+	d.Lock()
+	policy, clock := d.retry, d.clock
+	d.Unlock()
+
+	pinned := pinnedTarget(ctx)
+	if pinned != "" {
+		d.Lock()
+		i := d.indexOf(pinned)
+		d.Unlock()
+		if i < 0 {
+			return nil, nil, fmt.Errorf("%w: %w %s", ErrNotAvailable, ErrUnknownTarget, pinned)
+		}
+	}
+	var queued time.Time
+	for round := 0; ; round++ {
+		full := false
+		for _, target := range d.order(pinned) {
+			for attempt := 0; ; attempt++ {
+				dc, admitted, capped := d.dialOnce(ctx, network, target, pinned, policy)
+				if dc != nil {
+					return dc, target, nil
+				}
+				full = full || capped
+				// the sticky retries stay on the target before the next one
+				if !admitted || !policy.Sticky || attempt >= policy.Retries {
+					break
+				}
+				if err := d.wait(ctx, policy, attempt); err != nil {
+					return nil, nil, fmt.Errorf("%w: %w", ErrNotAvailable, err)
+				}
+			}
 		}
 
-		dc := &DualConn{
-			ID:   ksuid.New().String(),
-			conn: conn,
+		if full {
+			if queued.IsZero() {
+				queued = clock.Now()
+			}
+			// the queued rounds are not the retries
+			if d.waitConns(ctx, queued) {
+				round--
+				continue
+			}
+			return nil, nil, fmt.Errorf("%w: %w", ErrNotAvailable, ErrMaxConns)
+		}
+		if policy.Sticky || round >= policy.Retries {
+			return nil, nil, ErrNotAvailable
 		}
+		if err := d.wait(ctx, policy, round); err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrNotAvailable, err)
+		}
+	}
+}
 
+// dialOnce dials the target once, nil if it fails, and tells whether the breaker admitted it,
+// or the cap of the connections refused it.
+func (d *Manager) dialOnce(ctx context.Context, network string, target *Target, pinned string, policy RetryPolicy) (*DualConn, bool, bool) {
+	// the pinned dials, like the ones of the smoke test, bypass the breaker and the cap
+	d.Lock()
+	if pinned == "" && d.full(target) {
+		d.Unlock()
+		return nil, false, true
+	}
+	admitted := pinned != "" || d.admit(target)
+	i := slices.Index(d.Targets, target)
+	if admitted {
+		target.pending++
+	}
+	d.Unlock()
+	if !admitted {
+		return nil, false, false
+	}
+	defer func() {
+		d.Lock()
+		target.pending--
+		d.Unlock()
+	}()
+
+	dialTime := Now()
+	attemptCtx := ctx
+	if policy.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, policy.AttemptTimeout)
+		defer cancel()
+	}
+	conn, err := d.dialTarget(attemptCtx, network, target.Addr)
+	d.observeDial(target.Addr, i, dialTime, err)
+	if err != nil {
 		d.Lock()
-		target.Conns[dc.ID] = dc
-		target.LastErr = ""
+		prev := target.state()
+		target.LastErr = err.Error()
 		target.DialTime = dialTime
-
-		if i == 0 && d.ProtagonistHalo {
-			for i := 1; i < len(d.Targets); i++ {
-				_ = d.Targets[i].Close()
-			}
+		if pinned == "" {
+			d.observeBreaker(target, false)
+		}
+		if i == 0 {
+			// the stabilization window of the failback starts over
+			d.recoveredAt = time.Time{}
 		}
+		d.emitState(target, prev, err)
 		d.Unlock()
+		return nil, true, false
+	}
+
+	if pinned == "" && !d.smokeReady(ctx, target) {
+		_ = conn.Close()
+		d.Lock()
+		prev := target.state()
+		d.observeBreaker(target, false)
+		d.emitState(target, prev, errors.New(target.LastErr))
+		d.Unlock()
+		return nil, true, false
+	}
 
-		return dc, nil
+	dc := &DualConn{
+		ID:      ksuid.New().String(),
+		Created: time.Now(),
+		conn:    conn,
+		stats:   target.stats,
 	}
+	target.stats.total.Add(1)
 
-	return nil, ErrNotAvailable
+	d.Lock()
+	defer d.Unlock()
+
+	prev := target.state()
+	target.Conns[dc.ID] = dc
+	target.LastErr = ""
+	target.DialTime = dialTime
+	target.observeLatency(time.Since(*dialTime))
+	d.recordLatency(target)
+	if pinned == "" {
+		d.activate(target)
+		d.observeBreaker(target, true)
+		if i == 0 {
+			d.failingBack = false
+		}
+	}
+	d.emitState(target, prev, nil)
+
+	if i == 0 && d.ProtagonistHalo && pinned == "" && d.strategy == nil {
+		for i := 1; i < len(d.Targets); i++ {
+			_ = d.Targets[i].Close()
+		}
+	}
+	return dc, true, false
 }
 
-func (d *Manager) recycle(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// order returns the enabled targets to dial in order, the healthy ones by the strategy if any.
+func (d *Manager) order(pinned string) []*Target {
+	d.Lock()
+	defer d.Unlock()
+
+	if pinned != "" {
+		// the connections of the disabled ones are closed by the recycle
+		if i := d.indexOf(pinned); i >= 0 && !d.Targets[i].Disabled {
+			return []*Target{d.Targets[i]}
+		}
+		return nil
+	}
 
+	targets := make([]*Target, 0, len(d.Targets))
+	for _, t := range d.Targets {
+		if !t.Disabled {
+			targets = append(targets, t)
+		}
+	}
+
+	// the unhealthy ones are tried only when all are unhealthy, the probes may be wrong
+	healthy := make([]*Target, 0, len(targets))
+	for _, t := range targets {
+		if !t.Unhealthy {
+			healthy = append(healthy, t)
+		}
+	}
+	if len(healthy) > 0 {
+		targets = healthy
+	}
+	if d.strategy == nil {
+		return d.stick(d.tiered(targets))
+	}
+	return d.tiered(targets)
+}
+
+func (d *Manager) recycle(interval time.Duration) {
 	for {
 		select {
-		case <-ticker.C:
+		case <-d.after(interval):
 			d.runRecycle()
 			d.healthCheck()
 
@@ -141,7 +386,8 @@ func (d *Manager) runRecycle() {
 	defer d.Unlock()
 
 	for _, target := range d.Targets {
-		if target.Disabled {
+		// the draining ones are closed by Drain gracefully
+		if target.Disabled && !target.draining {
 			target.Close()
 			target.Conns = make(map[string]*DualConn)
 			continue
@@ -158,23 +404,45 @@ func (d *Manager) runRecycle() {
 
 func (d *Manager) healthCheck() {
 	d.Lock()
-	defer d.Unlock()
-
+	if len(d.Targets) == 0 {
+		// none discovered yet
+		d.Unlock()
+		return
+	}
 	target := d.Targets[0]
-	if target.Disabled {
+	disabled := target.Disabled
+	balanced := d.strategy != nil
+	d.Unlock()
+
+	// the balancing strategies have no protagonist
+	if disabled || balanced {
 		return
 	}
 
-	conn, err := d.Dialer.DialContext(context.Background(), "tcp", target.Addr)
+	conn, _, err := d.dialEndpoint(context.Background(), "tcp", target.Addr)
+	d.Lock()
+	if err != nil {
+		d.recoveredAt = time.Time{}
+	} else if d.recoveredAt.IsZero() {
+		d.recoveredAt = d.clock.Now()
+	}
+	allowed := d.failbackAllowed()
+	d.Unlock()
 	if err != nil {
 		return
 	}
-	defer conn.Close()
+	_ = conn.Close()
 
-	if d.ProtagonistHalo {
-		for i := 1; i < len(d.Targets); i++ {
-			_ = d.Targets[i].Close()
-		}
+	// 主角复活，需先通过冒烟测试，并等到允许回切
+	if !d.ProtagonistHalo || !allowed || !d.smokeReady(context.Background(), target) {
+		return
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	for i := 1; i < len(d.Targets); i++ {
+		_ = d.Targets[i].Close()
 	}
 }
 
@@ -194,6 +462,25 @@ type Target struct {
 	LastErr  string               `json:"lastErr,omitempty"`
 	DialTime *time.Time           `json:"dialTime,omitempty"`
 	Conns    map[string]*DualConn `json:"conns,omitempty"`
+	// Smoke is the result of the last smoke test, see Manager.WithSmokeTest.
+	Smoke *SmokeResult `json:"smoke,omitempty"`
+	// Latency is the moving average of the successful dials, for the strategies like LeastLatency.
+	Latency time.Duration `json:"latency,omitempty"`
+	// Unhealthy is marked by the prober, see Manager.WithProber, ProbeErr is the error of its last probe.
+	Unhealthy bool   `json:"unhealthy,omitempty"`
+	ProbeErr  string `json:"probeErr,omitempty"`
+	// Breaker is the circuit breaker of the target, see Manager.WithBreaker.
+	Breaker *Breaker `json:"breaker,omitempty"`
+	// InUse counts the open connections, capped by Manager.WithMaxConnsPerTarget.
+	InUse int `json:"inUse"`
+	// Tier is the priority tier of the target, see Manager.WithTargetTier.
+	Tier string `json:"tier,omitempty"`
+
+	probeFalls, probeRises int
+	draining               bool
+	// pending counts the dials in flight, toward the cap
+	pending int
+	stats   *connStats
 }
 
 func (t *Target) SetDisabled(disabled bool) {
@@ -231,6 +518,15 @@ type DualConn struct {
 	CloseErr string `json:"closeErr,omitempty"`
 
 	Closed bool `json:"closed"`
+	// Created is the time the connection was dialed, for its age.
+	Created time.Time `json:"created"`
+
+	// stats are the counters of its target
+	stats *connStats
+	// busy counts the reads and writes in progress, and transferred the bytes read and written,
+	// to drain the idle connections without the lock of the reads and writes
+	busy        atomic.Int32
+	transferred atomic.Int64
 }
 
 func Now() *time.Time {
@@ -243,9 +539,14 @@ func (d *DualConn) Unwrap() net.Conn {
 }
 
 func (d *DualConn) Read(b []byte) (n int, err error) {
+	d.busy.Add(1)
+	defer d.busy.Add(-1)
+
 	n, err = d.conn.Read(b)
 	d.ReadLast = Now()
 	d.ReadN += n
+	d.transferred.Add(int64(n))
+	d.stats.read.Add(int64(n))
 	if err != nil {
 		d.ReadErr = err.Error()
 	}
@@ -254,9 +555,14 @@ func (d *DualConn) Read(b []byte) (n int, err error) {
 }
 
 func (d *DualConn) Write(b []byte) (n int, err error) {
+	d.busy.Add(1)
+	defer d.busy.Add(-1)
+
 	n, err = d.conn.Write(b)
 	d.WriteLast = Now()
 	d.WriteN += n
+	d.transferred.Add(int64(n))
+	d.stats.written.Add(int64(n))
 	if err != nil {
 		d.WriteErr = err.Error()
 	}
@@ -285,4 +591,12 @@ func (d *DualConn) HasError() bool {
 	return d.Closed || d.CloseErr != "" || d.ReadErr != "" || d.WriteErr != ""
 }
 
-var ErrNotAvailable = errors.New("not available")
+var (
+	ErrNotAvailable = errors.New("not available")
+	// ErrClosed fails the dials after the Manager is closed.
+	ErrClosed = errors.New("manager closed")
+	// ErrUnknownTarget is the error of the operations on the targets not in the Manager.
+	ErrUnknownTarget = errors.New("unknown target")
+	// ErrDuplicateTarget is the error of adding the target already in the Manager.
+	ErrDuplicateTarget = errors.New("duplicate target")
+)
@@ -0,0 +1,134 @@
+package dualconn
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// The kinds of the Events.
+const (
+	// EventDown is a target failing a dial, a probe or the smoke test, or opening its breaker.
+	EventDown = "down"
+	// EventRecovered is a target down before passing a dial or the probes again.
+	EventRecovered = "recovered"
+	EventDisabled  = "disabled"
+	EventEnabled   = "enabled"
+	// EventFailover is the dials switching from the active target to another, From and To are their addresses.
+	EventFailover = "failover"
+)
+
+// The states of the targets in the Events.
+const (
+	StateUp       = "up"
+	StateDown     = "down"
+	StateDisabled = "disabled"
+)
+
+// Event is a change of a target, see Manager.OnEvent.
+type Event struct {
+	Kind   string    `json:"kind"`
+	Target string    `json:"target"`
+	Time   time.Time `json:"time"`
+	// From and To are the previous and the new states of the target, or the targets of a failover.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Err is the cause of a down or failover event.
+	Err error `json:"-"`
+}
+
+// OnEvent calls the handler with the events of the targets, in order on a goroutine of the Manager.
+// The events are dropped when the handlers fall behind by 1024 events.
+func (d *Manager) OnEvent(handler func(Event)) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.eventHandlers = append(d.eventHandlers, handler)
+	if d.events == nil {
+		d.events = make(chan Event, 1024)
+		go d.dispatchEvents()
+	}
+	return d
+}
+
+func (d *Manager) dispatchEvents() {
+	for {
+		select {
+		case e := <-d.events:
+			d.Lock()
+			handlers := d.eventHandlers
+			d.Unlock()
+
+			for _, h := range handlers {
+				h(e)
+			}
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// emit queues the event to the handlers, called under the lock.
+func (d *Manager) emit(e Event) {
+	d.logEvent(e)
+	d.stateChanged()
+	if d.events == nil {
+		return
+	}
+
+	e.Time = d.clock.Now()
+	select {
+	case d.events <- e:
+	default:
+		log.Printf("event handlers fall behind, %s event of %s dropped", e.Kind, e.Target)
+	}
+}
+
+// emitState emits the event of the change from the previous state of the target, if any, called under the lock.
+func (d *Manager) emitState(t *Target, prev string, cause error) {
+	state := t.state()
+	if state == prev {
+		return
+	}
+
+	d.recordTransition(t.Addr, state, cause)
+	e := Event{Target: t.Addr, From: prev, To: state, Err: cause}
+	switch {
+	case state == StateDisabled:
+		e.Kind = EventDisabled
+	case prev == StateDisabled:
+		e.Kind = EventEnabled
+	case state == StateDown:
+		e.Kind = EventDown
+	default:
+		e.Kind = EventRecovered
+	}
+	d.emit(e)
+}
+
+// activate switches the dials to the target, emitting a failover from the previous active one,
+// caused by its last error if any, called under the lock.
+func (d *Manager) activate(t *Target) {
+	if d.Active != "" && d.Active != t.Addr {
+		e := Event{Kind: EventFailover, Target: t.Addr, From: d.Active, To: t.Addr}
+		for _, prev := range d.Targets {
+			if prev.Addr == d.Active && prev.LastErr != "" {
+				e.Err = errors.New(prev.LastErr)
+			}
+		}
+		d.emit(e)
+	}
+	d.Active = t.Addr
+}
+
+// state is disabled, down by the last dial, the probes or the breaker, or else up.
+func (t *Target) state() string {
+	switch {
+	case t.Disabled:
+		return StateDisabled
+	case t.LastErr != "" || t.Unhealthy || t.Breaker != nil && t.Breaker.State == BreakerOpen:
+		return StateDown
+	default:
+		return StateUp
+	}
+}
@@ -0,0 +1,104 @@
+package dualconn
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FailbackPolicy decides when the dials flow back to the protagonist, the first target, after it recovers,
+// the dials stick to the active target until then.
+type FailbackPolicy struct {
+	// Delay is the stabilization window the protagonist stays reachable by the health checks before the failback.
+	Delay time.Duration
+	// Manual fails back only by Manager.Failback.
+	Manual bool
+}
+
+// The failback policies, FailbackAuto by default.
+var (
+	// FailbackAuto dials the protagonist first as soon as it recovers.
+	FailbackAuto = FailbackPolicy{}
+	// FailbackManual fails back only by the operators, see Manager.Failback.
+	FailbackManual = FailbackPolicy{Manual: true}
+)
+
+// FailbackDelayed fails back after the protagonist stays reachable for the stabilization window.
+func FailbackDelayed(window time.Duration) FailbackPolicy {
+	return FailbackPolicy{Delay: window}
+}
+
+// WithFailbackPolicy decides when the dials flow back to the protagonist after it recovers, without the strategies.
+func (d *Manager) WithFailbackPolicy(p FailbackPolicy) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.failback = p
+	return d
+}
+
+// Failback moves the dials back to the protagonist now, like the operators do under FailbackManual,
+// closing the connections to the others by ProtagonistHalo, and fails if the protagonist is not reachable.
+func (d *Manager) Failback(ctx context.Context) error {
+	d.Lock()
+	if len(d.Targets) == 0 {
+		d.Unlock()
+		return ErrNotAvailable
+	}
+	target := d.Targets[0]
+	d.Unlock()
+
+	conn, _, err := d.dialEndpoint(ctx, "tcp", target.Addr)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrNotAvailable, target.Addr, err)
+	}
+	_ = conn.Close()
+	if !d.smokeReady(ctx, target) {
+		return fmt.Errorf("%w %s: smoke test failed", ErrNotAvailable, target.Addr)
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.failingBack = true
+	d.stateChanged()
+	if d.logger != nil {
+		d.logger.Info("failback", "target", target.Addr)
+	}
+	if d.recoveredAt.IsZero() {
+		d.recoveredAt = d.clock.Now()
+	}
+	if d.ProtagonistHalo {
+		for i := 1; i < len(d.Targets); i++ {
+			_ = d.Targets[i].Close()
+		}
+	}
+	return nil
+}
+
+// failbackAllowed tells whether the dials may flow back to the protagonist, called under the lock.
+func (d *Manager) failbackAllowed() bool {
+	switch {
+	case d.failback == FailbackAuto || d.failingBack:
+		return true
+	case d.failback.Manual:
+		return false
+	default:
+		return !d.recoveredAt.IsZero() && d.clock.Now().Sub(d.recoveredAt) >= d.failback.Delay
+	}
+}
+
+// stick moves the active target before the protagonist until the failback is allowed, called under the lock.
+func (d *Manager) stick(targets []*Target) []*Target {
+	if d.Active == "" || len(d.Targets) == 0 || d.Active == d.Targets[0].Addr || d.failbackAllowed() {
+		return targets
+	}
+
+	for i, t := range targets {
+		if t.Addr == d.Active {
+			ordered := append([]*Target{t}, targets[:i]...)
+			return append(ordered, targets[i+1:]...)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,110 @@
+package dualconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialTarget dials by the Manager and returns the target the connection landed on.
+func dialTarget(t *testing.T, m *Manager) (string, net.Conn) {
+	t.Helper()
+
+	conn, err := m.DialContext(context.Background(), "tcp", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.RemoteAddr().String(), conn
+}
+
+// failover moves the dials to the second target, by a dial while the protagonist is disabled.
+func failover(t *testing.T, m *Manager) net.Conn {
+	t.Helper()
+
+	m.Lock()
+	m.Targets[0].Disabled = true
+	m.Unlock()
+	_, conn := dialTarget(t, m)
+	m.Lock()
+	m.Targets[0].Disabled = false
+	m.Unlock()
+	return conn
+}
+
+func TestFailbackAuto(t *testing.T) {
+	a, b := streamTarget(t), streamTarget(t)
+	m := NewManager([]string{a, b}, time.Second)
+	t.Cleanup(func() { _ = m.Close() })
+
+	failover(t, m)
+	if got, _ := dialTarget(t, m); got != a {
+		t.Fatalf("dialed %s, want the protagonist at once", got)
+	}
+}
+
+func TestFailbackManual(t *testing.T) {
+	a, b := streamTarget(t), streamTarget(t)
+	m := NewManager([]string{a, b}, time.Second).WithFailbackPolicy(FailbackManual).WithProtagonistHalo()
+	t.Cleanup(func() { _ = m.Close() })
+
+	backup := failover(t, m)
+	m.Lock()
+	m.recoveredAt = time.Now().Add(-time.Hour)
+	m.Unlock()
+	if got, _ := dialTarget(t, m); got != b {
+		t.Fatalf("dialed %s, want the active one until the failback", got)
+	}
+
+	if err := m.Failback(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the protagonist halo closes the connections to the others
+	if _, err := backup.Write([]byte{1}); err == nil {
+		t.Fatal("connection to the backup not closed by the failback")
+	}
+	if got, _ := dialTarget(t, m); got != a {
+		t.Fatalf("dialed %s after the failback, want the protagonist", got)
+	}
+
+	// the failback is done, the next failover sticks again
+	failover(t, m)
+	if got, _ := dialTarget(t, m); got != b {
+		t.Fatalf("dialed %s after another failover, want the active one", got)
+	}
+}
+
+func TestFailbackUnreachable(t *testing.T) {
+	closed, open := listenTargets(t)
+	m := NewManager([]string{closed, open}, time.Second).WithFailbackPolicy(FailbackManual)
+	t.Cleanup(func() { _ = m.Close() })
+
+	if err := m.Failback(context.Background()); !errors.Is(err, ErrNotAvailable) {
+		t.Fatalf("failback: %v, want ErrNotAvailable", err)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.failingBack {
+		t.Fatal("failing back to the unreachable protagonist")
+	}
+}
+
+func TestFailbackDelayResetByFailedDial(t *testing.T) {
+	closed, open := listenTargets(t)
+	m := NewManager([]string{closed, open}, time.Second).WithFailbackPolicy(FailbackPolicy{Delay: time.Minute})
+	t.Cleanup(func() { _ = m.Close() })
+
+	// a failed dial of the protagonist starts the stabilization window over
+	m.Lock()
+	m.recoveredAt = time.Now().Add(-time.Hour)
+	m.Unlock()
+	if got, _ := dialTarget(t, m); got != open {
+		t.Fatalf("dialed %s, want the backup", got)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if !m.recoveredAt.IsZero() || m.failbackAllowed() {
+		t.Fatalf("recovered at %s after the failed dial, want the window reset", m.recoveredAt)
+	}
+}
@@ -0,0 +1,65 @@
+package dualconn
+
+import (
+	"context"
+	"net"
+)
+
+// Lease is a connection leased from the Manager, for users other than database drivers
+// (like custom TCP protocols) to build their own pooling on top,
+// while still feeding the health signals back to the Manager.
+type Lease struct {
+	*DualConn
+
+	mgr    *Manager
+	target *Target
+	done   bool
+}
+
+// Lease dials a connection to the first available target, and tracks it until released.
+func (d *Manager) Lease(ctx context.Context) (*Lease, error) {
+	dc, target, err := d.dial(ctx, "tcp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Lease{DualConn: dc, mgr: d, target: target}, nil
+}
+
+// Target returns the address of the target the connection is leased from.
+func (l *Lease) Target() string {
+	return l.target.Addr
+}
+
+// Release closes the healthy connection, and stops tracking it.
+func (l *Lease) Release() error {
+	return l.finish(nil)
+}
+
+// MarkBroken closes the connection found broken by the user, and records the cause on its target.
+func (l *Lease) MarkBroken(cause error) error {
+	if cause == nil {
+		cause = net.ErrClosed
+	}
+	return l.finish(cause)
+}
+
+func (l *Lease) finish(cause error) error {
+	l.mgr.Lock()
+	defer l.mgr.Unlock()
+
+	if l.done {
+		return nil
+	}
+	l.done = true
+
+	if cause != nil {
+		l.target.LastErr = cause.Error()
+	}
+	delete(l.target.Conns, l.ID)
+
+	if l.Closed {
+		return nil
+	}
+	return l.DualConn.Close()
+}
@@ -0,0 +1,59 @@
+package dualconn
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMaxConns is the error of the dials refused by the caps of the connections per target, wrapped in ErrNotAvailable.
+var ErrMaxConns = errors.New("max connections per target reached")
+
+// WithMaxConnsPerTarget caps the connections in use per target, the dials skip the targets at the cap like the ones
+// of the open breakers, and fail by ErrMaxConns if all are, to keep a failover storm from overwhelming the surviving
+// target, see WithConnsQueue to wait for the connections released instead, 0 for no caps.
+func (d *Manager) WithMaxConnsPerTarget(n int) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.maxConns = n
+	return d
+}
+
+// WithConnsQueue queues the dials refused by the caps of WithMaxConnsPerTarget for up to the timeout,
+// bounded by their contexts too, retrying them as the connections are released.
+func (d *Manager) WithConnsQueue(timeout time.Duration) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.connsQueue = timeout
+	return d
+}
+
+// full tells whether the target is at the cap, counting the dials in flight, called under the lock.
+func (d *Manager) full(t *Target) bool {
+	t.InUse = openConns(t)
+	return d.maxConns > 0 && t.InUse+t.pending >= d.maxConns
+}
+
+// connsQueueInterval is the interval of the queued dials retried.
+const connsQueueInterval = 50 * time.Millisecond
+
+// waitConns waits before retrying the dials queued since the time, false if the queue times out.
+func (d *Manager) waitConns(ctx context.Context, since time.Time) bool {
+	d.Lock()
+	timeout, clock := d.connsQueue, d.clock
+	d.Unlock()
+
+	wait := min(connsQueueInterval, timeout-clock.Now().Sub(since))
+	if wait <= 0 {
+		return false
+	}
+
+	select {
+	case <-clock.After(wait):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,106 @@
+package dualconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaxConnsPerTarget(t *testing.T) {
+	a, b := streamTarget(t), streamTarget(t)
+	m := NewManager([]string{a, b}, time.Second).WithMaxConnsPerTarget(1)
+	t.Cleanup(func() { _ = m.Close() })
+
+	// the dials skip the targets at the cap, and fail when all are
+	for _, want := range []string{a, b} {
+		conn, err := m.DialContext(context.Background(), "tcp", a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := conn.RemoteAddr().String(); got != want {
+			t.Fatalf("dialed %s, want %s", got, want)
+		}
+	}
+	if _, err := m.DialContext(context.Background(), "tcp", a); !errors.Is(err, ErrNotAvailable) || !errors.Is(err, ErrMaxConns) {
+		t.Fatalf("dial at the caps: %v, want ErrMaxConns", err)
+	}
+}
+
+func TestConnsQueueTimeout(t *testing.T) {
+	addr := streamTarget(t)
+	clock := newFakeClock()
+	m := NewManager([]string{addr}, time.Second).WithClock(clock).WithMaxConnsPerTarget(1).WithConnsQueue(120 * time.Millisecond)
+	t.Cleanup(func() { _ = m.Close() })
+
+	if _, err := m.DialContext(context.Background(), "tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.DialContext(context.Background(), "tcp", addr)
+		done <- err
+	}()
+
+	// retried by the interval, the last wait is the rest of the timeout
+	for _, wait := range []time.Duration{connsQueueInterval, connsQueueInterval, 20 * time.Millisecond} {
+		clock.awaitTimer(t, wait)
+		select {
+		case err := <-done:
+			t.Fatalf("queued dial failed before the timeout: %v", err)
+		default:
+		}
+		clock.Advance(wait)
+	}
+	if err := <-done; !errors.Is(err, ErrMaxConns) {
+		t.Fatalf("queued dial: %v, want ErrMaxConns at the timeout", err)
+	}
+}
+
+func TestConnsQueueReleased(t *testing.T) {
+	addr := streamTarget(t)
+	clock := newFakeClock()
+	m := NewManager([]string{addr}, time.Second).WithClock(clock).WithMaxConnsPerTarget(1).WithConnsQueue(time.Second)
+	t.Cleanup(func() { _ = m.Close() })
+
+	conn, err := m.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.DialContext(context.Background(), "tcp", addr)
+		done <- err
+	}()
+
+	clock.awaitTimer(t, connsQueueInterval)
+	_ = conn.Close()
+	clock.Advance(connsQueueInterval)
+	if err := <-done; err != nil {
+		t.Fatalf("queued dial after the release: %v", err)
+	}
+}
+
+func TestConnsQueueCanceled(t *testing.T) {
+	addr := streamTarget(t)
+	clock := newFakeClock()
+	m := NewManager([]string{addr}, time.Second).WithClock(clock).WithMaxConnsPerTarget(1).WithConnsQueue(time.Minute)
+	t.Cleanup(func() { _ = m.Close() })
+
+	if _, err := m.DialContext(context.Background(), "tcp", addr); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.DialContext(ctx, "tcp", addr)
+		done <- err
+	}()
+
+	// bounded by the context too, within the queue timeout
+	clock.awaitTimer(t, connsQueueInterval)
+	cancel()
+	if err := <-done; !errors.Is(err, ErrMaxConns) {
+		t.Fatalf("canceled queued dial: %v, want ErrMaxConns", err)
+	}
+}
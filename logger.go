@@ -0,0 +1,49 @@
+package dualconn
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithLogger logs the decisions of the Manager by the structured logger, the dials at Debug (Warn if failed),
+// the failovers and the targets down at Warn, the recoveries, the failbacks and the enabled or disabled targets
+// at Info, filtered by the level of its handler. Nothing is logged without it.
+func (d *Manager) WithLogger(l *slog.Logger) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.logger = l
+	return d
+}
+
+// logDial logs the dial to the target at the index.
+func (d *Manager) logDial(logger *slog.Logger, target string, index int, cost time.Duration, err error) {
+	if logger == nil {
+		return
+	}
+	if err != nil {
+		logger.LogAttrs(context.Background(), slog.LevelWarn, "dial failed",
+			slog.String("target", target), slog.Int("index", index), slog.Duration("cost", cost), slog.Any("error", err))
+		return
+	}
+	logger.LogAttrs(context.Background(), slog.LevelDebug, "dial",
+		slog.String("target", target), slog.Int("index", index), slog.Duration("cost", cost))
+}
+
+// logEvent logs the event, called under the lock.
+func (d *Manager) logEvent(e Event) {
+	if d.logger == nil {
+		return
+	}
+
+	level := slog.LevelInfo
+	if e.Kind == EventDown || e.Kind == EventFailover {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{slog.String("target", e.Target), slog.String("from", e.From), slog.String("to", e.To)}
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	d.logger.LogAttrs(context.Background(), level, e.Kind, attrs...)
+}
@@ -0,0 +1,137 @@
+// Package metrics emits the metrics of the dualconn Manager and the db package to pluggable sinks.
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// Sink receives the metrics, tags are in the form of key:value.
+type Sink interface {
+	Count(name string, value int64, tags ...string)
+	Timing(name string, value time.Duration, tags ...string)
+	Gauge(name string, value float64, tags ...string)
+}
+
+// The metrics emitted.
+const (
+	DialAttempts  = "dial.attempts"
+	DialFailures  = "dial.failures"
+	DialLatency   = "dial.latency"
+	Failovers     = "failovers"
+	TargetEnabled = "target.enabled"
+	TargetConns   = "target.conns"
+	Queries       = "query.count"
+	QueryErrors   = "query.errors"
+	QueryDuration = "query.duration"
+	ProxyConns    = "proxy.conns"
+	ProxyErrors   = "proxy.errors"
+	ProxyBytes    = "proxy.bytes"
+	ProxyDuration = "proxy.duration"
+	DNSResolves   = "dns.resolves"
+	DNSFailures   = "dns.failures"
+	DNSLatency    = "dns.latency"
+	// SLOAvailability, SLOBudget and SLOBurnRate are the budgets of the targets by Manager.WithSLO,
+	// the burn rates tagged by the window.
+	SLOAvailability = "slo.availability"
+	SLOBudget       = "slo.budget_remaining"
+	SLOBurnRate     = "slo.burn_rate"
+	// OTLPLogsDropped counts the log records the OTLP exporter dropped beyond OTLP.MaxLogs.
+	OTLPLogsDropped = "otlp.logs_dropped"
+)
+
+// ObserveManager emits the dial metrics, the failovers (the changes of the active target, tagged by the new one)
+// and the resolution ones of the DNS cache of the Manager to the sink,
+// and samples the target gauges every interval until the context is done.
+func ObserveManager(ctx context.Context, m *dualconn.Manager, sink Sink, interval time.Duration) {
+	m.WithDialObserver(func(target string, _ int, cost time.Duration, err error) {
+		tag := "target:" + target
+		sink.Count(DialAttempts, 1, tag)
+		sink.Timing(DialLatency, cost, tag)
+		if err != nil {
+			sink.Count(DialFailures, 1, tag)
+		}
+	})
+	m.OnEvent(func(e dualconn.Event) {
+		if e.Kind == dualconn.EventFailover {
+			sink.Count(Failovers, 1, "target:"+e.To)
+		}
+	})
+	m.WithResolveObserver(func(host string, cost time.Duration, err error) {
+		tag := "host:" + host
+		sink.Count(DNSResolves, 1, tag)
+		sink.Timing(DNSLatency, cost, tag)
+		if err != nil {
+			sink.Count(DNSFailures, 1, tag)
+		}
+	})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sampleTargets(m, sink)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func sampleTargets(m *dualconn.Manager, sink Sink) {
+	for _, s := range m.SLO() {
+		tag := "target:" + s.Addr
+		sink.Gauge(SLOAvailability, s.Availability, tag)
+		sink.Gauge(SLOBudget, s.BudgetRemaining, tag)
+		for window, rate := range s.BurnRates {
+			sink.Gauge(SLOBurnRate, rate, tag, "window:"+window)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, t := range m.Targets {
+		tag := "target:" + t.Addr
+		enabled := 1.0
+		if t.Disabled {
+			enabled = 0
+		}
+		sink.Gauge(TargetEnabled, enabled, tag)
+		sink.Gauge(TargetConns, float64(len(t.Conns)), tag)
+	}
+}
+
+// ObserveProxy emits the metrics of the connections relayed by the Proxy to the sink, the proxied tag tells
+// whether the client addresses come from the PROXY protocol headers, and the closed tag the reason of closing.
+func ObserveProxy(p *dualconn.Proxy, sink Sink) {
+	p.WithObserver(func(c dualconn.ProxyConn) {
+		tags := []string{"target:" + c.Target, "proxied:" + strconv.FormatBool(c.Proxied)}
+		sink.Count(ProxyConns, 1, append(tags, "closed:"+c.Closed)...)
+		sink.Timing(ProxyDuration, c.Cost, tags...)
+		sink.Count(ProxyBytes, c.Received, append(tags, "direction:received")...)
+		sink.Count(ProxyBytes, c.Sent, append(tags, "direction:sent")...)
+		if c.Err != nil {
+			sink.Count(ProxyErrors, 1, tags...)
+		}
+	})
+}
+
+// ObserveQueries emits the metrics of the statements run by db.RunSQL to the sink.
+func ObserveQueries(sink Sink) {
+	db.UseQueryObserver(func(ctx context.Context, query string, result *db.QueryResult, cost time.Duration) {
+		tag := "priority:" + string(db.PriorityFrom(ctx))
+		sink.Count(Queries, 1, tag)
+		sink.Timing(QueryDuration, cost, tag)
+		if result.Error != "" {
+			sink.Count(QueryErrors, 1, tag)
+		}
+	})
+}
@@ -0,0 +1,296 @@
+package metrics
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP is a Sink exporting the metrics, and an io.Writer exporting the log lines,
+// to an OpenTelemetry collector by OTLP/HTTP in JSON encoding.
+// Counters are exported as cumulative sums, timings as histograms (in ms) and gauges as gauges.
+type OTLP struct {
+	MetricsURL string
+	LogsURL    string
+	Headers    map[string]string
+	Resource   map[string]string
+	Interval   time.Duration
+	// MaxLogs bounds the log records buffered between the exports, the oldest are dropped beyond it
+	// and counted by OTLPLogsDropped, 10000 by default.
+	MaxLogs int
+
+	client *http.Client
+	lock   sync.Mutex
+	start  time.Time
+	series map[string]*otlpSeries
+	logs   []otlpLogRecord
+}
+
+type otlpSeries struct {
+	name  string
+	kind  string // sum, histogram, gauge
+	tags  []string
+	count int64
+	sum   float64
+	value float64
+}
+
+type otlpLogRecord struct {
+	time time.Time
+	body string
+}
+
+// NewOTLPFromEnv creates the OTLP exporter configured by the standard environment variables:
+// OTEL_EXPORTER_OTLP_ENDPOINT (http://localhost:4318 by default), OTEL_EXPORTER_OTLP_METRICS_ENDPOINT,
+// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME,
+// OTEL_RESOURCE_ATTRIBUTES and OTEL_METRIC_EXPORT_INTERVAL (in ms, 60000 by default).
+// Only the http/json protocol is supported.
+func NewOTLPFromEnv() (*OTLP, error) {
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" && p != "http/json" {
+		return nil, fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_PROTOCOL %s, only http/json is supported", p)
+	}
+
+	endpoint := strings.TrimSuffix(cmp.Or(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "http://localhost:4318"), "/")
+	o := &OTLP{
+		MetricsURL: cmp.Or(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"), endpoint+"/v1/metrics"),
+		LogsURL:    cmp.Or(os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"), endpoint+"/v1/logs"),
+		Headers:    parseKeyValues(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		Resource:   parseKeyValues(os.Getenv("OTEL_RESOURCE_ATTRIBUTES")),
+		Interval:   time.Minute,
+	}
+	o.Resource["service.name"] = cmp.Or(os.Getenv("OTEL_SERVICE_NAME"), o.Resource["service.name"], "dualconn")
+
+	if v := os.Getenv("OTEL_METRIC_EXPORT_INTERVAL"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("OTEL_METRIC_EXPORT_INTERVAL: %w", err)
+		}
+		o.Interval = time.Duration(ms) * time.Millisecond
+	}
+
+	return o, nil
+}
+
+// parseKeyValues parses k1=v1,k2=v2.
+func parseKeyValues(s string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return m
+}
+
+func (o *OTLP) Count(name string, value int64, tags ...string) {
+	o.update(name, "sum", tags, func(s *otlpSeries) { s.count += value })
+}
+
+func (o *OTLP) Timing(name string, value time.Duration, tags ...string) {
+	o.update(name, "histogram", tags, func(s *otlpSeries) {
+		s.count++
+		s.sum += float64(value) / float64(time.Millisecond)
+	})
+}
+
+func (o *OTLP) Gauge(name string, value float64, tags ...string) {
+	o.update(name, "gauge", tags, func(s *otlpSeries) { s.value = value })
+}
+
+func (o *OTLP) update(name, kind string, tags []string, f func(s *otlpSeries)) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	f(o.seriesOf(name, kind, tags))
+}
+
+// seriesOf returns the series of the name and the tags, created if none, called under the lock.
+func (o *OTLP) seriesOf(name, kind string, tags []string) *otlpSeries {
+	key := name + "|" + strings.Join(tags, ",")
+	if o.series == nil {
+		o.series = map[string]*otlpSeries{}
+	}
+	s, ok := o.series[key]
+	if !ok {
+		s = &otlpSeries{name: name, kind: kind, tags: tags}
+		o.series[key] = s
+	}
+	return s
+}
+
+// Write exports p as a log record, so that the OTLP can be the output of a log.Logger.
+func (o *OTLP) Write(p []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// the records pile up while the collector is slow or down, the oldest are dropped first
+	if len(o.logs) >= cmp.Or(o.MaxLogs, 10000) {
+		o.logs = o.logs[1:]
+		o.seriesOf(OTLPLogsDropped, "sum", nil).count++
+	}
+	o.logs = append(o.logs, otlpLogRecord{time: time.Now(), body: strings.TrimSuffix(string(p), "\n")})
+	return len(p), nil
+}
+
+// Run exports every interval until the context is done, with a final export.
+func (o *OTLP) Run(ctx context.Context) {
+	o.client = &http.Client{Timeout: 10 * time.Second}
+	o.start = time.Now()
+
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			o.export()
+		case <-ctx.Done():
+			o.export()
+			return
+		}
+	}
+}
+
+func (o *OTLP) export() {
+	metrics, logs := o.payloads()
+	if metrics != nil {
+		o.post(o.MetricsURL, metrics)
+	}
+	if logs != nil {
+		o.post(o.LogsURL, logs)
+	}
+}
+
+func (o *OTLP) post(url string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "otlp marshal error: %v\n", err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "otlp request error: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+
+	rsp, err := o.client.Do(req)
+	if err != nil {
+		// not by log, which may be exported here again
+		fmt.Fprintf(os.Stderr, "otlp export to %s error: %v\n", url, err)
+		return
+	}
+	defer rsp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	if rsp.StatusCode/100 != 2 {
+		fmt.Fprintf(os.Stderr, "otlp export to %s status: %s\n", url, rsp.Status)
+	}
+}
+
+type (
+	jsonObject = map[string]any
+	jsonArray  = []any
+)
+
+func (o *OTLP) payloads() (metrics, logs jsonObject) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := strconv.FormatInt(o.start.UnixNano(), 10)
+	resource := jsonObject{"attributes": attributes(o.Resource)}
+	scope := jsonObject{"name": "github.com/bingoohuang/dualconn"}
+
+	if len(o.series) > 0 {
+		keys := make([]string, 0, len(o.series))
+		for k := range o.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var ms jsonArray
+		for _, k := range keys {
+			s := o.series[k]
+			point := jsonObject{"attributes": tagAttributes(s.tags), "startTimeUnixNano": start, "timeUnixNano": now}
+			metric := jsonObject{"name": s.name}
+			switch s.kind {
+			case "sum":
+				point["asInt"] = strconv.FormatInt(s.count, 10)
+				metric["sum"] = jsonObject{"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": jsonArray{point}}
+			case "histogram":
+				point["count"] = strconv.FormatInt(s.count, 10)
+				point["sum"] = s.sum
+				point["bucketCounts"] = jsonArray{strconv.FormatInt(s.count, 10)}
+				point["explicitBounds"] = jsonArray{}
+				metric["unit"] = "ms"
+				metric["histogram"] = jsonObject{"aggregationTemporality": 2, "dataPoints": jsonArray{point}}
+			case "gauge":
+				point["asDouble"] = s.value
+				metric["gauge"] = jsonObject{"dataPoints": jsonArray{point}}
+			}
+			ms = append(ms, metric)
+		}
+
+		metrics = jsonObject{"resourceMetrics": jsonArray{jsonObject{
+			"resource":     resource,
+			"scopeMetrics": jsonArray{jsonObject{"scope": scope, "metrics": ms}},
+		}}}
+	}
+
+	if len(o.logs) > 0 {
+		records := make(jsonArray, len(o.logs))
+		for i, l := range o.logs {
+			records[i] = jsonObject{
+				"timeUnixNano": strconv.FormatInt(l.time.UnixNano(), 10),
+				"severityText": "INFO",
+				"body":         jsonObject{"stringValue": l.body},
+			}
+		}
+		o.logs = nil
+
+		logs = jsonObject{"resourceLogs": jsonArray{jsonObject{
+			"resource":  resource,
+			"scopeLogs": jsonArray{jsonObject{"scope": scope, "logRecords": records}},
+		}}}
+	}
+
+	return metrics, logs
+}
+
+func attributes(m map[string]string) jsonArray {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make(jsonArray, len(keys))
+	for i, k := range keys {
+		attrs[i] = jsonObject{"key": k, "value": jsonObject{"stringValue": m[k]}}
+	}
+	return attrs
+}
+
+func tagAttributes(tags []string) jsonArray {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		k, v, _ := strings.Cut(tag, ":")
+		m[k] = v
+	}
+	return attributes(m)
+}
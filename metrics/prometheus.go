@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds (in seconds) of the histogram buckets of the timings.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Prometheus is a Sink collecting the metrics, and an http.Handler exposing them in the Prometheus text format.
+// Counters are exposed as name_total, timings as histograms name_seconds, and gauges as they are,
+// with the names prefixed like dualconn_dial_attempts_total, and the tags as labels.
+type Prometheus struct {
+	Prefix  string
+	Buckets []float64
+
+	lock   sync.Mutex
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	name   string
+	kind   string // counter, histogram, gauge
+	labels string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheus creates the Prometheus sink, the prefix is dualconn by default.
+func NewPrometheus(prefix string) *Prometheus {
+	if prefix == "" {
+		prefix = "dualconn"
+	}
+	return &Prometheus{Prefix: prefix, Buckets: DefaultBuckets, series: map[string]*promSeries{}}
+}
+
+func (p *Prometheus) Count(name string, value int64, tags ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.get(name+"_total", "counter", tags).value += float64(value)
+}
+
+func (p *Prometheus) Timing(name string, value time.Duration, tags ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := p.get(name+"_seconds", "histogram", tags)
+	seconds := value.Seconds()
+	for i, le := range p.Buckets {
+		if seconds <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += seconds
+	s.count++
+}
+
+func (p *Prometheus) Gauge(name string, value float64, tags ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.get(name, "gauge", tags).value = value
+}
+
+func (p *Prometheus) get(name, kind string, tags []string) *promSeries {
+	name = promName(p.Prefix + "_" + name)
+	labels := promLabels(tags)
+	key := name + "{" + labels + "}"
+	s, ok := p.series[key]
+	if !ok {
+		s = &promSeries{name: name, kind: kind, labels: labels}
+		if kind == "histogram" {
+			s.counts = make([]uint64, len(p.Buckets))
+		}
+		p.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	keys := make([]string, 0, len(p.series))
+	for k := range p.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var b strings.Builder
+	typed := map[string]bool{}
+	for _, k := range keys {
+		s := p.series[k]
+		if !typed[s.name] {
+			typed[s.name] = true
+			fmt.Fprintf(&b, "# TYPE %s %s\n", s.name, s.kind)
+		}
+
+		if s.kind != "histogram" {
+			fmt.Fprintf(&b, "%s%s %s\n", s.name, braced(s.labels), formatFloat(s.value))
+			continue
+		}
+		for i, le := range p.Buckets {
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, braced(joinLabels(s.labels, `le="`+formatFloat(le)+`"`)), s.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", s.name, braced(joinLabels(s.labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", s.name, braced(s.labels), formatFloat(s.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", s.name, braced(s.labels), s.count)
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// promName replaces the characters invalid in the Prometheus metric names, like the dots, by underscores.
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// promLabels converts the tags in the form of key:value to the labels, sorted by the keys.
+func promLabels(tags []string) string {
+	labels := make([]string, 0, len(tags))
+	for _, t := range tags {
+		k, v, _ := strings.Cut(t, ":")
+		labels = append(labels, promName(k)+"="+strconv.Quote(v))
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statsd is a Sink emitting the metrics to statsd over UDP.
+// With DogStatsD, the tags (the static Tags first) are sent as DogStatsD tags,
+// otherwise their values are folded into the metric names, like prefix.dial.attempts.prod.127_0_0_1_3306.
+type Statsd struct {
+	Prefix    string
+	Tags      []string
+	DogStatsD bool
+
+	conn net.Conn
+}
+
+func NewStatsd(addr, prefix string, dogStatsD bool, tags ...string) (*Statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Statsd{Prefix: prefix, Tags: tags, DogStatsD: dogStatsD, conn: conn}, nil
+}
+
+func (s *Statsd) Close() error { return s.conn.Close() }
+
+func (s *Statsd) Count(name string, value int64, tags ...string) {
+	s.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (s *Statsd) Timing(name string, value time.Duration, tags ...string) {
+	s.send(name, strconv.FormatFloat(float64(value)/float64(time.Millisecond), 'f', -1, 64), "ms", tags)
+}
+
+func (s *Statsd) Gauge(name string, value float64, tags ...string) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+func (s *Statsd) send(name, value, typ string, tags []string) {
+	if s.Prefix != "" {
+		name = s.Prefix + "." + name
+	}
+
+	var line string
+	all := append(append([]string{}, s.Tags...), tags...)
+	if s.DogStatsD {
+		line = fmt.Sprintf("%s:%s|%s", name, value, typ)
+		if len(all) > 0 {
+			line += "|#" + strings.Join(all, ",")
+		}
+	} else {
+		for _, tag := range all {
+			_, v, _ := strings.Cut(tag, ":")
+			name += "." + statsdReplacer.Replace(v)
+		}
+		line = fmt.Sprintf("%s:%s|%s", name, value, typ)
+	}
+
+	// UDP, fire and forget
+	_, _ = s.conn.Write([]byte(line))
+}
+
+var statsdReplacer = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", "/", "_")
@@ -0,0 +1,34 @@
+package dualconn
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// PgDialer adapts the Manager to the dialers of the Postgres drivers, the address of the DSN is ignored
+// for the one of the available target, like:
+//
+//	// pgx
+//	cfg, _ := pgx.ParseConfig("postgres://u:p@placeholder:5432/db")
+//	cfg.DialFunc = dualconn.PgDialer{Manager: m}.DialContext
+//	// lib/pq
+//	connector.Dialer(dualconn.PgDialer{Manager: m})
+//
+// Keep a single host in the DSN, or the driver falls back among the hosts by itself.
+type PgDialer struct {
+	*Manager
+}
+
+// Dial implements the pq.Dialer.
+func (p PgDialer) Dial(network, address string) (net.Conn, error) {
+	return p.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout implements the pq.Dialer, the timeout bounds the dials to all the targets.
+func (p PgDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return p.DialContext(ctx, network, address)
+}
@@ -0,0 +1,88 @@
+package dualconn
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listenTargets returns a closed target and a listening one, accepting the connections until the test ends.
+func listenTargets(t *testing.T) (closed, open string) {
+	t.Helper()
+
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed = down.Addr().String()
+	_ = down.Close()
+
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		_ = up.Close()
+		lock.Lock()
+		defer lock.Unlock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+	})
+	go func() {
+		for {
+			c, err := up.Accept()
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			conns = append(conns, c)
+			lock.Unlock()
+		}
+	}()
+	return closed, up.Addr().String()
+}
+
+func TestPgDialerFailover(t *testing.T) {
+	closed, open := listenTargets(t)
+
+	dials := map[string]func(p PgDialer) (net.Conn, error){
+		"Dial": func(p PgDialer) (net.Conn, error) { return p.Dial("tcp", "placeholder:5432") },
+		"DialTimeout": func(p PgDialer) (net.Conn, error) {
+			return p.DialTimeout("tcp", "placeholder:5432", 3*time.Second)
+		},
+	}
+	for name, dial := range dials {
+		t.Run(name, func(t *testing.T) {
+			m := NewManager([]string{closed, open}, time.Second)
+			conn, err := dial(PgDialer{Manager: m})
+			if err != nil {
+				t.Fatalf("dial failed over to none: %v", err)
+			}
+			defer conn.Close()
+
+			if got := conn.RemoteAddr().String(); got != open {
+				t.Errorf("dialed %s, want %s", got, open)
+			}
+			m.Lock()
+			active := m.Active
+			m.Unlock()
+			if active != open {
+				t.Errorf("active %s, want %s", active, open)
+			}
+		})
+	}
+}
+
+func TestPgDialerAllDown(t *testing.T) {
+	closed, _ := listenTargets(t)
+
+	m := NewManager([]string{closed}, time.Second)
+	if conn, err := (PgDialer{Manager: m}).DialTimeout("tcp", "placeholder:5432", time.Second); err == nil {
+		_ = conn.Close()
+		t.Fatal("dialed a closed target")
+	}
+}
@@ -0,0 +1,116 @@
+package dualconn
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Probe checks the health of a target, like dialing it or running SELECT 1 on it.
+type Probe func(ctx context.Context, target string) error
+
+// ProbeConfig tunes the background prober of the targets.
+type ProbeConfig struct {
+	// Interval between the probes of a target, 5s by default.
+	Interval time.Duration
+	// Timeout of a probe, the Timeout of the Manager by default.
+	Timeout time.Duration
+	// Jitter randomizes the intervals by the fraction, like 0.1 for ±10%, to spread the probes.
+	Jitter float64
+	// Fall is the consecutive failures to mark a target unhealthy, 3 by default,
+	// Rise the consecutive successes to mark it healthy again, 2 by default.
+	Fall, Rise int
+	// Probe is the check, a dial by the Dialer of the Manager to the endpoint of the target by default,
+	// which only resolves the udp:// targets, probe the UDP sidecars by a Probe exchanging the datagrams with them.
+	Probe Probe
+}
+
+// WithProber probes every target in the background, the dials skip the unhealthy targets,
+// unless all the enabled ones are unhealthy.
+func (d *Manager) WithProber(c ProbeConfig) *Manager {
+	if c.Interval <= 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = d.Timeout
+	}
+	if c.Fall <= 0 {
+		c.Fall = 3
+	}
+	if c.Rise <= 0 {
+		c.Rise = 2
+	}
+	if c.Probe == nil {
+		c.Probe = func(ctx context.Context, target string) error {
+			conn, _, err := d.dialEndpoint(ctx, "tcp", target)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	// the targets discovered later are probed the same
+	d.prober = &c
+	for _, t := range d.Targets {
+		go d.probe(t, c)
+	}
+	return d
+}
+
+func (d *Manager) probe(t *Target, c ProbeConfig) {
+	for {
+		d.Lock()
+		interval := d.jitter(c.Interval, c.Jitter)
+		d.Unlock()
+
+		select {
+		case <-d.after(interval):
+		case <-d.stop:
+			return
+		}
+
+		d.Lock()
+		disabled, gone := t.Disabled, !slices.Contains(d.Targets, t)
+		d.Unlock()
+		if gone {
+			return
+		}
+		if disabled {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+		err := c.Probe(ctx, t.Addr)
+		cancel()
+
+		d.Lock()
+		prev := t.state()
+		t.observeProbe(err, c.Fall, c.Rise)
+		d.emitState(t, prev, err)
+		d.Unlock()
+	}
+}
+
+// observeProbe counts the consecutive results of the probes, and flips the health by the thresholds.
+func (t *Target) observeProbe(err error, fall, rise int) {
+	if err != nil {
+		t.probeRises = 0
+		t.probeFalls++
+		t.ProbeErr = err.Error()
+		if t.probeFalls >= fall {
+			t.Unhealthy = true
+		}
+		return
+	}
+
+	t.probeFalls = 0
+	t.probeRises++
+	t.ProbeErr = ""
+	if t.probeRises >= rise {
+		t.Unhealthy = false
+	}
+}
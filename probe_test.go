@@ -0,0 +1,105 @@
+package dualconn
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestObserveProbe(t *testing.T) {
+	down := errors.New("down")
+	cases := []struct {
+		name      string
+		unhealthy bool
+		results   []error
+		want      bool
+	}{
+		{"healthy below the fall", false, []error{down, down}, false},
+		{"unhealthy at the fall", false, []error{down, down, down}, true},
+		{"a success resets the falls", false, []error{down, down, nil, down, down}, false},
+		{"unhealthy below the rise", true, []error{nil}, true},
+		{"healthy at the rise", true, []error{nil, nil}, false},
+		{"a failure resets the rises", true, []error{nil, down, nil}, true},
+	}
+	for _, c := range cases {
+		target := Target{Unhealthy: c.unhealthy}
+		for _, err := range c.results {
+			target.observeProbe(err, 3, 2)
+		}
+		if target.Unhealthy != c.want {
+			t.Errorf("%s: unhealthy %v, want %v", c.name, target.Unhealthy, c.want)
+		}
+	}
+
+	var target Target
+	target.observeProbe(errors.New("timeout"), 3, 2)
+	if target.ProbeErr != "timeout" {
+		t.Fatalf("probe error %q, want the last one", target.ProbeErr)
+	}
+	target.observeProbe(nil, 3, 2)
+	if target.ProbeErr != "" {
+		t.Fatalf("probe error %q after a success, want none", target.ProbeErr)
+	}
+}
+
+func TestProberSkipsUnhealthy(t *testing.T) {
+	clock := newFakeClock()
+	var failing atomic.Bool
+	failing.Store(true)
+	m := NewManager([]string{"10.0.0.1:3306", "10.0.0.2:3306"}, time.Second).WithClock(clock).WithRand(fakeRand(0.5))
+	m.WithProber(ProbeConfig{
+		Interval: time.Second, Fall: 2, Rise: 2,
+		Probe: func(_ context.Context, target string) error {
+			if target == "10.0.0.1:3306" && failing.Load() {
+				return errors.New("down")
+			}
+			return nil
+		},
+	})
+	t.Cleanup(func() { _ = m.Close() })
+
+	// probe runs the rounds of the probes of both targets
+	probe := func(rounds int) {
+		for range rounds {
+			clock.awaitTimers(t, time.Second, 2)
+			clock.Advance(time.Second)
+		}
+		clock.awaitTimers(t, time.Second, 2)
+	}
+	order := func() []string {
+		return addrs(m.order(""))
+	}
+
+	probe(1)
+	if got := order(); !slices.Equal(got, []string{"10.0.0.1:3306", "10.0.0.2:3306"}) {
+		t.Fatalf("order %v below the fall, want both", got)
+	}
+	probe(1)
+	if got := order(); !slices.Equal(got, []string{"10.0.0.2:3306"}) {
+		t.Fatalf("order %v at the fall, want the healthy one", got)
+	}
+
+	failing.Store(false)
+	probe(2)
+	if got := order(); !slices.Equal(got, []string{"10.0.0.1:3306", "10.0.0.2:3306"}) {
+		t.Fatalf("order %v at the rise, want both", got)
+	}
+}
+
+func TestProberTriesAllUnhealthy(t *testing.T) {
+	m := NewManager([]string{"10.0.0.1:3306", "10.0.0.2:3306"}, time.Second)
+	t.Cleanup(func() { _ = m.Close() })
+
+	// the probes may be wrong, the dials try all the targets when none is healthy
+	m.Lock()
+	for _, target := range m.Targets {
+		target.Unhealthy = true
+	}
+	m.Unlock()
+	if got := addrs(m.order("")); !slices.Equal(got, []string{"10.0.0.1:3306", "10.0.0.2:3306"}) {
+		t.Fatalf("order %v, want all the unhealthy targets", got)
+	}
+}
@@ -0,0 +1,248 @@
+package dualconn
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Proxy relays the TCP connections it accepts to the targets of the Manager, for the clients which can not
+// dial by the Manager themselves, like the ones of other languages in front of the MySQL pair.
+type Proxy struct {
+	Manager *Manager
+	// AcceptProxyProtocol reads the PROXY protocol header (v1 or v2) the downstream load balancers prepend
+	// to the connections, for the original client addresses.
+	AcceptProxyProtocol bool
+	// SendProxyProtocol prepends the PROXY protocol v1 header of the original client address to the upstream
+	// connections, for the targets like MySQL 8 with proxy_protocol_networks.
+	SendProxyProtocol bool
+	// MaxLifetime and MaxBytes (received and sent) close the connections exceeding them, no limits if not set.
+	MaxLifetime time.Duration
+	MaxBytes    int64
+	// Hold holds the new connections when no target is available, like the protagonist dying, retrying the dials
+	// for up to it for the new primary, to smooth over the brief failovers, they fail at once if not set.
+	Hold time.Duration
+	// MySQL parses the handshakes and the COM_QUERY packets of the MySQL protocol, for the users and the queries
+	// to the query observers, and replies the clients the ER_SERVER_SHUTDOWN error instead of the resets when no
+	// target is available or the target goes away, the connections by TLS or compression are relayed as they are.
+	MySQL bool
+
+	observers      []func(ProxyConn)
+	queryObservers []func(ProxyQuery)
+}
+
+// The errors of the relayed connections closed by the limits of the Proxy.
+var (
+	ErrProxyMaxLifetime = errors.New("proxy connection exceeds max lifetime")
+	ErrProxyMaxBytes    = errors.New("proxy connection exceeds max bytes")
+)
+
+// The reasons of closing the relayed connections.
+const (
+	ClosedByClient      = "client"
+	ClosedByTarget      = "target"
+	ClosedByMaxLifetime = "max-lifetime"
+	ClosedByMaxBytes    = "max-bytes"
+)
+
+// ProxyConn is a connection relayed by the Proxy.
+type ProxyConn struct {
+	// Client is the original client address, from the PROXY protocol header if any, Proxied tells so.
+	Client  net.Addr
+	Proxied bool
+	Target  string
+	// User is the MySQL user of the client, by the MySQL-aware Proxy.
+	User  string
+	Start time.Time
+	Cost  time.Duration
+	// Held is the time the connection was held waiting for an available target, see Proxy.Hold.
+	Held time.Duration
+	// Received are the bytes from the client to the target, Sent the ones from the target to the client.
+	Received, Sent int64
+	// Closed is the reason of closing the connection, like ClosedByClient, empty if it failed to be relayed.
+	Closed string
+	Err    error
+}
+
+// NewProxy creates the Proxy relaying to the targets of the Manager.
+func NewProxy(m *Manager) *Proxy {
+	return &Proxy{Manager: m}
+}
+
+// WithObserver adds an observer of the relayed connections, called when they are closed.
+func (p *Proxy) WithObserver(o func(ProxyConn)) *Proxy {
+	p.observers = append(p.observers, o)
+	return p
+}
+
+// Serve relays the connections accepted by the listener until it is closed.
+func (p *Proxy) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go p.relay(conn)
+	}
+}
+
+func (p *Proxy) relay(client net.Conn) {
+	defer client.Close()
+
+	c := ProxyConn{Client: client.RemoteAddr(), Start: time.Now()}
+	defer func() {
+		c.Cost = time.Since(c.Start)
+		for _, o := range p.observers {
+			o(c)
+		}
+	}()
+
+	var downstream io.Reader = client
+	var local net.Addr = client.LocalAddr()
+	if p.AcceptProxyProtocol {
+		br := bufio.NewReader(client)
+		_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		src, dst, err := readProxyHeader(br)
+		_ = client.SetReadDeadline(time.Time{})
+		if err != nil {
+			c.Err = err
+			log.Printf("proxy %s: %v", c.Client, err)
+			return
+		}
+		if src != nil {
+			c.Client, local, c.Proxied = src, dst, true
+		}
+		downstream = br
+	}
+
+	upstream, target, held, err := p.dial()
+	c.Held = held
+	if err != nil {
+		c.Err = err
+		log.Printf("proxy %s: %v", c.Client, err)
+		if p.MySQL {
+			// in place of the greeting of the server
+			_, _ = client.Write(mysqlError(0, 0, mysqlErServerShutdown, err.Error()))
+		}
+		return
+	}
+	defer upstream.Close()
+	c.Target = target.Addr
+
+	if p.SendProxyProtocol {
+		if _, err := io.WriteString(upstream, proxyHeaderV1(c.Client, local)); err != nil {
+			c.Err = err
+			return
+		}
+	}
+
+	var from io.Reader = upstream
+	var session *mysqlSession
+	var serverPackets *mysqlPackets
+	if p.MySQL {
+		session = &mysqlSession{}
+		clientPackets := &mysqlPackets{onPacket: func(seq byte, payload []byte) {
+			if query, ok := session.client(seq, payload); ok {
+				p.observeQuery(ProxyQuery{Client: c.Client, User: session.user, Target: c.Target, Query: query, Time: time.Now()})
+			}
+		}}
+		serverPackets = &mysqlPackets{onPacket: session.server}
+		downstream, from = io.TeeReader(downstream, clientPackets), io.TeeReader(upstream, serverPackets)
+	}
+
+	var once sync.Once
+	var closing atomic.Bool
+	closeBoth := func(reason string, err error) {
+		once.Do(func() {
+			closing.Store(true)
+			c.Closed, c.Err = reason, err
+			_ = client.Close()
+			_ = upstream.Close()
+		})
+	}
+	if p.MaxLifetime > 0 {
+		timer := time.AfterFunc(p.MaxLifetime-time.Since(c.Start), func() {
+			closeBoth(ClosedByMaxLifetime, ErrProxyMaxLifetime)
+		})
+		defer timer.Stop()
+	}
+
+	var total atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := io.Copy(&limitedWriter{w: upstream, total: &total, max: p.MaxBytes}, downstream)
+		c.Received = n
+		closeBoth(closeReason(ClosedByClient, err))
+	}()
+	n, err := io.Copy(&limitedWriter{w: client, total: &total, max: p.MaxBytes}, from)
+	c.Sent = n
+	if session != nil && !closing.Load() && !errors.Is(err, ErrProxyMaxBytes) {
+		session.signal(client, serverPackets.boundary(), mysqlGoneMessage(c.Target, err))
+	}
+	closeBoth(closeReason(ClosedByTarget, err))
+	<-done
+	if session != nil {
+		c.User = session.user
+	}
+
+	if c.Closed != ClosedByMaxBytes && c.Closed != ClosedByMaxLifetime && errors.Is(c.Err, net.ErrClosed) {
+		c.Err = nil
+	}
+}
+
+// proxyHoldInterval is the interval of the dials retried while holding a connection.
+const proxyHoldInterval = 250 * time.Millisecond
+
+// dial dials the targets, retrying for up to Hold while none is available, and returns the time held.
+func (p *Proxy) dial() (*DualConn, *Target, time.Duration, error) {
+	start := time.Now()
+	var held time.Duration
+	for {
+		conn, target, err := p.Manager.dial(context.Background(), "tcp")
+		if !errors.Is(err, ErrNotAvailable) || held >= p.Hold {
+			return conn, target, held, err
+		}
+		time.Sleep(min(proxyHoldInterval, p.Hold-held))
+		held = time.Since(start)
+	}
+}
+
+func (p *Proxy) observeQuery(q ProxyQuery) {
+	for _, o := range p.queryObservers {
+		o(q)
+	}
+}
+
+// closeReason is the reason of the copy from the side ending, by the error.
+func closeReason(side string, err error) (string, error) {
+	if errors.Is(err, ErrProxyMaxBytes) {
+		return ClosedByMaxBytes, err
+	}
+	return side, err
+}
+
+// limitedWriter fails the writes beyond the max bytes written in total with the others, no limit if max is 0.
+type limitedWriter struct {
+	w     io.Writer
+	total *atomic.Int64
+	max   int64
+}
+
+func (l *limitedWriter) Write(b []byte) (int, error) {
+	if l.max > 0 && l.total.Add(int64(len(b))) > l.max {
+		return 0, ErrProxyMaxBytes
+	}
+	return l.w.Write(b)
+}
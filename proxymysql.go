@@ -0,0 +1,238 @@
+package dualconn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ProxyQuery is a COM_QUERY relayed by the MySQL-aware Proxy, see Proxy.MySQL.
+type ProxyQuery struct {
+	Client net.Addr
+	User   string
+	Target string
+	Query  string
+	Time   time.Time
+}
+
+// WithQueryObserver adds an observer of the queries relayed by the MySQL-aware Proxy, called before they are
+// sent to the targets, keep it fast for it blocks the connection.
+func (p *Proxy) WithQueryObserver(o func(ProxyQuery)) *Proxy {
+	p.queryObservers = append(p.queryObservers, o)
+	return p
+}
+
+// the bits of the MySQL capability flags
+const (
+	mysqlClientCompress        = 0x20
+	mysqlClientProtocol41      = 0x200
+	mysqlClientSSL             = 0x800
+	mysqlClientQueryAttributes = 1 << 27
+)
+
+// the MySQL commands inspected
+const (
+	mysqlComQuit       = 0x01
+	mysqlComQuery      = 0x03
+	mysqlComChangeUser = 0x11
+)
+
+// the error replied to the clients when no target is available or the target goes away,
+// for the drivers and the pools to reconnect
+const (
+	mysqlErServerShutdown = 1053
+	mysqlSQLStateShutdown = "08S01"
+)
+
+// mysqlSession follows the MySQL protocol of a relayed connection, by the packets of both sides.
+type mysqlSession struct {
+	sync.Mutex
+	// next is the sequence id of the next packet, of either side
+	next byte
+	caps uint32
+	user string
+	// greeted after the handshake response of the client
+	greeted bool
+	// opaque is the connection turning to TLS or the compression, relayed as it is
+	opaque bool
+	quit   bool
+}
+
+// client inspects the packet from the client, and returns the query if it is a COM_QUERY.
+func (s *mysqlSession) client(seq byte, payload []byte) (query string, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.next = seq + 1
+	if s.opaque {
+		return "", false
+	}
+	if !s.greeted {
+		// HandshakeResponse41: capabilities(4) max packet(4) charset(1) filler(23) username NUL ...
+		// or the SSLRequest of the first 32 bytes of it
+		if len(payload) < 32 {
+			return "", false
+		}
+		s.greeted, s.caps = true, binary.LittleEndian.Uint32(payload)
+		if s.caps&(mysqlClientSSL|mysqlClientCompress) != 0 {
+			s.opaque = true
+		}
+		s.user = cstring(payload[32:])
+		return "", false
+	}
+	if seq != 0 || len(payload) == 0 {
+		return "", false
+	}
+
+	switch payload[0] {
+	case mysqlComQuit:
+		s.quit = true
+	case mysqlComChangeUser:
+		s.user = cstring(payload[1:])
+	case mysqlComQuery:
+		b := payload[1:]
+		if s.caps&mysqlClientQueryAttributes != 0 {
+			// parameter_count, parameter_set_count, the parameters are not parsed
+			params, n := lenencInt(b)
+			if n == 0 || params > 0 {
+				return "", false
+			}
+			_, m := lenencInt(b[n:])
+			if m == 0 {
+				return "", false
+			}
+			b = b[n+m:]
+		}
+		return string(b), true
+	}
+	return "", false
+}
+
+// server follows the packet from the target.
+func (s *mysqlSession) server(seq byte, _ []byte) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.next = seq + 1
+}
+
+// signal replies the client the error of the target gone, as the next packet of the protocol,
+// unless the connection is opaque or quitting, or the target is gone in the middle of a packet.
+func (s *mysqlSession) signal(w io.Writer, boundary bool, message string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.opaque || s.quit || !boundary {
+		return
+	}
+	_, _ = w.Write(mysqlError(s.next, s.caps, mysqlErServerShutdown, message))
+}
+
+// mysqlError is the ERR packet, with the SQL state by the capabilities of the client, none before its handshake.
+func mysqlError(seq byte, caps uint32, code uint16, message string) []byte {
+	payload := []byte{0xff, byte(code), byte(code >> 8)}
+	if caps&mysqlClientProtocol41 != 0 {
+		payload = append(payload, '#')
+		payload = append(payload, mysqlSQLStateShutdown...)
+	}
+	payload = append(payload, message...)
+
+	n := len(payload)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+}
+
+// mysqlPackets splits the stream written into the MySQL packets, and calls the callback by the packets with
+// up to the first 64KiB of their payloads, the continuations of the packets of 16MiB are not called.
+type mysqlPackets struct {
+	header    [4]byte
+	headerN   int
+	remaining int
+	payload   []byte
+	// continued is the packet continuing the previous one of the max length
+	continued bool
+	onPacket  func(seq byte, payload []byte)
+}
+
+const mysqlMaxInspected = 64 << 10
+
+// boundary tells whether the stream written ends at the end of a packet.
+func (p *mysqlPackets) boundary() bool { return p.headerN == 0 && p.remaining == 0 }
+
+func (p *mysqlPackets) Write(b []byte) (int, error) {
+	written := len(b)
+	for len(b) > 0 {
+		if p.headerN < 4 {
+			n := copy(p.header[p.headerN:], b)
+			p.headerN += n
+			b = b[n:]
+			if p.headerN < 4 {
+				break
+			}
+			p.remaining = int(p.header[0]) | int(p.header[1])<<8 | int(p.header[2])<<16
+			p.payload = p.payload[:0]
+		}
+
+		n := min(p.remaining, len(b))
+		if keep := min(n, mysqlMaxInspected-len(p.payload)); keep > 0 {
+			p.payload = append(p.payload, b[:keep]...)
+		}
+		p.remaining -= n
+		b = b[n:]
+		if p.remaining > 0 {
+			break
+		}
+
+		if !p.continued {
+			p.onPacket(p.header[3], p.payload)
+		}
+		p.continued = p.header[0] == 0xff && p.header[1] == 0xff && p.header[2] == 0xff
+		p.headerN = 0
+	}
+	return written, nil
+}
+
+// cstring is the NUL terminated string at the beginning of b.
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+// lenencInt is the length-encoded integer at the beginning of b, with its bytes, 0 if malformed.
+func lenencInt(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] {
+	case 0xfc:
+		if len(b) >= 3 {
+			return uint64(binary.LittleEndian.Uint16(b[1:])), 3
+		}
+	case 0xfd:
+		if len(b) >= 4 {
+			return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+		}
+	case 0xfe:
+		if len(b) >= 9 {
+			return binary.LittleEndian.Uint64(b[1:]), 9
+		}
+	case 0xfb, 0xff:
+	default:
+		return uint64(b[0]), 1
+	}
+	return 0, 0
+}
+
+// mysqlGoneMessage is the message of the error replied to the client when the target is gone.
+func mysqlGoneMessage(target string, err error) string {
+	if err == nil {
+		return fmt.Sprintf("target %s closed the connection, reconnect for failover", target)
+	}
+	return fmt.Sprintf("target %s: %v, reconnect for failover", target, err)
+}
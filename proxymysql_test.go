@@ -0,0 +1,99 @@
+package dualconn
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// mysqlPacket is the MySQL packet of the sequence id and the payload.
+func mysqlPacket(seq byte, payload []byte) []byte {
+	n := len(payload)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+}
+
+// packetRecorder records the packets of a mysqlPackets.
+type packetRecorder struct {
+	packets []string
+}
+
+func (r *packetRecorder) onPacket(seq byte, payload []byte) {
+	r.packets = append(r.packets, fmt.Sprintf("%d:%d:%.8q", seq, len(payload), payload))
+}
+
+func TestMySQLPacketsSplitWrites(t *testing.T) {
+	var stream []byte
+	stream = append(stream, mysqlPacket(0, []byte("\x03SELECT 1"))...)
+	stream = append(stream, mysqlPacket(1, nil)...)
+	stream = append(stream, mysqlPacket(0, []byte("\x01"))...)
+	want := []string{`0:9:"\x03SELECT "`, `1:0:""`, `0:1:"\x01"`}
+
+	// every split of the stream in two writes, and the writes byte by byte
+	for i := 0; i <= len(stream); i++ {
+		var r packetRecorder
+		p := &mysqlPackets{onPacket: r.onPacket}
+		for _, b := range [][]byte{stream[:i], stream[i:]} {
+			if n, err := p.Write(b); n != len(b) || err != nil {
+				t.Fatalf("write %d bytes: %d %v", len(b), n, err)
+			}
+		}
+		if fmt.Sprint(r.packets) != fmt.Sprint(want) || !p.boundary() {
+			t.Fatalf("split at %d: packets %v, boundary %v, want %v", i, r.packets, p.boundary(), want)
+		}
+	}
+
+	var r packetRecorder
+	p := &mysqlPackets{onPacket: r.onPacket}
+	for i := range stream {
+		_, _ = p.Write(stream[i : i+1])
+		if end := i + 1; p.boundary() != (end == 13 || end == 17 || end == len(stream)) {
+			t.Fatalf("boundary %v after %d bytes", p.boundary(), end)
+		}
+	}
+	if fmt.Sprint(r.packets) != fmt.Sprint(want) {
+		t.Fatalf("byte by byte: packets %v, want %v", r.packets, want)
+	}
+}
+
+func TestMySQLPacketsContinuations(t *testing.T) {
+	const maxLen = 1<<24 - 1
+	big := bytes.Repeat([]byte("x"), maxLen)
+	big[0] = mysqlComQuery
+
+	cases := []struct {
+		name   string
+		stream [][]byte
+		want   []string
+	}{
+		{
+			name:   "continued by a shorter packet",
+			stream: [][]byte{mysqlPacket(0, big), mysqlPacket(1, []byte("tail")), mysqlPacket(0, []byte("\x01"))},
+			want:   []string{fmt.Sprintf(`0:%d:"\x03xxxxxxx"`, mysqlMaxInspected), `0:1:"\x01"`},
+		},
+		{
+			name:   "continued by an empty packet",
+			stream: [][]byte{mysqlPacket(0, big), mysqlPacket(1, nil), mysqlPacket(0, []byte("\x01"))},
+			want:   []string{fmt.Sprintf(`0:%d:"\x03xxxxxxx"`, mysqlMaxInspected), `0:1:"\x01"`},
+		},
+		{
+			name:   "continued twice",
+			stream: [][]byte{mysqlPacket(0, big), mysqlPacket(1, big), mysqlPacket(2, []byte("tail")), mysqlPacket(0, []byte("\x01"))},
+			want:   []string{fmt.Sprintf(`0:%d:"\x03xxxxxxx"`, mysqlMaxInspected), `0:1:"\x01"`},
+		},
+	}
+	for _, c := range cases {
+		var r packetRecorder
+		p := &mysqlPackets{onPacket: r.onPacket}
+		for _, packet := range c.stream {
+			// the payloads are relayed in chunks, the headers split too
+			for len(packet) > 0 {
+				n := min(len(packet), 3+64<<10)
+				_, _ = p.Write(packet[:n])
+				packet = packet[n:]
+			}
+		}
+		if fmt.Sprint(r.packets) != fmt.Sprint(c.want) || !p.boundary() {
+			t.Fatalf("%s: packets %v, boundary %v, want %v", c.name, r.packets, p.boundary(), c.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package dualconn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// the signature of the PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrProxyHeader is the error of the malformed PROXY protocol headers.
+var ErrProxyHeader = errors.New("bad PROXY protocol header")
+
+// readProxyHeader reads the PROXY protocol v1 or v2 header, the addresses are nil for the UNKNOWN and LOCAL ones.
+func readProxyHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	peek, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProxyHeader, err)
+	}
+	if bytes.Equal(peek, proxyV2Signature) {
+		return readProxyHeaderV2(r)
+	}
+	if !bytes.HasPrefix(peek, []byte("PROXY ")) {
+		return nil, nil, fmt.Errorf("%w: missing", ErrProxyHeader)
+	}
+
+	// v1 is up to 107 bytes, like PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrProxyHeader, err)
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("%w: no CRLF in %q", ErrProxyHeader, line)
+	}
+	fields := strings.Fields(string(line))
+	switch {
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+		return nil, nil, nil
+	case len(fields) != 6 || fields[1] != "TCP4" && fields[1] != "TCP6":
+		return nil, nil, fmt.Errorf("%w: %q", ErrProxyHeader, line)
+	}
+
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if err1 != nil || err2 != nil || srcIP == nil || dstIP == nil ||
+		fields[1] == "TCP4" && (srcIP.To4() == nil || dstIP.To4() == nil) {
+		return nil, nil, fmt.Errorf("%w: %q", ErrProxyHeader, line)
+	}
+	return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, &net.TCPAddr{IP: dstIP, Port: int(dstPort)}, nil
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (src, dst net.Addr, err error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProxyHeader, err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("%w: version %d", ErrProxyHeader, header[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProxyHeader, err)
+	}
+
+	// the LOCAL command, like the health checks of the load balancer, or the PROXY one
+	switch header[12] & 0x0f {
+	case 0:
+		return nil, nil, nil
+	case 1:
+	default:
+		return nil, nil, fmt.Errorf("%w: command %d", ErrProxyHeader, header[12]&0x0f)
+	}
+	switch family := header[13] >> 4; {
+	case family == 1 && len(body) >= 12: // AF_INET
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:]))},
+			&net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:]))}, nil
+	case family == 2 && len(body) >= 36: // AF_INET6
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:]))},
+			&net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:]))}, nil
+	default:
+		// AF_UNSPEC or AF_UNIX, the addresses are unknown
+		return nil, nil, nil
+	}
+}
+
+// proxyHeaderV1 is the PROXY protocol v1 header of the addresses.
+func proxyHeaderV1(src, dst net.Addr) string {
+	s, ok1 := src.(*net.TCPAddr)
+	d, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		return "PROXY UNKNOWN\r\n"
+	}
+
+	proto := "TCP4"
+	if s.IP.To4() == nil || d.IP.To4() == nil {
+		proto = "TCP6"
+	}
+	return fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, s.IP, d.IP, s.Port, d.Port)
+}
@@ -0,0 +1,124 @@
+package dualconn
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2 builds the PROXY protocol v2 header of the version and command byte, the family byte and the body.
+func proxyV2(verCmd, family byte, body []byte) string {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, verCmd, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(body)))
+	return string(append(header, body...))
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	inet := []byte{192, 168, 0, 1, 10, 0, 0, 1, 0xdc, 0x04, 0x01, 0xbb}
+	inet6 := make([]byte, 36)
+	inet6[15], inet6[31] = 1, 2
+	binary.BigEndian.PutUint16(inet6[32:], 56324)
+	binary.BigEndian.PutUint16(inet6[34:], 443)
+
+	cases := []struct {
+		name     string
+		header   string
+		src, dst string
+		err      bool
+	}{
+		{name: "v1 tcp4", header: "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n", src: "192.168.0.1:56324", dst: "10.0.0.1:443"},
+		{name: "v1 tcp6", header: "PROXY TCP6 ::1 ::2 56324 443\r\n", src: "[::1]:56324", dst: "[::2]:443"},
+		{name: "v1 unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "v1 unknown with addresses", header: "PROXY UNKNOWN ::1 ::2 56324 443\r\n"},
+		{name: "v1 truncated", header: "PROXY TCP4 192.168.0.1 10.0.0.1 56", err: true},
+		{name: "v1 without CRLF", header: "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443" + strings.Repeat(" ", 70), err: true},
+		{name: "v1 missing port", header: "PROXY TCP4 192.168.0.1 10.0.0.1 56324\r\n", err: true},
+		{name: "v1 bad protocol", header: "PROXY UDP4 192.168.0.1 10.0.0.1 56324 443\r\n", err: true},
+		{name: "v1 bad address", header: "PROXY TCP4 192.168.0.256 10.0.0.1 56324 443\r\n", err: true},
+		{name: "v1 tcp4 of ipv6", header: "PROXY TCP4 ::1 ::2 56324 443\r\n", err: true},
+		{name: "v1 port out of range", header: "PROXY TCP4 192.168.0.1 10.0.0.1 65536 443\r\n", err: true},
+		{name: "missing", header: "GET / HTTP/1.1\r\n\r\n", err: true},
+		{name: "empty", header: "", err: true},
+		{name: "v2 inet", header: proxyV2(0x21, 0x11, inet), src: "192.168.0.1:56324", dst: "10.0.0.1:443"},
+		{name: "v2 inet6", header: proxyV2(0x21, 0x21, inet6), src: "[::1]:56324", dst: "[::2]:443"},
+		{name: "v2 local", header: proxyV2(0x20, 0x00, nil)},
+		{name: "v2 unix", header: proxyV2(0x21, 0x31, make([]byte, 216))},
+		{name: "v2 tlvs after the addresses", header: proxyV2(0x21, 0x11, append(inet, 0x04, 0x00, 0x01, 0x00)), src: "192.168.0.1:56324", dst: "10.0.0.1:443"},
+		{name: "v2 short inet", header: proxyV2(0x21, 0x11, inet[:8])},
+		{name: "v2 bad version", header: proxyV2(0x11, 0x11, inet), err: true},
+		{name: "v2 bad command", header: proxyV2(0x22, 0x11, inet), err: true},
+		{name: "v2 truncated header", header: proxyV2(0x21, 0x11, inet)[:14], err: true},
+		{name: "v2 truncated body", header: proxyV2(0x21, 0x11, inet)[:20], err: true},
+	}
+	for _, c := range cases {
+		src, dst, err := readProxyHeader(bufio.NewReader(strings.NewReader(c.header)))
+		if c.err {
+			if !errors.Is(err, ErrProxyHeader) {
+				t.Errorf("%s: error %v, want ErrProxyHeader", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got, want := addrString(src), c.src; got != want {
+			t.Errorf("%s: src %s, want %s", c.name, got, want)
+		}
+		if got, want := addrString(dst), c.dst; got != want {
+			t.Errorf("%s: dst %s, want %s", c.name, got, want)
+		}
+	}
+}
+
+func TestReadProxyHeaderKeepsPayload(t *testing.T) {
+	for _, header := range []string{"PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n", proxyV2(0x20, 0x00, nil)} {
+		r := bufio.NewReader(strings.NewReader(header + "payload"))
+		if _, _, err := readProxyHeader(r); err != nil {
+			t.Fatal(err)
+		}
+		if rest, _ := r.ReadString(0); rest != "payload" {
+			t.Fatalf("payload %q after the header %q", rest, header)
+		}
+	}
+}
+
+func TestProxyHeaderV1(t *testing.T) {
+	cases := []struct {
+		src, dst net.Addr
+		want     string
+	}{
+		{
+			&net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443},
+			"PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n",
+		},
+		{
+			&net.TCPAddr{IP: net.ParseIP("::1"), Port: 56324}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443},
+			"PROXY TCP6 ::1 10.0.0.1 56324 443\r\n",
+		},
+		{&net.UnixAddr{Name: "/tmp/sock"}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}, "PROXY UNKNOWN\r\n"},
+	}
+	for _, c := range cases {
+		if got := proxyHeaderV1(c.src, c.dst); got != c.want {
+			t.Errorf("header %q, want %q", got, c.want)
+		}
+	}
+
+	// the header written is read back
+	src, dst, err := readProxyHeader(bufio.NewReader(strings.NewReader(cases[0].want)))
+	if err != nil || addrString(src) != "192.168.0.1:56324" || addrString(dst) != "10.0.0.1:443" {
+		t.Fatalf("read back %v %v %v", src, dst, err)
+	}
+}
+
+// addrString is the address, empty if nil.
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.String()
+}
@@ -0,0 +1,55 @@
+package dualconn
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy tunes the retries of a dial, which tries the targets in order once by default.
+type RetryPolicy struct {
+	// Retries are the rounds over the targets after the first one fails, or the attempts on every target
+	// after its first one when Sticky.
+	Retries int
+	// AttemptTimeout bounds a dial to a target, within the Timeout of the Manager.
+	AttemptTimeout time.Duration
+	// Backoff is the wait before the first retry, doubled by every retry up to MaxBackoff, 100ms and 3s by default.
+	Backoff, MaxBackoff time.Duration
+	// Jitter randomizes the waits by the fraction, like 0.2 for ±20%.
+	Jitter float64
+	// Sticky retries the same target before the next one, instead of rotating to the next targets.
+	Sticky bool
+}
+
+// WithRetryPolicy retries the failed dials by the policy.
+func (d *Manager) WithRetryPolicy(p RetryPolicy) *Manager {
+	if p.Backoff <= 0 {
+		p.Backoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 3 * time.Second
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.retry = p
+	return d
+}
+
+// wait waits the backoff of the policy before the nth (from 0) retry, or until the context is done.
+func (d *Manager) wait(ctx context.Context, p RetryPolicy, n int) error {
+	backoff := p.Backoff
+	for i := 0; i < n && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	d.Lock()
+	backoff = d.jitter(min(backoff, p.MaxBackoff), p.Jitter)
+	d.Unlock()
+
+	select {
+	case <-d.after(backoff):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package dualconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// closedTargets returns n targets refusing the connections.
+func closedTargets(t *testing.T, n int) []string {
+	t.Helper()
+
+	targets := make([]string, n)
+	for i := range targets {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets[i] = ln.Addr().String()
+		_ = ln.Close()
+	}
+	return targets
+}
+
+// dialRecorded dials by the policy with the backoffs advanced by the clock, returning the dialed targets and the error.
+func dialRecorded(t *testing.T, targets []string, p RetryPolicy, backoffs ...time.Duration) ([]string, error) {
+	t.Helper()
+
+	clock := newFakeClock()
+	var lock sync.Mutex
+	var dialed []string
+	m := NewManager(targets, time.Second).WithClock(clock).WithRetryPolicy(p).
+		WithDialObserver(func(target string, _ int, _ time.Duration, _ error) {
+			lock.Lock()
+			defer lock.Unlock()
+			dialed = append(dialed, target)
+		})
+	t.Cleanup(func() { _ = m.Close() })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.DialContext(context.Background(), "tcp", targets[0])
+		done <- err
+	}()
+	for _, backoff := range backoffs {
+		clock.awaitTimer(t, backoff)
+		clock.Advance(backoff)
+	}
+	err := <-done
+
+	lock.Lock()
+	defer lock.Unlock()
+	return dialed, err
+}
+
+func TestRetryRounds(t *testing.T) {
+	targets := closedTargets(t, 2)
+	a, b := targets[0], targets[1]
+
+	dialed, err := dialRecorded(t, targets, RetryPolicy{Retries: 2}, 100*time.Millisecond, 200*time.Millisecond)
+	if !errors.Is(err, ErrNotAvailable) {
+		t.Fatalf("dial: %v, want ErrNotAvailable", err)
+	}
+	if want := []string{a, b, a, b, a, b}; !slices.Equal(dialed, want) {
+		t.Fatalf("dialed %v, want the rounds over the targets %v", dialed, want)
+	}
+}
+
+func TestRetrySticky(t *testing.T) {
+	targets := closedTargets(t, 2)
+	a, b := targets[0], targets[1]
+
+	backoff := 10 * time.Millisecond
+	dialed, err := dialRecorded(t, targets, RetryPolicy{Retries: 2, Backoff: backoff, Sticky: true},
+		backoff, 2*backoff, backoff, 2*backoff)
+	if !errors.Is(err, ErrNotAvailable) {
+		t.Fatalf("dial: %v, want ErrNotAvailable", err)
+	}
+	if want := []string{a, a, a, b, b, b}; !slices.Equal(dialed, want) {
+		t.Fatalf("dialed %v, want the attempts on every target %v", dialed, want)
+	}
+}
+
+func TestRetryNone(t *testing.T) {
+	targets := closedTargets(t, 2)
+
+	dialed, err := dialRecorded(t, targets, RetryPolicy{})
+	if !errors.Is(err, ErrNotAvailable) {
+		t.Fatalf("dial: %v, want ErrNotAvailable", err)
+	}
+	if !slices.Equal(dialed, targets) {
+		t.Fatalf("dialed %v, want the targets once %v", dialed, targets)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	targets := closedTargets(t, 1)
+	clock := newFakeClock()
+	m := NewManager(targets, time.Second).WithClock(clock).WithRetryPolicy(RetryPolicy{Retries: 3})
+	t.Cleanup(func() { _ = m.Close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.DialContext(ctx, "tcp", targets[0])
+		done <- err
+	}()
+	// canceled within the backoff, the default 100ms
+	clock.awaitTimer(t, 100*time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, ErrNotAvailable) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("dial: %v, want ErrNotAvailable by the cancellation", err)
+	}
+}
+
+func TestRetryAttemptTimeout(t *testing.T) {
+	// the blackhole dialer waits for the context, bounded by the attempt timeout within the Manager timeout
+	m := NewManager([]string{"10.0.0.1:3306"}, 5*time.Second).
+		WithRetryPolicy(RetryPolicy{AttemptTimeout: 50 * time.Millisecond})
+	m.Lock()
+	m.Dialer = ContextDialerFunc(func(ctx context.Context, _, _ string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	m.Unlock()
+	t.Cleanup(func() { _ = m.Close() })
+
+	start := time.Now()
+	if _, err := m.DialContext(context.Background(), "tcp", "10.0.0.1:3306"); !errors.Is(err, ErrNotAvailable) {
+		t.Fatalf("dial: %v, want ErrNotAvailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("dial took %s, want it bounded by the attempt timeout", elapsed)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+)
+
+// The actions authorized by the Authorizer, the resource of the query actions (and the row updates and deletes)
+// is the database name, and the target address of the enable and the targets ones.
+const (
+	ActionQuery    = "query"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionWatch    = "watch"
+	ActionPool     = "pool"
+	ActionInfo     = "info"
+	ActionEnable   = "enable"
+	ActionTargets  = "targets"
+	ActionFailback = "failback"
+
+	ActionMaintenance = "maintenance"
+	ActionHandoff     = "handoff"
+	// ActionDSN swaps the DSN of the database of the resource.
+	ActionDSN = "dsn"
+
+	ActionSuggestions = "suggestions"
+	ActionStats       = "stats"
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Name  string            `json:"name"`
+	Roles []string          `json:"roles,omitempty"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// Authenticator extracts the principal from the request, like by the SSO session or token,
+// an error rejects the request with 401.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Authorizer tells whether the principal can take the action on the resource, an error rejects the request with 403.
+type Authorizer interface {
+	Authorize(ctx context.Context, p *Principal, action, resource string) error
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator.
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) { return f(r) }
+
+// AuthorizerFunc adapts a function to the Authorizer.
+type AuthorizerFunc func(ctx context.Context, p *Principal, action, resource string) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, p *Principal, action, resource string) error {
+	return f(ctx, p, action, resource)
+}
+
+// ErrForbidden is returned by the Authorizers denying the action.
+var ErrForbidden = errors.New("forbidden")
+
+// RoleAuthorizer is the role based Authorizer, the actions allowed by the roles, like {"dba": {"*"}, "dev": {"query", "info"}}.
+type RoleAuthorizer map[string][]string
+
+func (a RoleAuthorizer) Authorize(_ context.Context, p *Principal, action, _ string) error {
+	if p != nil {
+		for _, role := range p.Roles {
+			if actions := a[role]; slices.Contains(actions, action) || slices.Contains(actions, "*") {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrForbidden, action)
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the principal authenticated for the request, nil without an Authenticator.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// guard authenticates and authorizes the action on the resource of the request.
+func (h *handlers) guard(action string, resource func(r *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var p *Principal
+		if h.Authenticator != nil {
+			var err error
+			if p, err = h.Authenticator.Authenticate(r); err != nil {
+				http.Error(w, "unauthenticated: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+		}
+
+		if h.Authorizer != nil {
+			res := ""
+			if resource != nil {
+				res = resource(r)
+			}
+			if err := h.Authorizer.Authorize(r.Context(), p, action, res); err != nil {
+				log.Printf("%s %s on %q denied: %v", principalName(p), action, res, err)
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func principalName(p *Principal) string {
+	if p == nil {
+		return "anonymous"
+	}
+	return p.Name
+}
+
+func targetResource(r *http.Request) string {
+	return r.URL.Query().Get("target")
+}
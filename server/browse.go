@@ -0,0 +1,219 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// tableStmt is a statement generated on a table of the database.
+type tableStmt struct {
+	database string
+	d        *Database
+	options  db.Options
+	query    string
+	args     []any
+	format   string
+	limit    int
+}
+
+// rows browses the rows of a table by GET /tables/{table}/rows?limit=&offset=&order=a,-b&filter=col:op:value&columns=a,b,
+// the SQL is generated with the values as args, limited by the limit of the database.
+func (h *handlers) rows(w http.ResponseWriter, r *http.Request) {
+	database := h.databaseName(r)
+	d, err := h.Lookup(database)
+	if err != nil {
+		writeResult(w, http.StatusNotFound, err)
+		return
+	}
+
+	options := d.Options
+	query := r.URL.Query()
+	browse := &db.Browse{
+		Table:   r.PathValue("table"),
+		Columns: splitList(query.Get("columns")),
+		Order:   splitList(query.Get("order")),
+		Limit:   options.RowLimit(),
+	}
+	if limit, _ := strconv.Atoi(query.Get("limit")); limit > 0 {
+		browse.Limit = min(limit, browse.Limit)
+	}
+	browse.Offset, _ = strconv.Atoi(query.Get("offset"))
+	for _, s := range query["filter"] {
+		f, err := db.ParseFilter(s)
+		if err != nil {
+			writeResult(w, http.StatusBadRequest, err)
+			return
+		}
+		browse.Filters = append(browse.Filters, f)
+	}
+
+	sdb, _ := d.Handle()
+	q, args, err := browse.SQL(cmp.Or(options.Dialect, db.DetectDialect(sdb)))
+	if err != nil {
+		writeResult(w, http.StatusBadRequest, err)
+		return
+	}
+	h.runTable(w, r, &tableStmt{database: database, d: d, options: options, query: q, args: args,
+		format: cmp.Or(query.Get("format"), "json"), limit: browse.Limit})
+}
+
+// row serves a single row of a table by its primary key, GET, PUT (the columns to update in a JSON object) or DELETE
+// /tables/{table}/rows/{key}, where the values of a composite key are separated by commas.
+func (h *handlers) row(w http.ResponseWriter, r *http.Request) {
+	database := h.databaseName(r)
+	d, err := h.Lookup(database)
+	if err != nil {
+		writeResult(w, http.StatusNotFound, err)
+		return
+	}
+
+	options := d.Options
+	sdb, _ := d.Handle()
+	dialect := cmp.Or(options.Dialect, db.DetectDialect(sdb))
+	row := &db.Row{Table: r.PathValue("table"), KeyValues: strings.Split(r.PathValue("key"), ",")}
+	if row.Key, err = h.schemas.PrimaryKey(r.Context(), sdb, dialect, row.Table); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, db.ErrNoPrimaryKey) {
+			status = http.StatusNotFound
+		}
+		writeResult(w, status, err)
+		return
+	}
+
+	var q string
+	var args []any
+	switch r.Method {
+	case http.MethodPut:
+		var values map[string]any
+		if values, err = readRowValues(w, r, h.MaxBodySize); err == nil {
+			q, args, err = row.Update(dialect, values)
+		}
+	case http.MethodDelete:
+		q, args, err = row.Delete(dialect)
+	default:
+		q, args, err = row.Select(dialect)
+	}
+	if err != nil {
+		writeResult(w, http.StatusBadRequest, err)
+		return
+	}
+	h.runTable(w, r, &tableStmt{database: database, d: d, options: options, query: q, args: args, format: "json", limit: 1})
+}
+
+// readRowValues reads the columns of a row in a JSON object, the numbers are kept as their literals,
+// and the objects and arrays as their JSON.
+func readRowValues(w http.ResponseWriter, r *http.Request, maxBodySize int64) (map[string]any, error) {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("read row: %w", err)
+	}
+
+	for k, v := range values {
+		switch t := v.(type) {
+		case json.Number:
+			values[k] = t.String()
+		case map[string]any, []any:
+			data, _ := json.Marshal(t)
+			values[k] = string(data)
+		}
+	}
+	return values, nil
+}
+
+// runTable runs the statement generated on a table, accounted by the quotas, shed by the overloaded pool,
+// limited by the limiter and audited like the queries. The statements run by RunSQLArgs, so the rewriters,
+// the lint (failing them in strict mode) and the timeout of the options apply to them, while the confirmation of the
+// dangerous queries does not: the row writes update or delete a single row by its primary key.
+func (h *handlers) runTable(w http.ResponseWriter, r *http.Request, stmt *tableStmt) {
+	recordQuota, err := h.acquireQuota(r)
+	if err != nil {
+		writeResult(w, http.StatusTooManyRequests, err)
+		return
+	}
+	cw := &countingWriter{ResponseWriter: w}
+	w = cw
+	var rows int64
+	defer func() { recordQuota(rows, cw.n) }()
+
+	sdb, pool := stmt.d.Handle()
+	if pool.Overloaded(stmt.d.ShedWait) {
+		w.Header().Set("Retry-After", "1")
+		writeResult(w, http.StatusServiceUnavailable, errors.New("database pool overloaded"))
+		return
+	}
+
+	record := &AuditRecord{
+		Time:     time.Now(),
+		Remote:   r.RemoteAddr,
+		Client:   h.ClientIP(r),
+		Database: stmt.database,
+		Query:    stmt.query,
+		Priority: db.PriorityFrom(r.Context()),
+	}
+	if p := PrincipalFrom(r.Context()); p != nil {
+		record.Principal = p.Name
+	}
+	if h.Audit != nil {
+		defer func() { h.Audit(record) }()
+	}
+
+	scanner, err := db.NewScanner(stmt.format, 0, stmt.limit)
+	if err != nil {
+		writeResult(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(h.MaskColumns) > 0 {
+		scanner = db.NewTransformRowsScanner(scanner, db.MaskColumns("***", h.MaskColumns...))
+	}
+	scanner = db.NewTransformRowsScanner(scanner, func(_ []string, row []any) ([]any, bool) {
+		rows++
+		return row, true
+	})
+
+	ctx := h.queryContext(r, &stmt.options)
+	release, err := stmt.d.Limiter.Acquire(ctx)
+	if err != nil {
+		record.Error = err.Error()
+		w.Header().Set("Retry-After", "1")
+		writeResult(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	result := db.RunSQLArgs(ctx, sdb, stmt.query, stmt.args, scanner)
+	release()
+	record.Cost, record.Error = result.Cost, result.Error
+
+	if result.Data != nil {
+		w.Header().Set("Content-Type", result.ContentType)
+		_, _ = w.Write(result.Data)
+		return
+	}
+	if r.Method == http.MethodGet && r.PathValue("key") != "" && result.Error == "" && len(result.Rows) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("encode result of %s error: %v", stmt.query, err)
+	}
+}
+
+func writeResult(w http.ResponseWriter, status int, err error) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&db.QueryResult{Error: err.Error()})
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// saturate takes the only connection of the pool after a wait of the time, and returns it to release.
+func saturate(t *testing.T, sdb *sql.DB, wait time.Duration) *sql.Conn {
+	t.Helper()
+
+	sdb.SetMaxOpenConns(1)
+	held, err := sdb.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan *sql.Conn)
+	go func() {
+		conn, _ := sdb.Conn(context.Background())
+		waited <- conn
+	}()
+	time.Sleep(wait)
+	_ = held.Close()
+	return <-waited
+}
+
+func TestRowsShedOverloaded(t *testing.T) {
+	f := &fakeDB{rows: func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"id"}, [][]driver.Value{{int64(1)}}, nil
+	}}
+	d := newFakeDatabase(t, f)
+	d.ShedWait = 5 * time.Millisecond
+	h := New(Config{Databases: map[string]*Database{"a": d}})
+
+	sdb, _ := d.Handle()
+	conn := saturate(t, sdb, 20*time.Millisecond)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tables/t/rows", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" ||
+		!strings.Contains(w.Body.String(), "overloaded") {
+		t.Fatalf("rows of the overloaded pool status %d: %s, want 503", w.Code, w.Body)
+	}
+	if queries := f.Queries(); len(queries) != 0 {
+		t.Fatalf("queries %q, want none run on the overloaded pool", queries)
+	}
+
+	_ = conn.Close()
+	if status, body := serve(h, httptest.NewRequest(http.MethodGet, "/tables/t/rows", nil)); status != http.StatusOK {
+		t.Fatalf("rows status %d: %s", status, body)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// confirm verifies the token of a dangerous statement in the confirm parameter (or the X-Confirm-Token header),
+// or responds 428 with a new token and the rows of the affected tables, the statement should not run on an error.
+func (h *handlers) confirm(ctx context.Context, w http.ResponseWriter, r *http.Request, sdb *sql.DB, d *Database, database, q string) error {
+	// the dry runs write nothing
+	if h.Confirmer == nil || db.OptionsFrom(ctx).DryRun {
+		return nil
+	}
+	// a confirmed statement could carry the others unconfirmed
+	if db.MultiStatement(q) {
+		w.WriteHeader(http.StatusBadRequest)
+		result := &db.QueryResult{Error: "multiple statements can not be confirmed, run them one by one"}
+		_ = json.NewEncoder(w).Encode(result)
+		return errors.New(result.Error)
+	}
+	danger := db.Dangerous(q)
+	if danger == nil {
+		return nil
+	}
+
+	subject := database + "\x00" + principalName(PrincipalFrom(r.Context()))
+	token := cmp.Or(r.URL.Query().Get("confirm"), r.Header.Get("X-Confirm-Token"))
+	err := h.Confirmer.Verify(subject, q, token)
+	if err == nil {
+		return nil
+	}
+
+	result := &db.QueryResult{Error: danger.Reason + " needs a confirmation, resubmit it with the confirm token"}
+	if token != "" {
+		result.Error = err.Error()
+	}
+	confirmation := &db.Confirmation{Danger: *danger, Token: h.Confirmer.Token(subject, q)}
+	dialect := cmp.Or(d.Options.Dialect, db.DetectDialect(sdb))
+	if confirmation.EstimatedRows, err = db.EstimateAffected(ctx, sdb, dialect, danger.Tables); err != nil {
+		result.Warnings = append(result.Warnings, "estimate affected rows: "+err.Error())
+	}
+	result.Confirmation = confirmation
+
+	w.WriteHeader(http.StatusPreconditionRequired)
+	_ = json.NewEncoder(w).Encode(result)
+	return errors.New(result.Error)
+}
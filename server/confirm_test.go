@@ -0,0 +1,94 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+func TestQueryConfirm(t *testing.T) {
+	f := &fakeDB{rows: func(q string, _ []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if strings.HasPrefix(q, "SELECT COUNT(*)") {
+			return []string{"COUNT(*)"}, [][]driver.Value{{int64(42)}}, nil
+		}
+		return nil, [][]driver.Value{{int64(3)}}, nil
+	}}
+	h := New(Config{
+		Databases: map[string]*Database{"a": newFakeDatabase(t, f)},
+		Confirmer: &db.Confirmer{Secret: []byte("secret")},
+		Authenticator: AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+			return &Principal{Name: r.Header.Get("X-User")}, nil
+		}),
+	})
+	request := func(user, q string, params ...string) *http.Request {
+		r := queryRequest(q, params...)
+		r.Header.Set("X-User", user)
+		return r
+	}
+
+	status, body := serve(h, request("alice", "delete from t"))
+	if status != http.StatusPreconditionRequired {
+		t.Fatalf("delete without where status %d: %s, want 428", status, body)
+	}
+	var result db.QueryResult
+	if err := json.Unmarshal([]byte(body), &result); err != nil || result.Confirmation == nil {
+		t.Fatalf("confirmation %s: %v", body, err)
+	}
+	if c := result.Confirmation; c.Token == "" || c.EstimatedRows != 42 || len(c.Tables) != 1 || c.Tables[0] != "t" {
+		t.Fatalf("confirmation %+v, want a token and the 42 rows of t", c)
+	}
+	if queries := f.Queries(); len(queries) != 1 || !strings.HasPrefix(queries[0], "SELECT COUNT(*)") {
+		t.Fatalf("queries %q, want only the estimate before the confirmation", queries)
+	}
+	token := result.Confirmation.Token
+
+	// the token is bound to the principal and the statement
+	for _, r := range []*http.Request{
+		request("bob", "delete from t", "confirm", token),
+		request("alice", "delete from u", "confirm", token),
+		request("alice", "delete from t", "confirm", token+"0"),
+	} {
+		status, body := serve(h, r)
+		if status != http.StatusPreconditionRequired || !strings.Contains(body, db.ErrConfirmToken.Error()) {
+			t.Errorf("%s by %s status %d: %s, want the token rejected", r.URL.RawQuery, r.Header.Get("X-User"), status, body)
+		}
+	}
+	for _, q := range f.Queries() {
+		if strings.HasPrefix(q, "delete") {
+			t.Fatalf("queries %q, want no delete before the confirmation", f.Queries())
+		}
+	}
+
+	if status, body := serve(h, request("alice", "delete from t", "confirm", token)); status != http.StatusOK {
+		t.Fatalf("confirmed delete status %d: %s", status, body)
+	}
+	if queries := f.Queries(); queries[len(queries)-1] != "delete from t" {
+		t.Fatalf("queries %q, want the confirmed delete run", queries)
+	}
+
+	// the statements the parser fails on are confirmed, and the multiple statements rejected, regardless of WHERE
+	for _, q := range []string{"WITH x AS (SELECT 1) DELETE FROM t", "with x as (select 1) update t set a = 1 where id in (select * from x)"} {
+		if status, body := serve(h, request("alice", q)); status != http.StatusPreconditionRequired {
+			t.Errorf("%s status %d: %s, want 428", q, status, body)
+		}
+	}
+	for _, q := range []string{"UPDATE t SET a=1; SELECT 1", "delete from t where id = 1; drop table u"} {
+		if status, body := serve(h, request("alice", q)); status != http.StatusBadRequest {
+			t.Errorf("%s status %d: %s, want 400", q, status, body)
+		}
+	}
+	for _, q := range f.Queries() {
+		if !strings.HasPrefix(q, "SELECT COUNT(*)") && q != "delete from t" {
+			t.Fatalf("queries %q, want none of the unconfirmed ones run", f.Queries())
+		}
+	}
+
+	// the statements with WHERE need no confirmation
+	if status, body := serve(h, request("alice", "delete from t where id = 1")); status != http.StatusOK {
+		t.Fatalf("delete with where status %d: %s", status, body)
+	}
+}
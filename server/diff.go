@@ -0,0 +1,232 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// DiffResult is the diff of the rows of two SELECTs, the rows only in the right are added,
+// and the ones only in the left are removed.
+type DiffResult struct {
+	Changes   []db.RowChange `json:"changes"`
+	LeftRows  int            `json:"leftRows"`
+	RightRows int            `json:"rightRows"`
+	// Truncated tells either side was cut by the limit of its database, so the diff is partial.
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// diffSide is a side of the diff, a SELECT on a database.
+type diffSide struct {
+	database string
+	query    string
+}
+
+// diff runs two SELECTs (or the same one against two databases) and diffs their rows by the key columns,
+// like /diff?key=id&q=select ...&db=old&db2=new, q2 defaults to q, and db2 to db.
+func (h *handlers) diff(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeDiff(w, http.StatusBadRequest, &DiffResult{Error: err.Error()})
+		return
+	}
+	key := r.Form.Get("key")
+	left := diffSide{database: h.databaseName(r), query: r.Form.Get("q")}
+	right := diffSide{database: cmp.Or(r.Form.Get("db2"), left.database), query: cmp.Or(r.Form.Get("q2"), left.query)}
+	if key == "" {
+		writeDiff(w, http.StatusBadRequest, &DiffResult{Error: "key columns required"})
+		return
+	}
+	for _, side := range []diffSide{left, right} {
+		if !db.IsQuery(side.query) {
+			writeDiff(w, http.StatusBadRequest, &DiffResult{Error: fmt.Sprintf("not a SELECT: %q", side.query)})
+			return
+		}
+	}
+	// the left database is authorized by the guard
+	if h.Authorizer != nil && right.database != left.database {
+		if err := h.Authorizer.Authorize(r.Context(), PrincipalFrom(r.Context()), ActionQuery, right.database); err != nil {
+			writeDiff(w, http.StatusForbidden, &DiffResult{Error: err.Error()})
+			return
+		}
+	}
+
+	recordQuota, err := h.acquireQuota(r)
+	if err != nil {
+		writeDiff(w, http.StatusTooManyRequests, &DiffResult{Error: err.Error()})
+		return
+	}
+	result := &DiffResult{}
+	cw := &countingWriter{ResponseWriter: w}
+	w = cw
+	defer func() { recordQuota(int64(result.LeftRows+result.RightRows), cw.n) }()
+
+	var rows [2][]map[string]any
+	for i, side := range []diffSide{left, right} {
+		qr, status := h.runDiffSide(r, side)
+		if qr.Error != "" {
+			result.Error = fmt.Sprintf("%s: %s", cmp.Or(side.database, DefaultDatabase), qr.Error)
+			writeDiff(w, status, result)
+			return
+		}
+		rows[i] = qr.Rows
+		result.Truncated = result.Truncated || qr.Truncated
+	}
+	result.LeftRows, result.RightRows = len(rows[0]), len(rows[1])
+
+	if result.Changes, err = db.DiffRows(key, rows[0], rows[1]); err != nil {
+		result.Error = err.Error()
+		writeDiff(w, http.StatusBadRequest, result)
+		return
+	}
+	writeDiff(w, http.StatusOK, result)
+}
+
+// runDiffSide runs the SELECT of a side, audited like the queries.
+func (h *handlers) runDiffSide(r *http.Request, side diffSide) (*db.QueryResult, int) {
+	d, err := h.Lookup(side.database)
+	if err != nil {
+		return &db.QueryResult{Error: err.Error()}, http.StatusNotFound
+	}
+
+	record := &AuditRecord{
+		Time:     time.Now(),
+		Remote:   r.RemoteAddr,
+		Client:   h.ClientIP(r),
+		Database: side.database,
+		Query:    side.query,
+		Priority: db.PriorityFrom(r.Context()),
+	}
+	if p := PrincipalFrom(r.Context()); p != nil {
+		record.Principal = p.Name
+	}
+	if h.Audit != nil {
+		defer func() { h.Audit(record) }()
+	}
+
+	options := d.Options
+	ctx := h.queryContext(r, &options)
+	release, err := d.Limiter.Acquire(ctx)
+	if err != nil {
+		record.Error = err.Error()
+		return &db.QueryResult{Error: err.Error()}, http.StatusServiceUnavailable
+	}
+	defer release()
+
+	sdb, _ := d.Handle()
+	scanner := db.RowsScanner(db.NewJsonRowsScanner(0, options.RowLimit()))
+	if len(h.MaskColumns) > 0 {
+		scanner = db.NewTransformRowsScanner(scanner, db.MaskColumns("***", h.MaskColumns...))
+	}
+	result := db.RunSQLScanner(ctx, sdb, side.query, scanner)
+	record.Cost, record.Error = result.Cost, result.Error
+	return result, http.StatusBadGateway
+}
+
+func writeDiff(w http.ResponseWriter, status int, result *DiffResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("encode diff result error: %v", err)
+	}
+}
+
+// checksum compares a table between two databases by the checksums of its chunks,
+// like /checksum?table=orders&db=old&db2=new&key=id&chunk=1000, the key is the primary key by default.
+func (h *handlers) checksum(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	left := h.databaseName(r)
+	right := cmp.Or(query.Get("db2"), left)
+	if h.Authorizer != nil && right != left {
+		if err := h.Authorizer.Authorize(r.Context(), PrincipalFrom(r.Context()), ActionQuery, right); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	var dbs [2]*Database
+	for i, name := range []string{left, right} {
+		d, err := h.Lookup(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		dbs[i] = d
+	}
+
+	recordQuota, err := h.acquireQuota(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	cw := &countingWriter{ResponseWriter: w}
+	w = cw
+	var rows int64
+	defer func() { recordQuota(rows, cw.n) }()
+
+	// the chunks are run on both by the options of the left, audited once on each database
+	names := []string{left}
+	if right != left {
+		names = append(names, right)
+	}
+	records := make([]*AuditRecord, len(names))
+	fail := func(err error) {
+		for _, record := range records {
+			record.Error = err.Error()
+		}
+	}
+	for i, name := range names {
+		records[i] = &AuditRecord{
+			Time:     time.Now(),
+			Remote:   r.RemoteAddr,
+			Client:   h.ClientIP(r),
+			Database: name,
+			Query:    "CHECKSUM TABLE " + query.Get("table"),
+			Priority: db.PriorityFrom(r.Context()),
+		}
+		if p := PrincipalFrom(r.Context()); p != nil {
+			records[i].Principal = p.Name
+		}
+		if h.Audit != nil {
+			defer h.Audit(records[i])
+		}
+	}
+
+	options := dbs[0].Options
+	ctx := h.queryContext(r, &options)
+	for _, d := range dbs[:len(names)] {
+		release, err := d.Limiter.Acquire(ctx)
+		if err != nil {
+			fail(err)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+	}
+
+	leftDB, _ := dbs[0].Handle()
+	rightDB, _ := dbs[1].Handle()
+	size, _ := strconv.Atoi(query.Get("chunk"))
+	dialect := cmp.Or(dbs[0].Dialect, db.DetectDialect(leftDB))
+	start := time.Now()
+	report, err := db.ChecksumTables(ctx, leftDB, rightDB, dialect, query.Get("table"), splitList(query.Get("key")), size)
+	for _, record := range records {
+		record.Cost = time.Since(start).String()
+	}
+	if err != nil {
+		fail(err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rows = int64(report.LeftRows + report.RightRows)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("encode checksum report error: %v", err)
+	}
+}
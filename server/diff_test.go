@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// tableRows answers the statements on the tables by the rows of the id and name columns,
+// or of the id column only when selected alone.
+func tableRows(q string, _ []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	if strings.Contains(q, "select id from") {
+		return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}}, nil
+	}
+	return []string{"id", "name"}, [][]driver.Value{{int64(1), "x"}, {int64(2), "y"}}, nil
+}
+
+// guardedConfig authenticates the principal by the X-User header, allowing the queries on the database a only.
+func guardedConfig(databases map[string]*Database, audit func(*AuditRecord)) Config {
+	return Config{
+		Databases:    databases,
+		TenantHeader: "X-Tenant",
+		Audit:        audit,
+		Authenticator: AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+			return &Principal{Name: r.Header.Get("X-User")}, nil
+		}),
+		Authorizer: AuthorizerFunc(func(_ context.Context, _ *Principal, action, resource string) error {
+			if action != ActionQuery || resource != "a" {
+				return errors.New("denied")
+			}
+			return nil
+		}),
+	}
+}
+
+// auditLog collects the audit records.
+type auditLog struct {
+	lock    sync.Mutex
+	records []AuditRecord
+}
+
+func (l *auditLog) Audit(r *AuditRecord) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.records = append(l.records, *r)
+}
+
+func (l *auditLog) Records() []AuditRecord {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]AuditRecord(nil), l.records...)
+}
+
+func tenantRequest(target, tenant string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.Header.Set("X-User", "alice")
+	r.Header.Set("X-Tenant", tenant)
+	return r
+}
+
+func TestChecksumAuthorization(t *testing.T) {
+	pk := func(q string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if strings.Contains(q, "KEY_COLUMN_USAGE") {
+			if len(args) != 2 || args[0].Value != "tenant_acme" || args[1].Value != "t" {
+				return nil, nil, errors.New("primary key of an unexpected table")
+			}
+			return []string{"COLUMN_NAME"}, [][]driver.Value{{"id"}}, nil
+		}
+		return tableRows(q, args)
+	}
+	fa, fb := &fakeDB{rows: pk}, &fakeDB{rows: tableRows}
+	audit := &auditLog{}
+	h := New(guardedConfig(map[string]*Database{"a": newFakeDatabase(t, fa), "b": newFakeDatabase(t, fb)}, audit.Audit))
+
+	if status, body := serve(h, tenantRequest("/checksum?db=a&db2=b&table=t", "acme")); status != http.StatusForbidden {
+		t.Fatalf("checksum against the database denied status %d: %s, want 403", status, body)
+	}
+	if len(fa.Queries())+len(fb.Queries()) != 0 {
+		t.Fatalf("queries %q and %q, want none when denied", fa.Queries(), fb.Queries())
+	}
+
+	status, body := serve(h, tenantRequest("/checksum?db=a&table=t", "acme"))
+	if status != http.StatusOK {
+		t.Fatalf("checksum status %d: %s", status, body)
+	}
+	var report struct {
+		Key        []string `json:"key"`
+		LeftRows   int      `json:"leftRows"`
+		Mismatches []any    `json:"mismatches"`
+	}
+	if err := json.Unmarshal([]byte(body), &report); err != nil || len(report.Key) != 1 || report.Key[0] != "id" ||
+		report.LeftRows != 2 || len(report.Mismatches) != 0 {
+		t.Fatalf("checksum report %s: %v", body, err)
+	}
+	for _, q := range fa.Queries() {
+		if !strings.Contains(q, "KEY_COLUMN_USAGE") && !strings.Contains(q, "from tenant_acme.t") {
+			t.Errorf("query %q, want the table of the tenant", q)
+		}
+	}
+
+	n := len(fa.Queries())
+	if _, body := serve(h, tenantRequest("/checksum?db=a&table=tenant_other.t&key=id", "acme")); !strings.Contains(body, db.ErrCrossTenantAccess.Error()) {
+		t.Fatalf("checksum of another tenant: %s, want rejected", body)
+	}
+	if queries := fa.Queries(); len(queries) != n {
+		t.Fatalf("queries %q, want none on another tenant", queries[n:])
+	}
+
+	records := audit.Records()
+	if len(records) != 2 || records[0].Query != "CHECKSUM TABLE t" || records[0].Error != "" || records[1].Error == "" {
+		t.Fatalf("audit records %+v, want the checksum and the rejected one", records)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// fakeDB is a database/sql driver answering the statements by the rows function, recording them.
+type fakeDB struct {
+	// rows answers the queries, and the execs by the rows affected of the first column of the first row.
+	rows func(query string, args []driver.NamedValue) (columns []string, rows [][]driver.Value, err error)
+
+	lock    sync.Mutex
+	queries []string
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return f }
+func (f *fakeDB) Open(string) (driver.Conn, error)             { return fakeConn{f}, nil }
+
+// Queries returns the statements run so far.
+func (f *fakeDB) Queries() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]string(nil), f.queries...)
+}
+
+func (f *fakeDB) answer(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	f.lock.Lock()
+	f.queries = append(f.queries, query)
+	f.lock.Unlock()
+
+	if f.rows == nil {
+		return nil, nil, nil
+	}
+	return f.rows(query, args)
+}
+
+type fakeConn struct{ f *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("prepare unsupported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := c.f.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, rows, err := c.f.answer(query, args)
+	if err != nil {
+		return nil, err
+	}
+	var affected int64
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		affected, _ = rows[0][0].(int64)
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newFakeDatabase returns the MySQL database of the handlers backed by the fake.
+func newFakeDatabase(t *testing.T, f *fakeDB) *Database {
+	sdb := sql.OpenDB(f)
+	t.Cleanup(func() { _ = sdb.Close() })
+	pool := db.NewPoolMonitor(sdb, 0)
+	return &Database{
+		Options: db.Options{Dialect: db.DialectMySQL},
+		Handle:  func() (*sql.DB, *db.PoolMonitor) { return sdb, pool },
+	}
+}
+
+// serve serves the request by the handler, returning the status and the body.
+func serve(h http.Handler, r *http.Request) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, w.Body.String()
+}
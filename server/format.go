@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// format pretty-prints the query in q or the posted body, indented by the indent parameter (2 spaces by default),
+// on one line with indent=none, and with the literals anonymized by anonymize=1.
+func (h *handlers) format(w http.ResponseWriter, r *http.Request) {
+	q, err := h.readQuery(w, r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.As(err, new(*http.MaxBytesError)) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	o := db.FormatOptions{Indent: "  ", Anonymize: r.URL.Query().Get("anonymize") == "1"}
+	switch indent := r.URL.Query().Get("indent"); indent {
+	case "":
+	case "none":
+		o.Indent = ""
+	default:
+		o.Indent = indent
+	}
+
+	formatted, err := db.FormatSQL(q, o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(formatted + "\n"))
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// InfoEncoder encodes the info of the manager for /info, decoded from its JSON into the maps, the slices
+// and the scalars, like json.Unmarshal into an any.
+type InfoEncoder struct {
+	ContentType string
+	Encode      func(w io.Writer, info any) error
+}
+
+var (
+	infoEncodersLock sync.RWMutex
+	infoEncoders     = map[string]InfoEncoder{
+		"json":       {ContentType: "application/json", Encode: encodeInfoJSON},
+		"yaml":       {ContentType: "application/yaml", Encode: encodeInfoYAML},
+		"prometheus": {ContentType: "text/plain; version=0.0.4", Encode: encodeInfoPrometheus},
+	}
+)
+
+// UseInfoEncoder registers an encoder of /info by the format, chosen by the format parameter,
+// or the media type of its ContentType in the Accept header.
+func UseInfoEncoder(format string, e InfoEncoder) {
+	infoEncodersLock.Lock()
+	defer infoEncodersLock.Unlock()
+
+	infoEncoders[format] = e
+}
+
+// info encodes the manager by the format parameter or the Accept header, JSON by default,
+// with only the fields of the fields parameter if any, like fields=active,targets.addr,targets.inUse.
+func (h *handlers) info(w http.ResponseWriter, r *http.Request) {
+	format, e, ok := infoEncoder(r)
+	if !ok {
+		http.Error(w, "unknown format "+format, http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.Marshal(h.Manager)
+	if err != nil {
+		log.Printf("encode manager info error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var info any
+	if err := json.Unmarshal(data, &info); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		info = selectFields(info, strings.Split(fields, ","))
+	}
+
+	w.Header().Set("Content-Type", e.ContentType)
+	if err := e.Encode(w, info); err != nil {
+		log.Printf("encode manager info in %s error: %v", format, err)
+	}
+}
+
+// infoEncoder finds the encoder by the format parameter, or by the Accept header, JSON if none matches.
+func infoEncoder(r *http.Request) (string, InfoEncoder, bool) {
+	infoEncodersLock.RLock()
+	defer infoEncodersLock.RUnlock()
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		e, ok := infoEncoders[format]
+		return format, e, ok
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		media, _, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+		for format, e := range infoEncoders {
+			if m, _, _ := mime.ParseMediaType(e.ContentType); m == media {
+				return format, e, true
+			}
+		}
+		if media == "text/yaml" || media == "application/x-yaml" {
+			return "yaml", infoEncoders["yaml"], true
+		}
+	}
+	return "json", infoEncoders["json"], true
+}
+
+// selectFields keeps the fields of the dotted paths, the ones under the slices are selected in every element.
+func selectFields(v any, paths []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		children := map[string][]string{}
+		for _, p := range paths {
+			key, rest, nested := strings.Cut(p, ".")
+			if _, ok := v[key]; !ok {
+				continue
+			}
+			if !nested {
+				// the whole field
+				children[key] = nil
+			} else if sub, seen := children[key]; !seen || sub != nil {
+				children[key] = append(sub, rest)
+			}
+		}
+		selected := make(map[string]any, len(children))
+		for key, sub := range children {
+			if sub == nil {
+				selected[key] = v[key]
+			} else {
+				selected[key] = selectFields(v[key], sub)
+			}
+		}
+		return selected
+	case []any:
+		selected := make([]any, len(v))
+		for i, e := range v {
+			selected[i] = selectFields(e, paths)
+		}
+		return selected
+	default:
+		return v
+	}
+}
+
+func encodeInfoJSON(w io.Writer, info any) error {
+	return json.NewEncoder(w).Encode(info)
+}
+
+// encodeInfoYAML encodes the info in the block style of YAML, the strings quoted like JSON.
+func encodeInfoYAML(w io.Writer, info any) error {
+	var b strings.Builder
+	writeYAML(&b, info, 0)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeYAML(b *strings.Builder, v any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			b.WriteString(pad + "{}\n")
+			return
+		}
+		for _, key := range sortedKeys(v) {
+			b.WriteString(pad + yamlScalar(key) + ":")
+			writeYAMLValue(b, v[key], indent+1)
+		}
+	case []any:
+		if len(v) == 0 {
+			b.WriteString(pad + "[]\n")
+			return
+		}
+		for _, e := range v {
+			if m, ok := e.(map[string]any); ok && len(m) > 0 {
+				// the first key on the line of the dash
+				var item strings.Builder
+				writeYAML(&item, m, indent+1)
+				b.WriteString(pad + "- " + item.String()[len(pad)+2:])
+				continue
+			}
+			b.WriteString(pad + "-")
+			writeYAMLValue(b, e, indent+1)
+		}
+	default:
+		b.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLValue writes the value after a key or a dash, on the same line if a scalar or empty.
+func writeYAMLValue(b *strings.Builder, v any, indent int) {
+	switch c := v.(type) {
+	case map[string]any:
+		if len(c) > 0 {
+			b.WriteString("\n")
+			writeYAML(b, c, indent)
+			return
+		}
+		b.WriteString(" {}\n")
+	case []any:
+		if len(c) > 0 {
+			b.WriteString("\n")
+			writeYAML(b, c, indent)
+			return
+		}
+		b.WriteString(" []\n")
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+var yamlPlain = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		switch strings.ToLower(v) {
+		case "true", "false", "yes", "no", "on", "off", "null", "y", "n":
+		default:
+			if yamlPlain.MatchString(v) {
+				return v
+			}
+		}
+		return strconv.Quote(v)
+	default:
+		return strconv.Quote(fmt.Sprint(v))
+	}
+}
+
+// encodeInfoPrometheus encodes the numbers and the booleans (as 1 or 0) of the info as the gauges of the
+// Prometheus text format, named by their paths like dualconn_targets_in_use, the elements of the slices labeled
+// by their addr (or their index), without the connections of the targets.
+func encodeInfoPrometheus(w io.Writer, info any) error {
+	samples := map[string][]string{}
+	var names []string
+	writePrometheus(info, "dualconn", nil, func(name, sample string) {
+		if _, ok := samples[name]; !ok {
+			names = append(names, name)
+		}
+		samples[name] = append(samples[name], sample)
+	})
+
+	// the samples of a metric are together under its TYPE
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString("# TYPE " + name + " gauge\n")
+		for _, sample := range samples[name] {
+			b.WriteString(sample + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writePrometheus(v any, name string, labels []string, write func(name, sample string)) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			// the connections of the targets, by their IDs, are too many series
+			if key != "conns" {
+				writePrometheus(v[key], name+"_"+metricName(key), labels, write)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			label := "index=" + strconv.Quote(strconv.Itoa(i))
+			if m, ok := e.(map[string]any); ok {
+				if addr, ok := m["addr"].(string); ok {
+					label = "addr=" + strconv.Quote(addr)
+				}
+			}
+			writePrometheus(e, name, withLabel(labels, label), write)
+		}
+	case float64:
+		write(name, sample(name, labels, strconv.FormatFloat(v, 'f', -1, 64)))
+	case bool:
+		if v {
+			write(name, sample(name, labels, "1"))
+		} else {
+			write(name, sample(name, labels, "0"))
+		}
+	}
+}
+
+// withLabel appends the label to a copy of the labels, shared by the siblings.
+func withLabel(labels []string, label string) []string {
+	return append(labels[:len(labels):len(labels)], label)
+}
+
+func sample(name string, labels []string, value string) string {
+	if len(labels) > 0 {
+		name += "{" + strings.Join(labels, ",") + "}"
+	}
+	return name + " " + value
+}
+
+// metricName converts the JSON key like inUse into the snake case like in_use, with only the valid characters.
+func metricName(key string) string {
+	var b strings.Builder
+	for i, c := range key {
+		switch {
+		case unicode.IsUpper(c):
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(c))
+		case c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
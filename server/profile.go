@@ -0,0 +1,90 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// profile samples the rows of a table and profiles its columns, like /profile?table=orders&sample=1000&random=1.
+func (h *handlers) profile(w http.ResponseWriter, r *http.Request) {
+	d, err := h.Lookup(h.databaseName(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	recordQuota, err := h.acquireQuota(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	cw := &countingWriter{ResponseWriter: w}
+	w = cw
+	var rows int64
+	defer func() { recordQuota(rows, cw.n) }()
+
+	query := r.URL.Query()
+	sdb, _ := d.Handle()
+	size, _ := strconv.Atoi(query.Get("sample"))
+	if limit := d.RowLimit(); size <= 0 || size > limit {
+		size = limit
+	}
+	dialect := cmp.Or(d.Dialect, db.DetectDialect(sdb))
+	q, err := db.ProfileSQL(dialect, query.Get("table"), size, query.Get("random") == "1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	record := &AuditRecord{
+		Time:     time.Now(),
+		Remote:   r.RemoteAddr,
+		Client:   h.ClientIP(r),
+		Database: h.databaseName(r),
+		Query:    q,
+		Priority: db.PriorityFrom(r.Context()),
+	}
+	if p := PrincipalFrom(r.Context()); p != nil {
+		record.Principal = p.Name
+	}
+	if h.Audit != nil {
+		defer func() { h.Audit(record) }()
+	}
+
+	options := d.Options
+	ctx := h.queryContext(r, &options)
+	release, err := d.Limiter.Acquire(ctx)
+	if err != nil {
+		record.Error = err.Error()
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	start := time.Now()
+	profile, err := db.ProfileTable(ctx, sdb, dialect, query.Get("table"), size, query.Get("random") == "1")
+	release()
+	record.Cost = time.Since(start).String()
+	if err != nil {
+		record.Error = err.Error()
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rows = int64(profile.Rows)
+	if len(h.MaskColumns) > 0 {
+		for i, c := range profile.Columns {
+			if slices.Contains(h.MaskColumns, c.Name) {
+				profile.Columns[i] = db.ColumnProfile{Name: c.Name, NullRate: c.NullRate, Distinct: c.Distinct, Format: c.Format}
+			}
+		}
+	}
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		log.Printf("encode table profile error: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+func TestProfileAuthorization(t *testing.T) {
+	fa, fb := &fakeDB{rows: tableRows}, &fakeDB{rows: tableRows}
+	audit := &auditLog{}
+	h := New(guardedConfig(map[string]*Database{"a": newFakeDatabase(t, fa), "b": newFakeDatabase(t, fb)}, audit.Audit))
+
+	if status, body := serve(h, tenantRequest("/profile?db=b&table=t", "acme")); status != http.StatusForbidden {
+		t.Fatalf("profile of the database denied status %d: %s, want 403", status, body)
+	}
+	if queries := fb.Queries(); len(queries) != 0 {
+		t.Fatalf("queries %q on the database denied", queries)
+	}
+
+	status, body := serve(h, tenantRequest("/profile?db=a&table=t&sample=10", "acme"))
+	if status != http.StatusOK {
+		t.Fatalf("profile status %d: %s", status, body)
+	}
+	var profile struct {
+		Rows int `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(body), &profile); err != nil || profile.Rows != 2 {
+		t.Fatalf("profile %s: %v", body, err)
+	}
+	if queries := fa.Queries(); len(queries) != 1 || !strings.Contains(queries[0], "from tenant_acme.t") {
+		t.Fatalf("queries %q, want the sample of the table of the tenant", queries)
+	}
+
+	if _, body := serve(h, tenantRequest("/profile?db=a&table=tenant_other.t", "acme")); !strings.Contains(body, db.ErrCrossTenantAccess.Error()) {
+		t.Fatalf("profile of another tenant: %s, want rejected", body)
+	}
+	if queries := fa.Queries(); len(queries) != 1 {
+		t.Fatalf("queries %q, want none on another tenant", queries)
+	}
+
+	records := audit.Records()
+	if len(records) != 2 || records[0].Principal != "alice" || records[0].Error != "" || records[1].Error == "" {
+		t.Fatalf("audit records %+v, want the profile and the rejected one of alice", records)
+	}
+}
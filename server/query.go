@@ -0,0 +1,232 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+func (h *handlers) query(w http.ResponseWriter, r *http.Request) {
+	database := h.databaseName(r)
+	d, err := h.Lookup(database)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(&db.QueryResult{Error: err.Error()})
+		return
+	}
+
+	recordQuota, err := h.acquireQuota(r)
+	if err != nil {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_ = json.NewEncoder(w).Encode(&db.QueryResult{Error: err.Error()})
+		return
+	}
+	cw := &countingWriter{ResponseWriter: w}
+	w = cw
+	var rows int64
+	defer func() { recordQuota(rows, cw.n) }()
+
+	sdb, pool := d.Handle()
+	if pool.Overloaded(d.ShedWait) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(&db.QueryResult{Error: "database pool overloaded"})
+		return
+	}
+
+	options := d.Options
+	options.DryRun = r.URL.Query().Get("dryrun") == "1"
+	options.Undo = options.Undo || r.URL.Query().Get("undo") == "1"
+	ctx := h.queryContext(r, &options)
+	priority := db.Priority(cmp.Or(r.URL.Query().Get("priority"), r.Header.Get("X-Priority")))
+	ctx = db.WithPriority(ctx, priority)
+	priority = db.PriorityFrom(ctx)
+	if r.URL.Query().Get("primary") == "1" {
+		ctx = db.WithPrimary(ctx)
+	}
+	var trace *db.Trace
+	if r.URL.Query().Get("trace") == "1" {
+		ctx, trace = db.WithTrace(ctx, r.URL.Query().Get("analyze") == "1")
+	}
+
+	q, err := h.readQuery(w, r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.As(err, new(*http.MaxBytesError)) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(&db.QueryResult{Error: err.Error()})
+		return
+	}
+	record := &AuditRecord{
+		Time:     time.Now(),
+		Remote:   r.RemoteAddr,
+		Client:   h.ClientIP(r),
+		Database: database,
+		Query:    q,
+		Priority: priority,
+	}
+	record.Normalized, _ = db.FormatSQL(q, db.FormatOptions{Anonymize: true})
+	if p := PrincipalFrom(r.Context()); p != nil {
+		record.Principal = p.Name
+	}
+	if h.Audit != nil {
+		defer func() { h.Audit(record) }()
+	}
+
+	if err := h.confirm(ctx, w, r, sdb, d, database, q); err != nil {
+		record.Error = err.Error()
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	var scanner db.RowsScanner
+	if format == "ndjson" {
+		// streamed while scanning, multiplexed by HTTP/2 or h2c
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		rc := http.NewResponseController(w)
+		scanner = db.NewNdjsonRowsScanner(w, func() { _ = rc.Flush() }, offset, options.RowLimit())
+	} else {
+		scanner, err = db.NewScanner(format, offset, options.RowLimit())
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(&db.QueryResult{Error: err.Error()})
+		return
+	}
+	// paginating, checksum the pages to detect the changes in between
+	if snapshot := r.URL.Query().Get("snapshot"); offset > 0 || snapshot != "" || r.URL.Query().Get("checksum") == "1" {
+		scanner = db.NewChecksumRowsScanner(scanner, q, offset, snapshot)
+	}
+	if len(h.MaskColumns) > 0 {
+		scanner = db.NewTransformRowsScanner(scanner, db.MaskColumns("***", h.MaskColumns...))
+	}
+	if h.Quotas != nil {
+		scanner = db.NewTransformRowsScanner(scanner, func(_ []string, row []any) ([]any, bool) {
+			rows++
+			return row, true
+		})
+	}
+
+	queued := time.Now()
+	release, err := d.Limiter.Acquire(ctx)
+	if trace != nil {
+		trace.Queue = time.Since(queued)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(&db.QueryResult{Error: err.Error()})
+		return
+	}
+	var dba db.DB = sdb
+	if d.Replica != nil {
+		if replica := d.Replica(); replica != nil {
+			dba = db.NewSplitter(sdb, replica)
+		}
+	}
+	queryResult := db.RunSQLScanner(ctx, dba, q, scanner)
+	release()
+	if trace != nil && h.Manager != nil && trace.Conn != "" {
+		trace.Target = h.Manager.TargetOf(trace.Conn)
+	}
+	record.Cost, record.Error = queryResult.Cost, queryResult.Error
+	record.Undo, record.Position = queryResult.Undo, queryResult.Position
+	if queryResult.Truncated {
+		w.Header().Set("X-Result-Truncated", "true")
+	}
+	if queryResult.Snapshot != "" {
+		w.Header().Set("X-Result-Checksum", queryResult.Checksum)
+		w.Header().Set("X-Result-Snapshot", queryResult.Snapshot)
+	}
+	if queryResult.SnapshotChanged {
+		w.Header().Set("X-Snapshot-Changed", "true")
+	}
+
+	if queryResult.Streamed {
+		if trace != nil {
+			trace.Bytes, queryResult.Trace = cw.n, trace
+		}
+		// the trailing line carries the status of the stream, like errors, the snapshot token or the trace
+		if queryResult.Error != "" || queryResult.Truncated || len(queryResult.Warnings) > 0 || queryResult.Snapshot != "" || trace != nil {
+			_ = json.NewEncoder(w).Encode(queryResult)
+		}
+		return
+	}
+	if queryResult.Data != nil {
+		if trace != nil {
+			// the rendered formats have no room for it
+			trace.Bytes = int64(len(queryResult.Data))
+			data, _ := json.Marshal(trace)
+			w.Header().Set("X-Query-Trace", string(data))
+		}
+		w.Header().Set("Content-Type", queryResult.ContentType)
+		_, _ = w.Write(queryResult.Data)
+		return
+	}
+	if trace != nil {
+		traceEncoding(queryResult, trace)
+	}
+	if err := json.NewEncoder(w).Encode(queryResult); err != nil {
+		log.Printf("encode queryResult error: %v", err)
+	}
+}
+
+// traceEncoding traces the encoding of the result without the trace, and attaches the trace to it.
+func traceEncoding(result *db.QueryResult, trace *db.Trace) {
+	start := time.Now()
+	data, _ := json.Marshal(result)
+	trace.Bytes, trace.Encode = int64(len(data)+1), time.Since(start)
+	result.Trace = trace
+}
+
+// queryContext carries the options, with the max examined rows of the principal, and the tenant in tenant mode.
+func (h *handlers) queryContext(r *http.Request, options *db.Options) context.Context {
+	if h.Quotas != nil {
+		if quota := h.Quotas.Quota(principalName(PrincipalFrom(r.Context()))); quota.MaxExaminedRows > 0 {
+			options.MaxExaminedRows = quota.MaxExaminedRows
+		}
+	}
+	ctx := db.WithOptions(r.Context(), options)
+	if h.TenantHeader != "" {
+		ctx = db.WithTenant(ctx, r.Header.Get(h.TenantHeader))
+	}
+	return ctx
+}
+
+// readQuery reads the query from the q parameter, or the body of a POST request, bounded by the max body size.
+func (h *handlers) readQuery(w http.ResponseWriter, r *http.Request) (string, error) {
+	if q := r.URL.Query().Get("q"); q != "" || r.Method != http.MethodPost {
+		return q, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.MaxBodySize))
+	if err != nil {
+		return "", fmt.Errorf("read query body: %w", err)
+	}
+	return string(body), nil
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/dualconn/db"
+)
+
+func TestMain(m *testing.M) {
+	// the tenant mode applies to the requests carrying a tenant only, the others run as is
+	tenant := db.TenantSchema("tenant_%s")
+	db.UseRewriter(func(stmt db.Stmt) (db.Stmt, error) {
+		if db.TenantFrom(stmt.Ctx) == "" {
+			return stmt, nil
+		}
+		return tenant(stmt)
+	})
+	os.Exit(m.Run())
+}
+
+func queryRequest(q string, params ...string) *http.Request {
+	values := url.Values{"q": {q}}
+	for i := 0; i+1 < len(params); i += 2 {
+		values.Set(params[i], params[i+1])
+	}
+	return httptest.NewRequest(http.MethodGet, "/query?"+values.Encode(), nil)
+}
+
+func TestQueryTenant(t *testing.T) {
+	f := &fakeDB{rows: func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"id"}, [][]driver.Value{{int64(1)}}, nil
+	}}
+	h := New(Config{Databases: map[string]*Database{"a": newFakeDatabase(t, f)}, TenantHeader: "X-Tenant"})
+
+	r := queryRequest("select id from t where id = 1")
+	r.Header.Set("X-Tenant", "acme")
+	if status, body := serve(h, r); status != http.StatusOK || strings.Contains(body, `"error"`) {
+		t.Fatalf("query status %d: %s", status, body)
+	}
+	if queries := f.Queries(); len(queries) != 1 || queries[0] != "select id from tenant_acme.t where id = 1" {
+		t.Fatalf("queries %q, want the one qualified by the tenant schema", queries)
+	}
+
+	for _, q := range []string{"select id from tenant_other.t", "select * from t join tenant_other.u on t.id = u.id"} {
+		r = queryRequest(q)
+		r.Header.Set("X-Tenant", "acme")
+		_, body := serve(h, r)
+		if !strings.Contains(body, db.ErrCrossTenantAccess.Error()) {
+			t.Errorf("query %s: %s, want the cross tenant access rejected", q, body)
+		}
+	}
+	if queries := f.Queries(); len(queries) != 1 {
+		t.Fatalf("queries %q, want the rejected ones not run", queries)
+	}
+}
+
+func TestQueryDryRun(t *testing.T) {
+	f := &fakeDB{rows: func(string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"rowsAffected"}, [][]driver.Value{{int64(7)}}, nil
+	}}
+	h := New(Config{Databases: map[string]*Database{"a": newFakeDatabase(t, f)}})
+
+	status, body := serve(h, queryRequest("update t set a = 1 where b = 2 and c < 3", "dryrun", "1"))
+	if status != http.StatusOK {
+		t.Fatalf("dry run status %d: %s", status, body)
+	}
+	var result struct {
+		Rows []map[string]any `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil || len(result.Rows) != 1 || result.Rows[0]["rowsAffected"] != 7.0 {
+		t.Fatalf("dry run result %s: %v", body, err)
+	}
+	want := "select count(*) as rowsAffected from t where b = 2 and c < 3"
+	if queries := f.Queries(); len(queries) != 1 || queries[0] != want {
+		t.Fatalf("queries %q, want only %q", queries, want)
+	}
+
+	_, body = serve(h, queryRequest("insert into t values (1)", "dryrun", "1"))
+	if !strings.Contains(body, db.ErrDryRun.Error()) {
+		t.Fatalf("dry run of insert: %s, want rejected", body)
+	}
+	if queries := f.Queries(); len(queries) != 1 {
+		t.Fatalf("queries %q, want nothing written", queries)
+	}
+}
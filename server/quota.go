@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Quota is the default database and the limits of a principal, the zero limits are unlimited.
+type Quota struct {
+	// Database is queried without a db parameter.
+	Database      string `json:"database,omitempty"`
+	RowsPerDay    int64  `json:"rowsPerDay,omitempty"`
+	BytesPerDay   int64  `json:"bytesPerDay,omitempty"`
+	MaxConcurrent int    `json:"maxConcurrent,omitempty"`
+	// MaxExaminedRows overrides the db.Options.MaxExaminedRows of the databases for the principal.
+	MaxExaminedRows int64 `json:"maxExaminedRows,omitempty"`
+}
+
+// QuotaUsage is the usage of a principal in the day (UTC).
+type QuotaUsage struct {
+	Day   string `json:"day"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// ErrQuotaExceeded rejects the queries of the principals exceeding their quotas, with 429.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quotas enforces the quotas of the principals on /query and /watch, the usage is persisted to the file across restarts.
+type Quotas struct {
+	principals map[string]Quota
+	fallback   Quota
+	file       string
+
+	lock    sync.Mutex
+	usage   map[string]*QuotaUsage
+	running map[string]int
+
+	saveLock sync.Mutex
+}
+
+// NewQuotas creates the quotas by principal name, with the fallback for the others (and the anonymous),
+// loading the usage from the file if given.
+func NewQuotas(principals map[string]Quota, fallback Quota, file string) (*Quotas, error) {
+	q := &Quotas{principals: principals, fallback: fallback, file: file,
+		usage: map[string]*QuotaUsage{}, running: map[string]int{}}
+	if file == "" {
+		return q, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.usage); err != nil {
+		return nil, fmt.Errorf("parse quota usage %s: %w", file, err)
+	}
+	return q, nil
+}
+
+// Quota returns the quota of the principal.
+func (q *Quotas) Quota(name string) Quota {
+	if quota, ok := q.principals[name]; ok {
+		return quota
+	}
+	return q.fallback
+}
+
+func today() string { return time.Now().UTC().Format(time.DateOnly) }
+
+// Usage returns the usage of the principal today.
+func (q *Quotas) Usage(name string) QuotaUsage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if u := q.usage[name]; u != nil && u.Day == today() {
+		return *u
+	}
+	return QuotaUsage{Day: today()}
+}
+
+// acquire reserves a concurrent query of the principal, unless its quota exceeded.
+func (q *Quotas) acquire(name string) (release func(), err error) {
+	quota := q.Quota(name)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if u := q.usage[name]; u != nil && u.Day == today() {
+		if quota.RowsPerDay > 0 && u.Rows >= quota.RowsPerDay {
+			return nil, fmt.Errorf("%w: %d rows per day", ErrQuotaExceeded, quota.RowsPerDay)
+		}
+		if quota.BytesPerDay > 0 && u.Bytes >= quota.BytesPerDay {
+			return nil, fmt.Errorf("%w: %d bytes per day", ErrQuotaExceeded, quota.BytesPerDay)
+		}
+	}
+	if quota.MaxConcurrent > 0 && q.running[name] >= quota.MaxConcurrent {
+		return nil, fmt.Errorf("%w: %d concurrent queries", ErrQuotaExceeded, quota.MaxConcurrent)
+	}
+
+	q.running[name]++
+	return func() {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		q.running[name]--
+	}, nil
+}
+
+// record adds the rows and bytes to the usage of the principal today, and persists the usage.
+func (q *Quotas) record(name string, rows, bytes int64) error {
+	q.lock.Lock()
+	u := q.usage[name]
+	if u == nil || u.Day != today() {
+		u = &QuotaUsage{Day: today()}
+		q.usage[name] = u
+	}
+	u.Rows += rows
+	u.Bytes += bytes
+	q.lock.Unlock()
+
+	if q.file == "" {
+		return nil
+	}
+
+	q.saveLock.Lock()
+	defer q.saveLock.Unlock()
+
+	q.lock.Lock()
+	data, err := json.Marshal(q.usage)
+	q.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := q.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.file)
+}
+
+// countingWriter counts the bytes of the response.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the underlying writer.
+func (c *countingWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
@@ -0,0 +1,272 @@
+// Package server serves the query and admin endpoints of dualconn as an http.Handler,
+// to be mounted under the router and middleware of an application.
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+	"github.com/bingoohuang/dualconn/db"
+)
+
+// DefaultDatabase is the name of the database queried without a db parameter, when there are several.
+const DefaultDatabase = "default"
+
+// Database is a database served by the handlers.
+type Database struct {
+	db.Options
+	// ShedWait sheds the queries with 503 when the pool is saturated and the recent wait for a connection exceeds it.
+	ShedWait time.Duration
+	// Limiter is the adaptive concurrency limiter, nil for no limit.
+	Limiter *db.AdaptiveLimiter
+	// Handle returns the current database and its pool monitor, which may be swapped at runtime.
+	Handle func() (*sql.DB, *db.PoolMonitor)
+	// Replica returns the database the reads of /query run on, the writes still on the one of Handle,
+	// like one dialing the replicas, not split if nil, see db.Splitter.
+	Replica func() *sql.DB
+}
+
+// AuditRecord is a record of the audit log of the queries.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	Client    string    `json:"client,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+	Database  string    `json:"db"`
+	Query     string    `json:"query"`
+	// Normalized is the query with the literals anonymized, empty if it fails to parse.
+	Normalized string      `json:"normalized,omitempty"`
+	Priority   db.Priority `json:"priority"`
+	Cost       string      `json:"cost,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	// Undo are the statements reverting the UPDATE/DELETE, see db.Options.Undo.
+	Undo []string `json:"undo,omitempty"`
+	// Position is the replication position after the write, see db.Options.Position.
+	Position string `json:"position,omitempty"`
+}
+
+// Config is the config of the handlers.
+type Config struct {
+	Manager   *dualconn.Manager
+	Databases map[string]*Database
+	// TenantHeader carries the tenant authenticated by the gateway, the tenant rewriter
+	// like db.TenantSchema should be registered by db.UseRewriter.
+	TenantHeader string
+	// MaskColumns are masked in the query results.
+	MaskColumns []string
+	// MaxBodySize is the max bytes of the query posted to /query, 1MB by default.
+	MaxBodySize int64
+	// Audit receives the records of the queries, if not nil.
+	Audit func(r *AuditRecord)
+	// ClientIP resolves the client IP of the request, like through the trusted proxies, the remote host by default.
+	ClientIP func(r *http.Request) string
+	// Authenticator authenticates the requests, all are anonymous if nil.
+	Authenticator Authenticator
+	// Authorizer authorizes the actions of the principals, all are allowed if nil.
+	Authorizer Authorizer
+	// Quotas enforces the default database and the limits of the principals, unlimited if nil.
+	Quotas *Quotas
+	// Confirmer confirms the dangerous statements on /query, like UPDATE/DELETE without WHERE and DDL,
+	// by a two-step flow: the first call returns a token, which the resubmission carries by the confirm parameter.
+	// They run without a confirmation if nil.
+	Confirmer *db.Confirmer
+	// Advisor suggests the indexes for the slow queries on /suggestions, if not nil.
+	Advisor *db.Advisor
+	// QueryStats summarizes the statements per fingerprint on /stats/queries, reset by DELETE, if not nil.
+	QueryStats *db.QueryStats
+	// Maintenance switches the maintenance mode on /maintenance, and Handoff hands off the listeners to the new
+	// binary on /handoff, both of the process serving the handler, if not nil.
+	Maintenance http.Handler
+	Handoff     http.Handler
+	// DSN swaps the DSN of the database of the db parameter on /dsn, if not nil.
+	DSN http.Handler
+}
+
+type handlers struct {
+	Config
+	schemas *db.SchemaCache
+}
+
+// New creates the handler of the endpoints: /query, /watch, /diff, /checksum, /profile, /format, /tables/{table}/rows, /pool, /info, /enable,
+// /targets, /failback, /targets/{addr}/timeline, /suggestions and /stats/queries, along with /maintenance, /handoff and /dsn if configured.
+func New(c Config) http.Handler {
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = 1 << 20
+	}
+	if c.ClientIP == nil {
+		c.ClientIP = remoteHost
+	}
+
+	h := &handlers{Config: c, schemas: db.NewSchemaCache(0)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", h.guard(ActionQuery, h.databaseName, h.query))
+	mux.HandleFunc("/watch", h.guard(ActionWatch, h.databaseName, h.watch))
+	mux.HandleFunc("/diff", h.guard(ActionQuery, h.databaseName, h.diff))
+	mux.HandleFunc("/checksum", h.guard(ActionQuery, h.databaseName, h.checksum))
+	mux.HandleFunc("/profile", h.guard(ActionQuery, h.databaseName, h.profile))
+	mux.HandleFunc("/format", h.guard(ActionQuery, nil, h.format))
+	mux.HandleFunc("GET /tables/{table}/rows", h.guard(ActionQuery, h.databaseName, h.rows))
+	mux.HandleFunc("GET /tables/{table}/rows/{key}", h.guard(ActionQuery, h.databaseName, h.row))
+	mux.HandleFunc("PUT /tables/{table}/rows/{key}", h.guard(ActionUpdate, h.databaseName, h.row))
+	mux.HandleFunc("DELETE /tables/{table}/rows/{key}", h.guard(ActionDelete, h.databaseName, h.row))
+	mux.HandleFunc("/pool", h.guard(ActionPool, nil, h.pool))
+	mux.HandleFunc("/info", h.guard(ActionInfo, nil, h.info))
+	mux.HandleFunc("/enable", h.guard(ActionEnable, targetResource, h.enable))
+	mux.HandleFunc("/targets", h.guard(ActionTargets, targetResource, h.targets))
+	mux.HandleFunc("/failback", h.guard(ActionFailback, nil, h.failback))
+	mux.HandleFunc("GET /targets/{addr}/timeline", h.guard(ActionInfo, nil, h.timeline))
+	mux.HandleFunc("/suggestions", h.guard(ActionSuggestions, h.databaseName, h.suggestions))
+	mux.HandleFunc("/stats/queries", h.guard(ActionStats, nil, h.queryStats))
+	if c.Maintenance != nil {
+		mux.HandleFunc("/maintenance", h.guard(ActionMaintenance, nil, c.Maintenance.ServeHTTP))
+	}
+	if c.Handoff != nil {
+		mux.HandleFunc("/handoff", h.guard(ActionHandoff, nil, c.Handoff.ServeHTTP))
+	}
+	if c.DSN != nil {
+		mux.HandleFunc("/dsn", h.guard(ActionDSN, h.databaseName, c.DSN.ServeHTTP))
+	}
+	return mux
+}
+
+// Lookup finds the database by name, an empty name means the default one,
+// which is the only database when there is just one.
+func (c *Config) Lookup(name string) (*Database, error) {
+	if name == "" {
+		name = DefaultDatabase
+		if len(c.Databases) == 1 {
+			for n := range c.Databases {
+				name = n
+			}
+		}
+	}
+
+	if d, ok := c.Databases[name]; ok {
+		return d, nil
+	}
+
+	names := make([]string, 0, len(c.Databases))
+	for n := range c.Databases {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown database %q, available: %v", name, names)
+}
+
+// databaseName is the db parameter, or the default database of the principal by the quotas.
+func (h *handlers) databaseName(r *http.Request) string {
+	if name := r.URL.Query().Get("db"); name != "" || h.Quotas == nil {
+		return name
+	}
+	return h.Quotas.Quota(principalName(PrincipalFrom(r.Context()))).Database
+}
+
+// acquireQuota reserves a concurrent query of the principal, the returned record adds the usage when done.
+func (h *handlers) acquireQuota(r *http.Request) (record func(rows, bytes int64), err error) {
+	if h.Quotas == nil {
+		return func(int64, int64) {}, nil
+	}
+
+	name := principalName(PrincipalFrom(r.Context()))
+	release, err := h.Quotas.acquire(name)
+	if err != nil {
+		return nil, err
+	}
+	return func(rows, bytes int64) {
+		release()
+		if err := h.Quotas.record(name, rows, bytes); err != nil {
+			log.Printf("record quota usage of %s error: %v", name, err)
+		}
+	}, nil
+}
+
+func (h *handlers) pool(w http.ResponseWriter, r *http.Request) {
+	type poolStats struct {
+		Pool    db.PoolStats    `json:"pool"`
+		Limiter db.LimiterStats `json:"limiter"`
+	}
+	stats := map[string]poolStats{}
+	for name, d := range h.Databases {
+		_, pool := d.Handle()
+		stats[name] = poolStats{Pool: pool.Stats(), Limiter: d.Limiter.Stats()}
+	}
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("encode pool stats error: %v", err)
+	}
+}
+
+// enable enables or disables the target, like /enable?target=addr&disable=1, with drain=30s to wait for
+// its connections to be drained on the disable, see dualconn.Manager.Drain.
+func (h *handlers) enable(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	disabled := r.URL.Query().Get("disable") == "1"
+	if drain, err := time.ParseDuration(r.URL.Query().Get("drain")); err == nil && disabled {
+		h.drain(w, r, target, drain)
+		return
+	}
+	if !h.Manager.Enable(target, disabled) {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// drain disables the target, and waits for its connections to be drained up to the timeout.
+func (h *handlers) drain(w http.ResponseWriter, r *http.Request, target string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	err := h.Manager.Drain(ctx, target)
+	switch {
+	case errors.Is(err, dualconn.ErrUnknownTarget):
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		log.Printf("drain target %s error: %v, closed the rest", target, err)
+	default:
+		log.Printf("target %s drained by %s", target, h.ClientIP(r))
+	}
+}
+
+func (h *handlers) suggestions(w http.ResponseWriter, r *http.Request) {
+	if h.Advisor == nil {
+		http.Error(w, "index advisor not enabled", http.StatusNotFound)
+		return
+	}
+	d, err := h.Lookup(h.databaseName(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	sdb, _ := d.Handle()
+	options := d.Options
+	if err := json.NewEncoder(w).Encode(h.Advisor.Suggest(db.WithOptions(r.Context(), &options), sdb)); err != nil {
+		log.Printf("encode index suggestions error: %v", err)
+	}
+}
+
+func (h *handlers) queryStats(w http.ResponseWriter, r *http.Request) {
+	if h.QueryStats == nil {
+		http.Error(w, "query stats not enabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if err := json.NewEncoder(w).Encode(h.QueryStats.Stats()); err != nil {
+			log.Printf("encode query stats error: %v", err)
+		}
+	case http.MethodDelete:
+		h.QueryStats.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "GET or DELETE the query stats", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/dualconn"
+)
+
+// TargetHealth is the health of a target, for the legacy monitoring.
+type TargetHealth struct {
+	Addr     string `json:"addr"`
+	Tier     string `json:"tier,omitempty"`
+	Up       bool   `json:"up"`
+	Active   bool   `json:"active"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Conns    int    `json:"conns"`
+	LastErr  string `json:"lastErr,omitempty"`
+}
+
+// Health is the health of the targets.
+type Health struct {
+	Time    time.Time      `json:"time"`
+	Active  string         `json:"active,omitempty"`
+	Up      int            `json:"up"`
+	Targets []TargetHealth `json:"targets"`
+}
+
+// HealthOf returns the health of the targets of the manager.
+func HealthOf(m *dualconn.Manager) *Health {
+	m.Lock()
+	defer m.Unlock()
+
+	h := &Health{Time: time.Now(), Active: m.Active}
+	for _, t := range m.Targets {
+		th := TargetHealth{Addr: t.Addr, Tier: t.Tier, Active: t.Addr == m.Active, Disabled: t.Disabled, LastErr: t.LastErr}
+		th.Up = !t.Disabled && !t.Unhealthy && t.LastErr == ""
+		for _, c := range t.Conns {
+			if !c.Closed {
+				th.Conns++
+			}
+		}
+		if th.Up {
+			h.Up++
+		}
+		h.Targets = append(h.Targets, th)
+	}
+	return h
+}
+
+// SplitTier splits the priority tier off the target, like primary=10.0.0.1:3306.
+func SplitTier(target string) (tier, addr string) {
+	if eq := strings.Index(target, "="); eq > 0 && !strings.ContainsAny(target[:eq], ".:/?+[") {
+		return target[:eq], target[eq+1:]
+	}
+	return "", target
+}
+
+// targets changes the targets at runtime, like during the rolling migrations of the databases:
+// POST target=addr adds one, DELETE target=addr (with drain=30s to drain it before) removes one,
+// PUT targets=addr1,addr2 replaces them all, and GET lists their health.
+func (h *handlers) targets(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(HealthOf(h.Manager).Targets)
+		return
+	case http.MethodPost:
+		if target == "" {
+			http.Error(w, "empty target", http.StatusBadRequest)
+			return
+		}
+		tier, addr := SplitTier(target)
+		if err = h.Manager.AddTarget(addr); err == nil && tier != "" {
+			h.Manager.WithTargetTier(addr, tier)
+		}
+	case http.MethodDelete:
+		if drain, e := time.ParseDuration(r.URL.Query().Get("drain")); e == nil {
+			ctx, cancel := context.WithTimeout(r.Context(), drain)
+			err = h.Manager.Drain(ctx, target)
+			cancel()
+			if errors.Is(err, dualconn.ErrUnknownTarget) {
+				break
+			} else if err != nil {
+				log.Printf("drain target %s error: %v, closed the rest", target, err)
+			}
+		}
+		err = h.Manager.RemoveTarget(target)
+	case http.MethodPut:
+		targets := strings.FieldsFunc(r.URL.Query().Get("targets"), func(r rune) bool { return r == ',' })
+		if len(targets) == 0 {
+			http.Error(w, "empty targets", http.StatusBadRequest)
+			return
+		}
+		err = h.Manager.SetTargets(targets)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case errors.Is(err, dualconn.ErrUnknownTarget):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, dualconn.ErrDuplicateTarget):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		log.Printf("%s targets error: %v", r.Method, err)
+	default:
+		log.Printf("%s targets %s%s by %s", r.Method, target, r.URL.Query().Get("targets"), h.ClientIP(r))
+	}
+}
+
+// failback moves the dials back to the first target by POST, like the operators do by the manual failback,
+// 503 if it is not reachable.
+func (h *handlers) failback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := h.Manager.Failback(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("failback by %s", h.ClientIP(r))
+}
+
+// timeline serves the health transitions and the latency samples of the target in JSON, for the availability
+// graphs, since the time of the since parameter, like 1h ago or 2024-05-01T00:00:00Z, all by default.
+func (h *handlers) timeline(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		if ago, err := time.ParseDuration(s); err == nil {
+			since = time.Now().Add(-ago)
+		} else if since, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "since is neither a duration nor RFC3339: "+s, http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	points := h.Manager.Timeline(r.PathValue("addr"), since)
+	if points == nil {
+		points = []dualconn.TimelinePoint{}
+	}
+	_ = json.NewEncoder(w).Encode(points)
+}
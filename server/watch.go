@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/dualconn/db"
+	"golang.org/x/net/websocket"
+)
+
+// watcher polls a SELECT and diffs its rows against the previous poll by the key column.
+type watcher struct {
+	d     *Database
+	q     string
+	key   string
+	limit int
+	prev  []map[string]any
+}
+
+// watchEvent is pushed to the clients, a change of a row, or an error of the poll.
+type watchEvent struct {
+	db.RowChange
+	Error string `json:"error,omitempty"`
+}
+
+func (w *watcher) poll(ctx context.Context) []watchEvent {
+	sdb, _ := w.d.Handle()
+	result := db.RunSQLScanner(ctx, sdb, w.q, db.NewJsonRowsScanner(0, w.limit))
+	if result.Error != "" {
+		return []watchEvent{{RowChange: db.RowChange{Type: "error"}, Error: result.Error}}
+	}
+
+	changes, err := db.DiffRows(w.key, w.prev, result.Rows)
+	if err != nil {
+		return []watchEvent{{RowChange: db.RowChange{Type: "error"}, Error: err.Error()}}
+	}
+	w.prev = result.Rows
+
+	events := make([]watchEvent, 0, len(changes)+1)
+	for _, c := range changes {
+		events = append(events, watchEvent{RowChange: c})
+	}
+	if result.Truncated {
+		events = append(events, watchEvent{RowChange: db.RowChange{Type: "error"},
+			Error: fmt.Sprintf("rows truncated at %d, the rows beyond are not watched", w.limit)})
+	}
+	return events
+}
+
+// watch registers a SELECT with a key column, like /watch?q=select * from t&key=id&interval=5s,
+// polls it on the interval, and pushes the added, changed and removed rows by SSE,
+// or by WebSocket when upgraded. The first poll pushes all the rows as added.
+func (h *handlers) watch(w http.ResponseWriter, r *http.Request) {
+	d, err := h.Lookup(h.databaseName(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	q, key := r.URL.Query().Get("q"), r.URL.Query().Get("key")
+	if q == "" || key == "" {
+		http.Error(w, "q and key required", http.StatusBadRequest)
+		return
+	}
+	if !db.IsQuery(q) {
+		http.Error(w, "only queries returning rows can be watched", http.StatusBadRequest)
+		return
+	}
+
+	interval := 5 * time.Second
+	if v := r.URL.Query().Get("interval"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "interval: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		interval = max(interval, time.Second)
+	}
+
+	options := d.Options
+	limit := options.RowLimit()
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	wa := &watcher{d: d, q: q, key: key, limit: limit}
+
+	// the quota counts the pushed events as the rows
+	recordQuota, err := h.acquireQuota(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	var rows int64
+	defer func() { recordQuota(rows, 0) }()
+
+	ctx := h.queryContext(r, &options)
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		// no origin check like websocket.Handler, the clients are to be filtered by the middleware
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			// the client closing is only noticed by reading
+			go func() {
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+				cancel()
+			}()
+
+			watchLoop(ctx, wa, interval, func(e watchEvent) error {
+				rows++
+				return websocket.JSON.Send(ws, e)
+			})
+		}}.ServeHTTP(w, r)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// the stream outlives the write timeout of the server
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	watchLoop(ctx, wa, interval, func(e watchEvent) error {
+		rows++
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+}
+
+func watchLoop(ctx context.Context, wa *watcher, interval time.Duration, send func(watchEvent) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, e := range wa.poll(ctx) {
+			if err := send(e); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
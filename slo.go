@@ -0,0 +1,221 @@
+package dualconn
+
+import (
+	"strings"
+	"time"
+)
+
+// SLOConfig tunes the availability budgets of the targets, computed from their health transitions, see Manager.WithSLO.
+type SLOConfig struct {
+	// Objective is the availability objective, 0.999 by default.
+	Objective float64
+	// Window is the rolling window of the budget, 30 days by default.
+	Window time.Duration
+	// BurnWindows are the short windows of the burn rates, 1h and 6h by default, for the multi-window alerts.
+	BurnWindows []time.Duration
+}
+
+// TargetSLO is the availability budget of a target, see Manager.SLO.
+type TargetSLO struct {
+	Addr string `json:"addr"`
+	// Availability is the ratio of the time up in the window, without the time disabled by the operators.
+	Availability float64 `json:"availability"`
+	// ErrorRate is the ratio of the time down, 1 - Availability.
+	ErrorRate float64       `json:"errorRate"`
+	Downtime  time.Duration `json:"downtime"`
+	// BudgetRemaining is the ratio of the error budget of the whole window left, negative once exhausted.
+	BudgetRemaining float64 `json:"budgetRemaining"`
+	// BurnRates are the error rates of the burn windows by the error budget, like 1h, 1 burns it up in the window.
+	BurnRates map[string]float64 `json:"burnRates"`
+}
+
+// sloSlots is the number of the slots of the rolling window of an accumulator.
+const sloSlots = 60
+
+// sloWindow accumulates the time down and up of a target over a rolling window in the slots of window/sloSlots,
+// bounded regardless of the transitions, so the long windows are not limited to the points kept by the timelines.
+type sloWindow struct {
+	width time.Duration
+	slots [sloSlots]sloSlot
+}
+
+// sloSlot is the time down and up in a slot, the epoch tells which one it is.
+type sloSlot struct {
+	epoch    int64
+	down, up time.Duration
+}
+
+// add accumulates the time between from and to in the state.
+func (w *sloWindow) add(state string, from, to time.Time) {
+	if state != StateDown && state != StateUp {
+		return
+	}
+	if window := w.width * sloSlots; to.Sub(from) > window {
+		from = to.Add(-window)
+	}
+	for from.Before(to) {
+		epoch := from.UnixNano() / int64(w.width)
+		end := time.Unix(0, (epoch+1)*int64(w.width))
+		if end.After(to) {
+			end = to
+		}
+		slot := &w.slots[epoch%sloSlots]
+		if slot.epoch != epoch {
+			*slot = sloSlot{epoch: epoch}
+		}
+		if state == StateDown {
+			slot.down += end.Sub(from)
+		} else {
+			slot.up += end.Sub(from)
+		}
+		from = end
+	}
+}
+
+// sum returns the time down and up in the window till now.
+func (w *sloWindow) sum(now time.Time) (down, up time.Duration) {
+	epoch := now.UnixNano() / int64(w.width)
+	for _, s := range w.slots {
+		if epoch-s.epoch < sloSlots {
+			down, up = down+s.down, up+s.up
+		}
+	}
+	return down, up
+}
+
+// sloTracker is the state of a target since the time accumulated into its windows,
+// the one of the whole budget first, then the burn windows.
+type sloTracker struct {
+	state   string
+	at      time.Time
+	windows []*sloWindow
+}
+
+// advance accumulates the time in the state till now.
+func (t *sloTracker) advance(now time.Time) {
+	if now.After(t.at) {
+		for _, w := range t.windows {
+			w.add(t.state, t.at, now)
+		}
+		t.at = now
+	}
+}
+
+// WithSLO tracks the availability budgets of the targets by their health transitions, see Manager.SLO.
+// The time up and down is accumulated per window apart from the points of the timelines, with WithTimeline
+// on by default if not yet, whose points reloaded from the timeline file are replayed into the windows.
+// The time before (without those points) is out of the window.
+func (d *Manager) WithSLO(c SLOConfig) *Manager {
+	if c.Objective <= 0 || c.Objective >= 1 {
+		c.Objective = 0.999
+	}
+	if c.Window <= 0 {
+		c.Window = 30 * 24 * time.Hour
+	}
+	if len(c.BurnWindows) == 0 {
+		c.BurnWindows = []time.Duration{time.Hour, 6 * time.Hour}
+	}
+
+	d.Lock()
+	timelines := d.timelines != nil
+	d.Unlock()
+	if !timelines {
+		d.WithTimeline(TimelineConfig{})
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.slo, d.sloTrackers = &c, map[string]*sloTracker{}
+	for addr, t := range d.timelines {
+		for _, p := range t.since(time.Time{}) {
+			if p.State != "" {
+				d.trackSLO(addr, p.State, p.Time)
+			}
+		}
+	}
+	now := d.clock.Now()
+	for _, t := range d.Targets {
+		if d.sloTrackers[t.Addr] == nil {
+			d.trackSLO(t.Addr, t.state(), now)
+		}
+	}
+	return d
+}
+
+// trackSLO accumulates the time of the target till the transition to the state, called under the lock.
+func (d *Manager) trackSLO(addr, state string, at time.Time) {
+	if d.slo == nil {
+		return
+	}
+	if t := d.sloTrackers[addr]; t != nil {
+		t.advance(at)
+		t.state = state
+		return
+	}
+
+	t := &sloTracker{state: state, at: at}
+	for _, window := range append([]time.Duration{d.slo.Window}, d.slo.BurnWindows...) {
+		t.windows = append(t.windows, &sloWindow{width: max(window/sloSlots, time.Second)})
+	}
+	d.sloTrackers[addr] = t
+}
+
+// SLO returns the availability budgets of the targets, nil if WithSLO is off.
+func (d *Manager) SLO() []TargetSLO {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.slos()
+}
+
+// slos is SLO called under the lock.
+func (d *Manager) slos() []TargetSLO {
+	if d.slo == nil {
+		return nil
+	}
+
+	now := d.clock.Now()
+	budget := 1 - d.slo.Objective
+	slos := make([]TargetSLO, len(d.Targets))
+	for i, t := range d.Targets {
+		tracker := d.sloTrackers[t.Addr]
+		if tracker == nil {
+			// added after WithSLO without transitions yet, in the state since now
+			d.trackSLO(t.Addr, t.state(), now)
+			tracker = d.sloTrackers[t.Addr]
+		}
+		tracker.advance(now)
+
+		s := TargetSLO{Addr: t.Addr, BurnRates: map[string]float64{}}
+		down, up := tracker.windows[0].sum(now)
+		s.Downtime, s.ErrorRate = down, ratio(down, down+up)
+		s.Availability = 1 - s.ErrorRate
+		s.BudgetRemaining = 1 - ratio(down, d.slo.Window)/budget
+		for j, w := range d.slo.BurnWindows {
+			down, up := tracker.windows[j+1].sum(now)
+			s.BurnRates[shortDuration(w)] = ratio(down, down+up) / budget
+		}
+		slos[i] = s
+	}
+	return slos
+}
+
+func ratio(part, total time.Duration) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// shortDuration formats the duration without the zero units at the end, like 1h for 1h0m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+package dualconn
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SmokeTest verifies a target before it is declared ready, like running SELECT 1 on it.
+// The dials through the Manager with the ctx are pinned to the target under test.
+type SmokeTest func(ctx context.Context, target string) error
+
+// SmokeResult is the result of the last smoke test of a target.
+type SmokeResult struct {
+	Time   *time.Time `json:"time"`
+	Cost   string     `json:"cost"`
+	Passed bool       `json:"passed"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// WithSmokeTest runs the smoke test whenever the dials switch to another target (failover or failback),
+// and at the first dial, the target failing it is skipped like a failed dial.
+func (d *Manager) WithSmokeTest(test SmokeTest) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.smokeTest = test
+	d.smokeLock = &sync.Mutex{}
+	return d
+}
+
+// smokeReady tells whether the target is ready, running the smoke test when the dials switch to it.
+func (d *Manager) smokeReady(ctx context.Context, target *Target) bool {
+	d.Lock()
+	test, ready := d.smokeTest, d.smokeTested(target)
+	d.Unlock()
+
+	if test == nil || ready {
+		return true
+	}
+
+	// one smoke test at a time, the concurrent dials wait for its result
+	d.smokeLock.Lock()
+	defer d.smokeLock.Unlock()
+
+	d.Lock()
+	ready = d.smokeTested(target)
+	d.Unlock()
+	if ready {
+		return true
+	}
+
+	testCtx, cancel := context.WithTimeout(WithTarget(ctx, target.Addr), d.Timeout)
+	defer cancel()
+
+	start := Now()
+	err := test(testCtx, target.Addr)
+	result := &SmokeResult{Time: start, Cost: time.Since(*start).String(), Passed: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	target.Smoke = result
+	if err != nil {
+		prev := target.state()
+		target.LastErr = "smoke test: " + err.Error()
+		d.emitState(target, prev, err)
+		return false
+	}
+	d.activate(target)
+	return true
+}
+
+// smokeTested tells whether the target passed the smoke test already: it is the active one,
+// or with a strategy balancing the dials, it passed the last test and has not failed since.
+func (d *Manager) smokeTested(target *Target) bool {
+	if d.Active == target.Addr {
+		return true
+	}
+	return d.strategy != nil && target.Smoke != nil && target.Smoke.Passed && target.LastErr == ""
+}
@@ -0,0 +1,142 @@
+package dualconn
+
+import "time"
+
+// Snapshot is the serializable state of a Manager, the targets, the options and the health states,
+// taken by Manager.Snapshot and restored by RestoreManager, like for the golden-state tests or the persisted states.
+// The options of the funcs and the interfaces, like the Dialer, the strategy, the smoke test, the prober and the TLS,
+// are not in it, set them again on the restored Manager.
+type Snapshot struct {
+	Timeout         time.Duration `json:"timeout"`
+	ProtagonistHalo bool          `json:"protagonistHalo,omitempty"`
+	Active          string        `json:"active,omitempty"`
+
+	Failback   FailbackPolicy `json:"failback"`
+	Breaker    *BreakerConfig `json:"breaker,omitempty"`
+	Retry      RetryPolicy    `json:"retry"`
+	MaxConns   int            `json:"maxConns,omitempty"`
+	ConnsQueue time.Duration  `json:"connsQueue,omitempty"`
+
+	// RecoveredAt is the time the protagonist has been reachable since, for the failback policy,
+	// FailingBack is the failback by Manager.Failback in progress.
+	RecoveredAt time.Time        `json:"recoveredAt"`
+	FailingBack bool             `json:"failingBack,omitempty"`
+	Targets     []TargetSnapshot `json:"targets"`
+}
+
+// TargetSnapshot is the state of a target in the Snapshot.
+type TargetSnapshot struct {
+	Addr     string     `json:"addr"`
+	Tier     string     `json:"tier,omitempty"`
+	Disabled bool       `json:"disabled,omitempty"`
+	LastErr  string     `json:"lastErr,omitempty"`
+	DialTime *time.Time `json:"dialTime,omitempty"`
+	// Discovered is the target discovered by DNS, see Manager.WithDiscovery.
+	Discovered bool          `json:"discovered,omitempty"`
+	Smoke      *SmokeResult  `json:"smoke,omitempty"`
+	Latency    time.Duration `json:"latency,omitempty"`
+	Unhealthy  bool          `json:"unhealthy,omitempty"`
+	ProbeErr   string        `json:"probeErr,omitempty"`
+	Breaker    *Breaker      `json:"breaker,omitempty"`
+}
+
+// Snapshot takes the state of the Manager, without the connections.
+func (d *Manager) Snapshot() Snapshot {
+	d.Lock()
+	defer d.Unlock()
+
+	s := Snapshot{
+		Timeout:         d.Timeout,
+		ProtagonistHalo: d.ProtagonistHalo,
+		Active:          d.Active,
+		Failback:        d.failback,
+		Retry:           d.retry,
+		MaxConns:        d.maxConns,
+		ConnsQueue:      d.connsQueue,
+		RecoveredAt:     d.recoveredAt,
+		FailingBack:     d.failingBack,
+		Targets:         make([]TargetSnapshot, len(d.Targets)),
+	}
+	if d.breaker != nil {
+		c := *d.breaker
+		s.Breaker = &c
+	}
+	for i, t := range d.Targets {
+		s.Targets[i] = TargetSnapshot{
+			Addr:       t.Addr,
+			Tier:       t.Tier,
+			Disabled:   t.Disabled,
+			LastErr:    t.LastErr,
+			DialTime:   clonePtr(t.DialTime),
+			Discovered: d.discovered[t.Addr],
+			Smoke:      clonePtr(t.Smoke),
+			Latency:    t.Latency,
+			Unhealthy:  t.Unhealthy,
+			ProbeErr:   t.ProbeErr,
+			Breaker:    clonePtr(t.Breaker),
+		}
+	}
+	return s
+}
+
+// RestoreManager creates the Manager of the snapshot, by the net.Dialer of its Timeout,
+// the discovered targets are replaced at the next resolutions if WithDiscovery is on again.
+func RestoreManager(s Snapshot) *Manager {
+	addrs := make([]string, len(s.Targets))
+	for i, t := range s.Targets {
+		addrs[i] = t.Addr
+	}
+	m := NewManager(addrs, s.Timeout)
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.ProtagonistHalo = s.ProtagonistHalo
+	m.Active = s.Active
+	m.failback = s.Failback
+	m.retry = s.Retry
+	m.maxConns = s.MaxConns
+	m.connsQueue = s.ConnsQueue
+	m.recoveredAt = s.RecoveredAt
+	m.failingBack = s.FailingBack
+	if s.Breaker != nil {
+		c := *s.Breaker
+		m.breaker = &c
+	}
+	for i, ts := range s.Targets {
+		t := m.Targets[i]
+		if ts.Tier != "" {
+			if m.tiers == nil {
+				m.tiers = map[string]string{}
+			}
+			m.tiers[ts.Addr], t.Tier = ts.Tier, ts.Tier
+		}
+		t.Disabled = ts.Disabled
+		t.LastErr = ts.LastErr
+		t.DialTime = clonePtr(ts.DialTime)
+		t.Smoke = clonePtr(ts.Smoke)
+		t.Latency = ts.Latency
+		t.Unhealthy = ts.Unhealthy
+		t.ProbeErr = ts.ProbeErr
+		t.Breaker = clonePtr(ts.Breaker)
+		if t.Breaker == nil && m.breaker != nil {
+			t.Breaker = &Breaker{State: BreakerClosed}
+		}
+		if ts.Discovered {
+			if m.discovered == nil {
+				m.discovered = map[string]bool{}
+			}
+			m.discovered[ts.Addr] = true
+		}
+	}
+	return m
+}
+
+// clonePtr copies the value of the pointer, nil if nil.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
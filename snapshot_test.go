@@ -0,0 +1,79 @@
+package dualconn
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	m := NewManager([]string{"10.0.0.1:3306", "10.0.0.2:3306", "10.0.1.1:3306"}, 3*time.Second).
+		WithProtagonistHalo().
+		WithBreaker(BreakerConfig{Failures: 3, Cooldown: 10 * time.Second, HalfOpenDials: 2}).
+		WithFailbackPolicy(FailbackPolicy{Delay: time.Minute}).
+		WithRetryPolicy(RetryPolicy{Retries: 2, Backoff: 50 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}).
+		WithMaxConnsPerTarget(8).
+		WithConnsQueue(time.Second).
+		WithTargetTier("10.0.0.1:3306", "primary").
+		WithTargetTier("10.0.0.2:3306", "primary").
+		WithTargetTier("10.0.1.1:3306", "dr")
+	t.Cleanup(func() { _ = m.Close() })
+
+	// a failover to the second target, the protagonist recovering and the breaker of the third one half-open
+	opened := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	dialed := opened.Add(time.Minute)
+	m.Lock()
+	m.Active = "10.0.0.2:3306"
+	m.recoveredAt = opened.Add(2 * time.Minute)
+	m.failingBack = true
+	m.Targets[0].LastErr = "connection refused"
+	m.Targets[0].Breaker = &Breaker{State: BreakerOpen, Failures: 3, OpenedAt: &opened}
+	m.Targets[1].DialTime = &dialed
+	m.Targets[1].Smoke = &SmokeResult{Time: &dialed, Cost: "2ms", Passed: true}
+	m.Targets[1].Latency = 2 * time.Millisecond
+	m.Targets[2].Disabled = true
+	m.Targets[2].Unhealthy = true
+	m.Targets[2].ProbeErr = "probe timeout"
+	m.Targets[2].Breaker = &Breaker{State: BreakerHalfOpen, Failures: 3, OpenedAt: &opened}
+	m.discovered = map[string]bool{"10.0.1.1:3306": true}
+	m.Unlock()
+
+	s := m.Snapshot()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Snapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	restored := RestoreManager(decoded)
+	t.Cleanup(func() { _ = restored.Close() })
+
+	if got := restored.Snapshot(); !reflect.DeepEqual(got, s) {
+		t.Fatalf("restored snapshot:\n%+v\nwant:\n%+v", got, s)
+	}
+	if got := restored.ActiveTier(); got != "primary" {
+		t.Fatalf("restored active tier %q, want primary", got)
+	}
+	restored.Lock()
+	defer restored.Unlock()
+	if got := restored.tiers["10.0.1.1:3306"]; got != "dr" {
+		t.Fatalf("restored tier of the dr target %q, want dr", got)
+	}
+}
+
+func TestRestoreManagerBreakerDefault(t *testing.T) {
+	// a snapshot of a Manager with the breaker, without the breakers of the targets, closes them
+	m := RestoreManager(Snapshot{
+		Timeout: time.Second,
+		Breaker: &BreakerConfig{Failures: 5, Cooldown: 30 * time.Second, HalfOpenDials: 1},
+		Targets: []TargetSnapshot{{Addr: "10.0.0.1:3306"}},
+	})
+	t.Cleanup(func() { _ = m.Close() })
+
+	if b := m.Snapshot().Targets[0].Breaker; b == nil || b.State != BreakerClosed {
+		t.Fatalf("restored breaker %+v, want closed", b)
+	}
+}
@@ -0,0 +1,136 @@
+package dualconn
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+)
+
+// StateStore persists the states of the targets across the restarts, see Manager.WithStateStore.
+type StateStore interface {
+	// Load returns the saved Snapshot, nil if none yet.
+	Load() (*Snapshot, error)
+	Save(s Snapshot) error
+}
+
+// FileStateStore is the StateStore of the Snapshot in the JSON file of the path,
+// written to a temporary file renamed over it, so a crash never leaves a partial one.
+type FileStateStore string
+
+func (f FileStateStore) Load() (*Snapshot, error) {
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (f FileStateStore) Save(s Snapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(string(f), data)
+}
+
+// WithStateStore reloads the saved states of the targets still in the Manager, the disabled ones and their breakers,
+// along with the active target and the failback by Manager.Failback in progress, so the dials keep away from
+// the targets disabled by the operators, and don't fail back on a restart under the delayed or manual failback.
+// The states are saved again on every change, on a goroutine of the Manager.
+func (d *Manager) WithStateStore(s StateStore) *Manager {
+	saved, err := s.Load()
+	if err != nil {
+		log.Printf("load state error: %v", err)
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if saved != nil {
+		d.restoreState(*saved)
+	}
+	if d.store == nil {
+		d.saves = make(chan struct{}, 1)
+		go d.saveStates()
+	}
+	d.store = s
+	d.stateChanged()
+	return d
+}
+
+// restoreState applies the saved states to the targets of the same addresses, called under the lock.
+func (d *Manager) restoreState(s Snapshot) {
+	for _, ts := range s.Targets {
+		for _, t := range d.Targets {
+			if t.Addr != ts.Addr {
+				continue
+			}
+			t.Disabled = ts.Disabled
+			// the breakers are kept only if still on
+			if d.breaker != nil && ts.Breaker != nil {
+				t.Breaker = clonePtr(ts.Breaker)
+			}
+			if t.Addr == s.Active {
+				d.Active = s.Active
+				d.failingBack = s.FailingBack
+			}
+		}
+	}
+}
+
+// stateChanged schedules a save of the states if WithStateStore is on, called under the lock.
+func (d *Manager) stateChanged() {
+	if d.saves == nil {
+		return
+	}
+	select {
+	case d.saves <- struct{}{}:
+	default:
+		// a save is pending already, which takes the latest states
+	}
+}
+
+// saveStates saves the states once changed, and the last change before the Manager closes.
+func (d *Manager) saveStates() {
+	for {
+		select {
+		case <-d.saves:
+			d.saveState()
+		case <-d.stop:
+			select {
+			case <-d.saves:
+				d.saveState()
+			default:
+			}
+			return
+		}
+	}
+}
+
+func (d *Manager) saveState() {
+	s := d.Snapshot()
+	d.Lock()
+	store := d.store
+	d.Unlock()
+
+	if err := store.Save(s); err != nil {
+		log.Printf("save state error: %v", err)
+	}
+}
+
+// writeFileAtomic writes the file by a temporary one renamed over it.
+func writeFileAtomic(file string, data []byte) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
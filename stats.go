@@ -0,0 +1,87 @@
+package dualconn
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// TargetStats are the statistics of the connections to a target, see Manager.Stats.
+type TargetStats struct {
+	Addr string `json:"addr"`
+	// Active counts the open connections, Total all the ones dialed.
+	Active int   `json:"active"`
+	Total  int64 `json:"total"`
+	// BytesRead and BytesWritten are the totals of all the connections, the closed ones included.
+	BytesRead    int64 `json:"bytesRead"`
+	BytesWritten int64 `json:"bytesWritten"`
+	// OldestAge and AvgAge are the ages of the open connections.
+	OldestAge time.Duration `json:"oldestAge"`
+	AvgAge    time.Duration `json:"avgAge"`
+}
+
+// connStats are the counters of the connections to a target, updated by the connections without the lock.
+type connStats struct {
+	total, read, written atomic.Int64
+}
+
+// Stats returns the statistics of the connections to the targets, like the traffic skew between them.
+func (d *Manager) Stats() []TargetStats {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.stats()
+}
+
+// stats is Stats called under the lock.
+func (d *Manager) stats() []TargetStats {
+	now := time.Now()
+	stats := make([]TargetStats, len(d.Targets))
+	for i, t := range d.Targets {
+		s := TargetStats{
+			Addr:         t.Addr,
+			Total:        t.stats.total.Load(),
+			BytesRead:    t.stats.read.Load(),
+			BytesWritten: t.stats.written.Load(),
+		}
+		var ages time.Duration
+		for _, c := range t.Conns {
+			if c.Closed {
+				continue
+			}
+			age := now.Sub(c.Created)
+			s.Active++
+			ages += age
+			s.OldestAge = max(s.OldestAge, age)
+		}
+		if s.Active > 0 {
+			s.AvgAge = ages / time.Duration(s.Active)
+		}
+		stats[i] = s
+	}
+	return stats
+}
+
+// TargetOf returns the target of the open connection by its local address, like the client address a database
+// reports for its session, matched by the port (the IP may be translated on the way), empty if none.
+func (d *Manager) TargetOf(local string) string {
+	_, port, err := net.SplitHostPort(local)
+	if err != nil {
+		return ""
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	for _, t := range d.Targets {
+		for _, c := range t.Conns {
+			if c.Closed {
+				continue
+			}
+			if _, p, err := net.SplitHostPort(c.LocalAddr().String()); err == nil && p == port {
+				return t.Addr
+			}
+		}
+	}
+	return ""
+}
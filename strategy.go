@@ -0,0 +1,109 @@
+package dualconn
+
+import (
+	"sort"
+	"time"
+)
+
+// Strategy orders the targets for a dial, which tries them in the order until one succeeds.
+// It is called under the lock of the Manager, with the enabled targets in their configured order.
+type Strategy interface {
+	Order(targets []*Target) []*Target
+}
+
+// StrategyFunc adapts a function to the Strategy.
+type StrategyFunc func(targets []*Target) []*Target
+
+func (f StrategyFunc) Order(targets []*Target) []*Target { return f(targets) }
+
+// WithStrategy balances the dials across the targets by the strategy, like RoundRobin for the read replicas,
+// instead of preferring the first target. The protagonist halo only applies to the default strategy.
+func (d *Manager) WithStrategy(s Strategy) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.strategy = s
+	return d
+}
+
+// RoundRobin rotates the targets by every dial.
+func RoundRobin() Strategy {
+	next := 0
+	return StrategyFunc(func(targets []*Target) []*Target {
+		if len(targets) == 0 {
+			return targets
+		}
+		start := next % len(targets)
+		next++
+		ordered := append([]*Target(nil), targets[start:]...)
+		return append(ordered, targets[:start]...)
+	})
+}
+
+// Weighted rotates the targets by the smooth weighted round-robin, the weights are by address,
+// 1 for the targets not given.
+func Weighted(weights map[string]int) Strategy {
+	current := map[string]int{}
+	return StrategyFunc(func(targets []*Target) []*Target {
+		if len(targets) == 0 {
+			return targets
+		}
+
+		total, best := 0, 0
+		for i, t := range targets {
+			w := weights[t.Addr]
+			if w <= 0 {
+				w = 1
+			}
+			total += w
+			current[t.Addr] += w
+			if current[t.Addr] > current[targets[best].Addr] {
+				best = i
+			}
+		}
+		current[targets[best].Addr] -= total
+
+		ordered := append([]*Target{targets[best]}, targets[:best]...)
+		return append(ordered, targets[best+1:]...)
+	})
+}
+
+// LeastConns prefers the targets with the fewest open connections.
+func LeastConns() Strategy {
+	return StrategyFunc(func(targets []*Target) []*Target {
+		ordered := append([]*Target(nil), targets...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return openConns(ordered[i]) < openConns(ordered[j])
+		})
+		return ordered
+	})
+}
+
+func openConns(t *Target) (n int) {
+	for _, c := range t.Conns {
+		if !c.Closed {
+			n++
+		}
+	}
+	return n
+}
+
+// LeastLatency prefers the targets with the lowest dial latency, the ones not dialed yet first to measure them.
+func LeastLatency() Strategy {
+	return StrategyFunc(func(targets []*Target) []*Target {
+		ordered := append([]*Target(nil), targets...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].Latency < ordered[j].Latency
+		})
+		return ordered
+	})
+}
+
+// observeLatency updates the moving average of the dial latency of the target.
+func (t *Target) observeLatency(cost time.Duration) {
+	if t.Latency == 0 {
+		t.Latency = cost
+		return
+	}
+	t.Latency = (t.Latency*4 + cost) / 5
+}
@@ -0,0 +1,128 @@
+package dualconn
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// addrs returns the addresses of the targets.
+func addrs(targets []*Target) []string {
+	a := make([]string, len(targets))
+	for i, t := range targets {
+		a[i] = t.Addr
+	}
+	return a
+}
+
+func TestStrategyOrder(t *testing.T) {
+	cases := []struct {
+		name     string
+		strategy Strategy
+		targets  func() []*Target
+		// want are the first targets of the successive dials, or the whole order of the one dial if single
+		want   []string
+		single bool
+	}{
+		{
+			name:     "round robin",
+			strategy: RoundRobin(),
+			targets:  func() []*Target { return []*Target{{Addr: "a"}, {Addr: "b"}, {Addr: "c"}} },
+			want:     []string{"a", "b", "c", "a", "b"},
+		},
+		{
+			name:     "smooth weighted",
+			strategy: Weighted(map[string]int{"a": 5, "b": 1, "c": 1}),
+			targets:  func() []*Target { return []*Target{{Addr: "a"}, {Addr: "b"}, {Addr: "c"}} },
+			want:     []string{"a", "a", "b", "a", "c", "a", "a"},
+		},
+		{
+			name:     "weighted by 1 when not given",
+			strategy: Weighted(map[string]int{"a": 2}),
+			targets:  func() []*Target { return []*Target{{Addr: "a"}, {Addr: "b"}} },
+			want:     []string{"a", "b", "a", "a", "b", "a"},
+		},
+		{
+			name:     "least conns, the closed ones not counted",
+			strategy: LeastConns(),
+			targets: func() []*Target {
+				return []*Target{
+					{Addr: "a", Conns: map[string]*DualConn{"1": {}, "2": {}}},
+					{Addr: "b", Conns: map[string]*DualConn{"1": {}, "2": {Closed: true}, "3": {Closed: true}}},
+					{Addr: "c", Conns: map[string]*DualConn{"1": {}, "2": {}, "3": {}}},
+					{Addr: "d"},
+				}
+			},
+			want:   []string{"d", "b", "a", "c"},
+			single: true,
+		},
+		{
+			name:     "least latency, the ones not dialed yet first",
+			strategy: LeastLatency(),
+			targets: func() []*Target {
+				return []*Target{{Addr: "a", Latency: 30 * time.Millisecond}, {Addr: "b"}, {Addr: "c", Latency: 10 * time.Millisecond}}
+			},
+			want:   []string{"b", "c", "a"},
+			single: true,
+		},
+		{
+			name:     "least latency keeps the configured order of the ties",
+			strategy: LeastLatency(),
+			targets: func() []*Target {
+				return []*Target{{Addr: "a", Latency: time.Millisecond}, {Addr: "b", Latency: time.Millisecond}}
+			},
+			want:   []string{"a", "b"},
+			single: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.single {
+				if got := addrs(c.strategy.Order(c.targets())); !slices.Equal(got, c.want) {
+					t.Fatalf("order %v, want %v", got, c.want)
+				}
+				return
+			}
+
+			targets := c.targets()
+			var got []string
+			for range c.want {
+				ordered := c.strategy.Order(targets)
+				if len(ordered) != len(targets) {
+					t.Fatalf("order %v drops the targets of %v", addrs(ordered), addrs(targets))
+				}
+				got = append(got, ordered[0].Addr)
+			}
+			if !slices.Equal(got, c.want) {
+				t.Fatalf("first targets %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestStrategyNoTargets(t *testing.T) {
+	for _, s := range []Strategy{RoundRobin(), Weighted(nil), LeastConns(), LeastLatency()} {
+		if got := s.Order(nil); len(got) != 0 {
+			t.Fatalf("order of no targets %v", addrs(got))
+		}
+	}
+}
+
+func TestRoundRobinFallsBackInOrder(t *testing.T) {
+	// the targets after the first are the fallbacks of the dial, in the rotated configured order
+	s := RoundRobin()
+	targets := []*Target{{Addr: "a"}, {Addr: "b"}, {Addr: "c"}}
+	s.Order(targets)
+	if got := addrs(s.Order(targets)); !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Fatalf("order %v, want [b c a]", got)
+	}
+}
+
+func TestObserveLatency(t *testing.T) {
+	var target Target
+	target.observeLatency(100 * time.Millisecond)
+	target.observeLatency(200 * time.Millisecond)
+	if want := 120 * time.Millisecond; target.Latency != want {
+		t.Fatalf("latency %s, want the moving average %s", target.Latency, want)
+	}
+}
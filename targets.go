@@ -0,0 +1,113 @@
+package dualconn
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.uber.org/multierr"
+)
+
+type pinnedTargetKey struct{}
+
+// WithTarget pins the dials with the returned context to the target regardless of the states of the Manager,
+// the unhealthy, open breaker or capped ones included but not the disabled ones, without the smoke test or switching
+// the active target, like for the maintenance queries on the standby. The pool of database/sql reuses its idle
+// connections to any target, pin the dials of a sql.DB without the idle connections, see sql.DB.SetMaxIdleConns.
+func WithTarget(ctx context.Context, target string) context.Context {
+	return context.WithValue(ctx, pinnedTargetKey{}, target)
+}
+
+func pinnedTarget(ctx context.Context) string {
+	target, _ := ctx.Value(pinnedTargetKey{}).(string)
+	return target
+}
+
+// AddTarget adds the target after the others, safe with the dials in flight.
+func (d *Manager) AddTarget(addr string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.indexOf(addr) >= 0 {
+		return fmt.Errorf("%w %s", ErrDuplicateTarget, addr)
+	}
+	if _, err := ParseTarget(addr); err != nil {
+		return err
+	}
+	d.Targets = append(d.Targets, d.newTarget(addr))
+	delete(d.discovered, addr)
+	return nil
+}
+
+// RemoveTarget removes the target and closes its connections, Drain it before to close them gracefully.
+// The dials in flight to it still succeed, but their connections are no longer tracked.
+func (d *Manager) RemoveTarget(addr string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	i := d.indexOf(addr)
+	if i < 0 {
+		return fmt.Errorf("%w %s", ErrUnknownTarget, addr)
+	}
+	t := d.Targets[i]
+	d.Targets = slices.Delete(slices.Clone(d.Targets), i, i+1)
+	d.forget(t)
+	return t.Close()
+}
+
+// SetTargets replaces the targets by the addresses in order, keeping the states of the ones still there,
+// and closing the connections of the removed ones, the targets discovered by DNS are kept after them.
+func (d *Manager) SetTargets(addrs []string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	targets := make([]*Target, 0, len(addrs)+len(d.discovered))
+	for _, addr := range addrs {
+		if slices.ContainsFunc(targets, func(t *Target) bool { return t.Addr == addr }) {
+			return fmt.Errorf("%w %s", ErrDuplicateTarget, addr)
+		}
+		if _, err := ParseTarget(addr); err != nil {
+			return err
+		}
+		if i := d.indexOf(addr); i >= 0 {
+			targets = append(targets, d.Targets[i])
+		} else {
+			targets = append(targets, d.newTarget(addr))
+		}
+		delete(d.discovered, addr)
+	}
+
+	var errs error
+	for _, t := range d.Targets {
+		switch {
+		case slices.Contains(targets, t):
+		case d.discovered[t.Addr]:
+			targets = append(targets, t)
+		default:
+			d.forget(t)
+			errs = multierr.Append(errs, t.Close())
+		}
+	}
+	d.Targets = targets
+	return errs
+}
+
+// newTarget creates the target, probed if the prober is on, called under the lock.
+func (d *Manager) newTarget(addr string) *Target {
+	t := &Target{Addr: addr, Conns: make(map[string]*DualConn), Tier: d.tiers[addr], stats: &connStats{}}
+	if d.prober != nil {
+		go d.probe(t, *d.prober)
+	}
+	return t
+}
+
+// forget clears the removed target from the states of the Manager, called under the lock.
+func (d *Manager) forget(t *Target) {
+	if d.Active == t.Addr {
+		d.Active = ""
+	}
+}
+
+func (d *Manager) indexOf(addr string) int {
+	return slices.IndexFunc(d.Targets, func(t *Target) bool { return t.Addr == addr })
+}
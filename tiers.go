@@ -0,0 +1,63 @@
+package dualconn
+
+import "slices"
+
+// WithTargetTier puts the target in the priority tier, like primary or dr, the tiers are in the order of their first
+// targets, and the targets of a tier are dialed only when all the ones of the earlier tiers are down,
+// the targets without a tier are in the "" tier. The strategy if any balances the first tier with a target up.
+func (d *Manager) WithTargetTier(target, tier string) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.tiers == nil {
+		d.tiers = map[string]string{}
+	}
+	d.tiers[target] = tier
+	if i := d.indexOf(target); i >= 0 {
+		d.Targets[i].Tier = tier
+	}
+	return d
+}
+
+// ActiveTier returns the tier of the active target, the one the dials currently land on.
+func (d *Manager) ActiveTier() string {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.activeTier()
+}
+
+// activeTier is ActiveTier called under the lock.
+func (d *Manager) activeTier() string {
+	if i := d.indexOf(d.Active); i >= 0 {
+		return d.Targets[i].Tier
+	}
+	return ""
+}
+
+// tiered groups the targets by their tiers in order, ordering the first tier with a target up by the strategy if any,
+// called under the lock.
+func (d *Manager) tiered(targets []*Target) []*Target {
+	var groups [][]*Target
+	index := map[string]int{}
+	for _, t := range targets {
+		i, ok := index[t.Tier]
+		if !ok {
+			i = len(groups)
+			index[t.Tier] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], t)
+	}
+	if d.strategy != nil && len(groups) > 0 {
+		up := 0
+		for i, g := range groups {
+			if slices.ContainsFunc(g, func(t *Target) bool { return t.state() == StateUp }) {
+				up = i
+				break
+			}
+		}
+		groups[up] = d.strategy.Order(groups[up])
+	}
+	return slices.Concat(groups...)
+}
@@ -0,0 +1,196 @@
+package dualconn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// TimelinePoint is a health transition or a latency sample of a target, see Manager.WithTimeline.
+type TimelinePoint struct {
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+	// State is the new state of a transition, like up, down or disabled, empty for the latency samples.
+	State string `json:"state,omitempty"`
+	// Latency is the moving average of the dial latency of a sample.
+	Latency time.Duration `json:"latency,omitempty"`
+	Err     string        `json:"err,omitempty"`
+}
+
+// TimelineConfig tunes the timelines of the targets.
+type TimelineConfig struct {
+	// Size is the number of the points kept per target, 1024 by default, the oldest ones are overwritten.
+	Size int
+	// SampleInterval is the minimal interval between the latency samples of a target, 10s by default.
+	SampleInterval time.Duration
+	// File persists the points in JSON lines, reloaded by WithTimeline and compacted to the Size per target,
+	// empty to keep them in memory only.
+	File string
+}
+
+// timeline is the ring buffer of the points of a target.
+type timeline struct {
+	points []TimelinePoint
+	// next is the position of the next point, the oldest one once full
+	next    int
+	full    bool
+	sampled time.Time
+}
+
+func (t *timeline) add(p TimelinePoint) {
+	t.points[t.next] = p
+	t.next = (t.next + 1) % len(t.points)
+	t.full = t.full || t.next == 0
+}
+
+// since returns the points after the time in order.
+func (t *timeline) since(since time.Time) []TimelinePoint {
+	ordered := t.points[:t.next]
+	if t.full {
+		ordered = append(append([]TimelinePoint(nil), t.points[t.next:]...), t.points[:t.next]...)
+	}
+
+	var points []TimelinePoint
+	for _, p := range ordered {
+		if p.Time.After(since) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// WithTimeline records the health transitions and the latency samples of the targets into the ring buffers,
+// persisted in the File if any, for the availability graphs without an external TSDB, see Manager.Timeline.
+func (d *Manager) WithTimeline(c TimelineConfig) *Manager {
+	if c.Size <= 0 {
+		c.Size = 1024
+	}
+	if c.SampleInterval <= 0 {
+		c.SampleInterval = 10 * time.Second
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.history, d.timelines = &c, map[string]*timeline{}
+	if c.File == "" {
+		return d
+	}
+	if err := d.loadTimelines(c.File); err != nil {
+		log.Printf("load timeline %s error: %v", c.File, err)
+	}
+	return d
+}
+
+// Timeline returns the points of the target after the time in order, nil if WithTimeline is off.
+func (d *Manager) Timeline(target string, since time.Time) []TimelinePoint {
+	d.Lock()
+	defer d.Unlock()
+
+	if t := d.timelines[target]; t != nil {
+		return t.since(since)
+	}
+	return nil
+}
+
+// recordTransition records the change of the state of the target, called under the lock.
+func (d *Manager) recordTransition(target, state string, err error) {
+	p := TimelinePoint{Time: d.clock.Now(), Target: target, State: state}
+	d.trackSLO(target, state, p.Time)
+	if err != nil {
+		p.Err = err.Error()
+	}
+	d.record(p)
+}
+
+// recordLatency samples the dial latency of the target, called under the lock.
+func (d *Manager) recordLatency(t *Target) {
+	if d.timelines == nil {
+		return
+	}
+	now := d.clock.Now()
+	if tl := d.timelines[t.Addr]; tl != nil && now.Sub(tl.sampled) < d.history.SampleInterval {
+		return
+	}
+	d.record(TimelinePoint{Time: now, Target: t.Addr, Latency: t.Latency})
+	d.timelines[t.Addr].sampled = now
+}
+
+// record adds the point to the timeline of its target, and appends it to the file if any, called under the lock.
+func (d *Manager) record(p TimelinePoint) {
+	if d.timelines == nil {
+		return
+	}
+	d.timeline(p.Target).add(p)
+
+	if d.history.File == "" {
+		return
+	}
+	if err := appendJSONLine(d.history.File, p); err != nil {
+		log.Printf("persist timeline %s error: %v", d.history.File, err)
+	}
+}
+
+// timeline returns the timeline of the target, created if none, called under the lock.
+func (d *Manager) timeline(target string) *timeline {
+	t := d.timelines[target]
+	if t == nil {
+		t = &timeline{points: make([]TimelinePoint, d.history.Size)}
+		d.timelines[target] = t
+	}
+	return t
+}
+
+// loadTimelines reloads the points of the file, and compacts it to the ones kept, called under the lock.
+func (d *Manager) loadTimelines(file string) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var p TimelinePoint
+		// the partial line of a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &p) == nil {
+			d.timeline(p.Target).add(p)
+		}
+	}
+	_ = f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, t := range d.timelines {
+		for _, p := range t.since(time.Time{}) {
+			if err := encoder.Encode(p); err != nil {
+				return err
+			}
+		}
+	}
+	return writeFileAtomic(file, buf.Bytes())
+}
+
+func appendJSONLine(file string, v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,118 @@
+package dualconn
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// WithTargetTLS handshakes TLS over the connections to the target by the config, like ServerName overriding the SNI
+// for the proxies routing on it, with the targets pointing at the same load balancer IP, and NextProtos the ALPN
+// protocols offered. The SNI is the host of the target when ServerName is empty.
+func (d *Manager) WithTargetTLS(target string, c *tls.Config) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.tlsConfigs == nil {
+		d.tlsConfigs = map[string]*tls.Config{}
+	}
+	d.tlsConfigs[target] = c
+	return d
+}
+
+// WithTLS handshakes TLS over the connections to all the targets by the config, like the client certificates in
+// Certificates, for the targets behind the TLS-terminating proxies, the ones of WithTargetTLS override it per target.
+// The SNI is the host of the target when ServerName is empty, the UDP targets are dialed without TLS.
+func (d *Manager) WithTLS(c *tls.Config) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.tls = c
+	return d
+}
+
+// dialTarget dials the target by the Dialer, and handshakes TLS over it when configured, or by its tls:// URL.
+func (d *Manager) dialTarget(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, u, err := d.dialEndpoint(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Lock()
+	c, verifier := cmp.Or(d.tlsConfigs[addr], d.tls), d.tlsVerifier
+	d.Unlock()
+	// no TLS over the datagrams, like the UDP sidecars
+	if c == nil && !u.TLS || strings.HasPrefix(cmp.Or(u.Network, network), "udp") {
+		return conn, nil
+	}
+
+	if c == nil {
+		c = &tls.Config{}
+	}
+	c = c.Clone()
+	if u.ServerName != "" {
+		c.ServerName = u.ServerName
+	}
+	if c.ServerName == "" && u.Network != "unix" {
+		c.ServerName, _, _ = net.SplitHostPort(u.Address)
+	}
+	if verifier != nil {
+		verify := c.VerifyConnection
+		c.VerifyConnection = func(state tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(state); err != nil {
+					return err
+				}
+			}
+			return verifier(addr, state)
+		}
+	}
+	tc := tls.Client(conn, c)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// TLSVerifier verifies the TLS connection to the target after the handshake, like pinning the certificates,
+// on top of the verification by the tls.Config, see Manager.WithTLSVerifier.
+type TLSVerifier func(target string, state tls.ConnectionState) error
+
+// WithTLSVerifier verifies the TLS connections to the targets by the verifier, along with the VerifyConnection
+// of their own configs, for the private PKI or the certificate pinning.
+func (d *Manager) WithTLSVerifier(v TLSVerifier) *Manager {
+	d.Lock()
+	defer d.Unlock()
+
+	d.tlsVerifier = v
+	return d
+}
+
+// PinCertificates verifies the leaf certificates of the targets by the base64 SHA-256 of their public keys (SPKI),
+// like the sha256//... of curl --pinnedpubkey, the targets without the pins are not verified by it.
+func PinCertificates(pins map[string][]string) TLSVerifier {
+	return func(target string, state tls.ConnectionState) error {
+		expected, ok := pins[target]
+		if !ok {
+			return nil
+		}
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("target %s presents no certificates", target)
+		}
+
+		sum := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		pin := base64.StdEncoding.EncodeToString(sum[:])
+		for _, p := range expected {
+			if strings.TrimPrefix(p, "sha256//") == pin {
+				return nil
+			}
+		}
+		return fmt.Errorf("target %s certificate sha256//%s not pinned", target, pin)
+	}
+}